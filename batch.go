@@ -2,8 +2,11 @@ package evdb
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -20,14 +23,15 @@ func BatchInterval(interval time.Duration, logger *log.Logger) Option {
 }
 
 type batchDB struct {
-	db     DB
-	mu     sync.RWMutex
-	events map[string]*batchEvent
-	logger *log.Logger
-	once   sync.Once
-	done   chan struct{}
-	wg     sync.WaitGroup
-	tick   *time.Ticker
+	db      DB
+	mu      sync.RWMutex
+	events  map[string]*batchEvent
+	logger  *log.Logger
+	once    sync.Once
+	done    chan struct{}
+	stopped chan struct{}
+	wg      sync.WaitGroup
+	tick    *time.Ticker
 }
 
 type batchEvent struct {
@@ -72,11 +76,12 @@ func newBatchDB(db DB, interval time.Duration, logger *log.Logger) (*batchDB, er
 		logger = log.New(ioutil.Discard, "", 0)
 	}
 	batch := batchDB{
-		db:     db,
-		logger: logger,
-		tick:   tick,
-		events: make(map[string]*batchEvent),
-		done:   make(chan struct{}),
+		db:      db,
+		logger:  logger,
+		tick:    tick,
+		events:  make(map[string]*batchEvent),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
 	}
 	go batch.run()
 	return &batch, nil
@@ -102,13 +107,61 @@ func (b *batchDB) Storer(event string) (Storer, error) {
 func (b *batchDB) Scan(ctx context.Context, queries ...Query) (Results, error) {
 	return b.db.Scan(ctx, queries...)
 }
+func (b *batchDB) Unwrap() DB {
+	return b.db
+}
+
+// ReportStats implements StatsReporter interface reporting the number of pending counters per event
+func (b *batchDB) ReportStats(stats map[string]interface{}) {
+	stats["batch"] = b.pending()
+}
+
+// Close flushes all pending counters and closes the underlying DB.
+// It returns an error reporting the counters of each event that could not be stored.
 func (b *batchDB) Close() error {
 	b.once.Do(func() {
 		defer close(b.done)
 		b.tick.Stop()
 	})
+	// Wait for the final flush
+	<-b.stopped
 	b.wg.Wait()
-	return b.db.Close()
+	err := b.db.Close()
+	pending := b.pending()
+	if len(pending) == 0 {
+		return err
+	}
+	events := make([]string, 0, len(pending))
+	for event := range pending {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+	for i, event := range events {
+		events[i] = fmt.Sprintf("%s=%d", event, pending[event])
+	}
+	if err != nil {
+		return errors.Errorf("Failed to close DB with unstored counters %s: %w", strings.Join(events, ", "), err)
+	}
+	return errors.Errorf("Failed to store counters %s", strings.Join(events, ", "))
+}
+
+// pending returns the number of pending counters per event
+func (b *batchDB) pending() map[string]int {
+	pending := make(map[string]int)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for name, e := range b.events {
+		n := 0
+		e.mu.RLock()
+		for _, event := range e.events {
+			n += event.NumNonZero()
+		}
+		e.mu.RUnlock()
+		if n > 0 {
+			pending[name] = n
+		}
+	}
+	return pending
 }
 
 func (b *batchDB) flushEvent(e *batchEvent, store Storer, tm time.Time) {
@@ -139,6 +192,7 @@ func (b *batchDB) flush(tm time.Time) {
 }
 
 func (b *batchDB) run() {
+	defer close(b.stopped)
 	for {
 		select {
 		case <-b.done:
@@ -0,0 +1,71 @@
+package evdb_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/events"
+	"github.com/alxarch/evdb/internal/assert"
+	errors "golang.org/x/xerrors"
+)
+
+type failStoreDB struct {
+	scanLog
+}
+
+func (*failStoreDB) Storer(event string) (evdb.Storer, error) {
+	return nil, errors.Errorf("Failed to store %q", event)
+}
+
+func TestBatchInterval(t *testing.T) {
+	mem := new(scanLog)
+	failed := new(failStoreDB)
+	if err := evdb.Register("batchtest", &scanLogOpener{mem}); err != nil {
+		t.Fatal(err)
+	}
+	if err := evdb.Register("batchfailtest", &dbOpener{failed}); err != nil {
+		t.Fatal(err)
+	}
+	snap := evdb.Snapshot{
+		Labels: []string{"color"},
+		Counters: []events.Counter{
+			{Count: 1, Values: []string{"blue"}},
+			{Count: 2, Values: []string{"red"}},
+		},
+	}
+	for _, tc := range []struct {
+		URL     string
+		Results int
+		Err     string
+	}{
+		{"batchtest://", 2, ""},
+		{"batchfailtest://", 0, "foo=2"},
+	} {
+		db, err := evdb.Open(tc.URL, evdb.BatchInterval(time.Hour, nil))
+		assert.NoError(t, err)
+		w, err := db.Storer("foo")
+		assert.NoError(t, err)
+		assert.NoError(t, w.Store(&snap))
+		assert.Equal(t, evdb.Stats(db)["batch"], map[string]int{"foo": 2})
+		// Close flushes pending counters
+		err = db.Close()
+		if tc.Err == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.OK(t, err != nil && strings.Contains(err.Error(), tc.Err), "Close error %v", err)
+		}
+		results, err := db.Scan(context.Background(), evdb.Query{
+			Event: "foo",
+			TimeRange: evdb.TimeRange{
+				Start: time.Now().Add(-time.Minute),
+				End:   time.Now().Add(time.Minute),
+				Step:  time.Minute,
+			},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, len(results), tc.Results)
+	}
+}
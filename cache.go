@@ -0,0 +1,401 @@
+package evdb
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+// CacheResults caches scan results for past time steps using up to maxSize bytes of memory.
+//
+// Queries are cached by event, field matchers and step. Query time ranges are aligned
+// to step boundaries so a scan always covers whole steps. Steps that have fully passed
+// are served from the cache and only the still open tail of a query is scanned.
+// Storing snapshots at past timestamps through the DB invalidates the affected steps.
+// Cached steps never expire otherwise, so snapshots stored at past timestamps by other
+// processes or directly to the wrapped DB are not seen until the entry is evicted.
+func CacheResults(maxSize int64) Option {
+	return fnOption(func(db DB) (DB, error) {
+		if maxSize <= 0 {
+			return nil, errors.Errorf("Invalid cache size %d", maxSize)
+		}
+		c := cacheDB{
+			DB:      db,
+			maxSize: maxSize,
+			entries: make(map[string]*list.Element),
+			gen:     make(map[string]uint64),
+		}
+		return &c, nil
+	})
+}
+
+type cacheDB struct {
+	DB
+	maxSize int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     list.List
+	entries map[string]*list.Element
+	// gen is bumped on each Store of an event to discard scans racing with stores
+	gen map[string]uint64
+}
+
+// cacheEntry holds the results of all steps in [start, end)
+type cacheEntry struct {
+	key        string
+	event      string
+	step       time.Duration
+	start, end int64
+	results    Results
+	size       int64
+}
+
+const (
+	cacheEntrySize  = 128
+	cacheResultSize = 64
+	cachePointSize  = 16
+)
+
+func (e *cacheEntry) slice(start, end int64) (results Results) {
+	for i := range e.results {
+		r := &e.results[i]
+		data := filterData(nil, r.Data, start, end)
+		if len(data) > 0 {
+			results = append(results, Result{
+				Fields: r.Fields,
+				Data:   data,
+			})
+		}
+	}
+	return
+}
+
+// truncate drops all steps after ts and returns the size of the dropped data
+func (e *cacheEntry) truncate(ts int64) (size int64) {
+	results := e.results[:0]
+	for _, r := range e.results {
+		n := len(r.Data)
+		r.Data = filterData(r.Data[:0], r.Data, e.start, ts)
+		size += int64(n-len(r.Data)) * cachePointSize
+		if len(r.Data) == 0 {
+			size += resultSize(&r)
+			continue
+		}
+		results = append(results, r)
+	}
+	e.results = results
+	e.end = ts
+	e.size -= size
+	return size
+}
+
+func (e *cacheEntry) add(fields Fields, data DataPoints) (size int64) {
+	for i := range e.results {
+		r := &e.results[i]
+		if r.Fields.Equal(fields) {
+			r.Data = append(r.Data, data...)
+			return int64(len(data)) * cachePointSize
+		}
+	}
+	e.results = append(e.results, Result{
+		Fields: fields.Copy(),
+		Data:   data.Copy(),
+	})
+	r := &e.results[len(e.results)-1]
+	return resultSize(r) + int64(len(data))*cachePointSize
+}
+
+func resultSize(r *Result) int64 {
+	size := int64(cacheResultSize)
+	for _, f := range r.Fields {
+		size += int64(len(f.Label) + len(f.Value))
+	}
+	return size
+}
+
+// filterData appends points in [start, end) to dst
+func filterData(dst, data DataPoints, start, end int64) DataPoints {
+	for _, p := range data {
+		if start <= p.Timestamp && p.Timestamp < end {
+			dst = append(dst, p)
+		}
+	}
+	return dst
+}
+
+func cacheKey(q *Query) (string, bool) {
+	if q.Step < time.Second || q.Step%time.Second != 0 {
+		return "", false
+	}
+	fields, err := q.Fields.MarshalJSON()
+	if err != nil {
+		return "", false
+	}
+	key := make([]byte, 0, len(q.Event)+len(fields)+16)
+	key = append(key, q.Event...)
+	key = append(key, 0)
+	key = strconv.AppendInt(key, int64(q.Step/time.Second), 10)
+	key = append(key, 0)
+	key = append(key, fields...)
+	return string(key), true
+}
+
+// Scan implements Scanner interface
+func (c *cacheDB) Scan(ctx context.Context, queries ...Query) (Results, error) {
+	queries = ScanQueries(queries).Compact()
+	var (
+		out  Results
+		pass []Query
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errc = make(chan error, len(queries))
+	)
+	for i := range queries {
+		q := &queries[i]
+		key, ok := cacheKey(q)
+		if !ok {
+			pass = append(pass, *q)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, err := c.scan(ctx, key, q)
+			if err == nil {
+				mu.Lock()
+				out = append(out, results...)
+				mu.Unlock()
+			}
+			errc <- err
+		}()
+	}
+	if len(pass) > 0 {
+		results, err := c.DB.Scan(ctx, pass...)
+		if err != nil {
+			// Cached scans must not write to the cache after Scan returns
+			wg.Wait()
+			return nil, err
+		}
+		mu.Lock()
+		out = append(out, results...)
+		mu.Unlock()
+	}
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (c *cacheDB) scan(ctx context.Context, key string, q *Query) (Results, error) {
+	var (
+		start  = q.Start.Truncate(q.Step)
+		s      = start.Unix()
+		e      = q.End.Truncate(q.Step).Unix()
+		closed = time.Now().Truncate(q.Step).Unix()
+		// Steps before mid are served from the cache
+		mid    = s
+		cached Results
+	)
+	c.mu.Lock()
+	gen := c.gen[q.Event]
+	if el := c.entries[key]; el != nil {
+		entry := el.Value.(*cacheEntry)
+		if entry.start <= s && s < entry.end {
+			mid = entry.end
+			if e < mid {
+				mid = e
+			}
+			cached = entry.slice(s, mid)
+			c.lru.MoveToFront(el)
+		}
+	}
+	c.mu.Unlock()
+
+	tail := Query{
+		Event:  q.Event,
+		Fields: q.Fields,
+		TimeRange: TimeRange{
+			Start: start.Add(time.Duration(mid-s) * time.Second),
+			End:   q.End,
+			Step:  q.Step,
+		},
+	}
+	if tail.End.Before(tail.Start) {
+		tail.End = tail.Start
+	}
+	scan, err := c.DB.Scan(ctx, tail)
+	if err != nil {
+		return nil, err
+	}
+	if closed > e {
+		closed = e
+	}
+	c.store(key, q, gen, s, mid, closed, scan)
+
+	results := make(Results, 0, len(cached)+len(scan))
+	for _, r := range cached {
+		results = append(results, Result{
+			TimeRange: q.TimeRange,
+			Event:     q.Event,
+			Fields:    r.Fields.Copy(),
+			Data:      r.Data,
+		})
+	}
+	for i := range scan {
+		r := &scan[i]
+		data := filterData(nil, r.Data, mid, math.MaxInt64)
+		if len(data) == 0 {
+			continue
+		}
+		if j := indexOfFields(results, r.Fields); j != -1 {
+			results[j].Data = append(results[j].Data, data...)
+			continue
+		}
+		results = append(results, Result{
+			TimeRange: q.TimeRange,
+			Event:     q.Event,
+			Fields:    r.Fields,
+			Data:      data,
+		})
+	}
+	return results, nil
+}
+
+// store caches the steps in [mid, end) of a scan that started at mid
+func (c *cacheDB) store(key string, q *Query, gen uint64, start, mid, end int64, scan Results) {
+	if end <= mid {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen[q.Event] != gen {
+		return
+	}
+	var entry *cacheEntry
+	if el := c.entries[key]; el != nil {
+		entry = el.Value.(*cacheEntry)
+		if entry.end != mid {
+			if mid != start {
+				// Entry was modified while scanning
+				return
+			}
+			c.remove(el)
+			entry = nil
+		}
+	}
+	if entry == nil {
+		entry = &cacheEntry{
+			key:   key,
+			event: q.Event,
+			step:  q.Step,
+			start: mid,
+			end:   mid,
+			size:  int64(cacheEntrySize + len(key)),
+		}
+		c.entries[key] = c.lru.PushFront(entry)
+		c.size += entry.size
+	}
+	for i := range scan {
+		r := &scan[i]
+		data := filterData(nil, r.Data, mid, end)
+		if len(data) == 0 {
+			continue
+		}
+		size := entry.add(r.Fields, data)
+		entry.size += size
+		c.size += size
+	}
+	entry.end = end
+	c.evict()
+}
+
+func (c *cacheDB) remove(el *list.Element) {
+	entry := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+}
+
+func (c *cacheDB) evict() {
+	for c.size > c.maxSize {
+		el := c.lru.Back()
+		if el == nil {
+			return
+		}
+		c.remove(el)
+	}
+}
+
+// invalidate drops cached steps of an event at or after tm
+func (c *cacheDB) invalidate(event string, tm time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen[event]++
+	var next *list.Element
+	for el := c.lru.Front(); el != nil; el = next {
+		next = el.Next()
+		entry := el.Value.(*cacheEntry)
+		if entry.event != event {
+			continue
+		}
+		ts := tm.Truncate(entry.step).Unix()
+		switch {
+		case ts >= entry.end:
+		case ts <= entry.start:
+			c.remove(el)
+		default:
+			c.size -= entry.truncate(ts)
+		}
+	}
+}
+
+// Storer implements Store interface
+func (c *cacheDB) Storer(event string) (Storer, error) {
+	s, err := c.DB.Storer(event)
+	if err != nil {
+		return nil, err
+	}
+	return &cacheStorer{
+		Storer: s,
+		event:  event,
+		cache:  c,
+	}, nil
+}
+
+func (c *cacheDB) Unwrap() DB {
+	return c.DB
+}
+
+type cacheStorer struct {
+	Storer
+	event string
+	cache *cacheDB
+}
+
+// Store implements Storer interface
+func (s *cacheStorer) Store(snap *Snapshot) error {
+	tm := snap.Time
+	if tm.IsZero() {
+		tm = time.Now()
+	}
+	defer s.cache.invalidate(s.event, tm)
+	return s.Storer.Store(snap)
+}
+
+func indexOfFields(results Results, fields Fields) int {
+	for i := range results {
+		if results[i].Fields.Equal(fields) {
+			return i
+		}
+	}
+	return -1
+}
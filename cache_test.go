@@ -0,0 +1,250 @@
+package evdb_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/events"
+	"github.com/alxarch/evdb/evutil"
+	"github.com/alxarch/evdb/internal/assert"
+	errors "golang.org/x/xerrors"
+)
+
+// scanLog is an in-memory DB that logs scan queries
+type scanLog struct {
+	mu      sync.Mutex
+	data    evdb.Results
+	queries []evdb.Query
+}
+
+func (s *scanLog) Storer(event string) (evdb.Storer, error) {
+	return evutil.StorerFunc(func(snap *evdb.Snapshot) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, c := range snap.Counters {
+			fields := evutil.ZipFields(snap.Labels, c.Values)
+			s.data = s.data.Add(event, fields, snap.Time.Unix(), float64(c.Count))
+		}
+		return nil
+	}), nil
+}
+
+func (s *scanLog) Scan(ctx context.Context, queries ...evdb.Query) (results evdb.Results, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries = append(s.queries, queries...)
+	for _, q := range queries {
+		start, end := q.Start.Unix(), q.End.Unix()
+		for _, r := range s.data {
+			if r.Event != q.Event || !q.Fields.Match(r.Fields) {
+				continue
+			}
+			for _, p := range r.Data {
+				if start <= p.Timestamp && p.Timestamp <= end {
+					ts := p.Timestamp - p.Timestamp%int64(q.Step/time.Second)
+					results = results.Add(q.Event, r.Fields, ts, p.Value)
+				}
+			}
+		}
+	}
+	for i := range results {
+		results[i].Sort()
+	}
+	return results, nil
+}
+
+func (s *scanLog) Close() error {
+	return nil
+}
+
+func (s *scanLog) last() evdb.Query {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries[len(s.queries)-1]
+}
+
+type scanLogOpener struct {
+	db *scanLog
+}
+
+func (o *scanLogOpener) Open(string) (evdb.DB, error) {
+	return o.db, nil
+}
+
+func TestCacheResults(t *testing.T) {
+	mem := new(scanLog)
+	if err := evdb.Register("cachetest", &scanLogOpener{mem}); err != nil {
+		t.Fatal(err)
+	}
+	db, err := evdb.Open("cachetest://", evdb.CacheResults(1<<20))
+	assert.NoError(t, err)
+	foo, err := db.Storer("foo")
+	assert.NoError(t, err)
+
+	now := time.Now()
+	hour := now.Truncate(time.Hour)
+	store := func(tm time.Time, n int64) {
+		err := foo.Store(&evdb.Snapshot{
+			Time:   tm,
+			Labels: []string{"color"},
+			Counters: []events.Counter{
+				{Count: n, Values: []string{"blue"}},
+			},
+		})
+		assert.NoError(t, err)
+	}
+	for i := 3; i >= 0; i-- {
+		store(hour.Add(time.Duration(-i)*time.Hour), int64(i+1))
+	}
+	ctx := context.Background()
+	q := evdb.Query{
+		Event: "foo",
+		TimeRange: evdb.TimeRange{
+			Start: now.Add(-3 * time.Hour),
+			End:   now,
+			Step:  time.Hour,
+		},
+		Fields: evdb.MatchFields{"color": evdb.MatchString("blue")},
+	}
+	want := evdb.DataPoints{
+		{Timestamp: hour.Add(-3 * time.Hour).Unix(), Value: 4},
+		{Timestamp: hour.Add(-2 * time.Hour).Unix(), Value: 3},
+		{Timestamp: hour.Add(-1 * time.Hour).Unix(), Value: 2},
+		{Timestamp: hour.Unix(), Value: 1},
+	}
+	results, err := db.Scan(ctx, q)
+	assert.NoError(t, err)
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, results[0].Data, want)
+	assert.Equal(t, results[0].TimeRange, q.TimeRange)
+	// Start is aligned to step
+	assert.Equal(t, mem.last().Start, hour.Add(-3*time.Hour))
+
+	// Only the open step is scanned
+	results, err = db.Scan(ctx, q)
+	assert.NoError(t, err)
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, results[0].Data, want)
+	assert.Equal(t, mem.last().Start, hour)
+
+	// Stores in the open step don't invalidate the cache
+	store(now, 1)
+	want[3].Value = 2
+	results, err = db.Scan(ctx, q)
+	assert.NoError(t, err)
+	assert.Equal(t, results[0].Data, want)
+	assert.Equal(t, mem.last().Start, hour)
+
+	// Stores in past steps invalidate the cache
+	store(hour.Add(-2*time.Hour), 1)
+	want[1].Value = 4
+	results, err = db.Scan(ctx, q)
+	assert.NoError(t, err)
+	assert.Equal(t, results[0].Data, want)
+	assert.Equal(t, mem.last().Start, hour.Add(-2*time.Hour))
+	results, err = db.Scan(ctx, q)
+	assert.NoError(t, err)
+	assert.Equal(t, results[0].Data, want)
+	assert.Equal(t, mem.last().Start, hour)
+
+	// Queries starting before cached steps are scanned in full
+	q.Start = now.Add(-4 * time.Hour)
+	results, err = db.Scan(ctx, q)
+	assert.NoError(t, err)
+	assert.Equal(t, results[0].Data, want)
+	assert.Equal(t, mem.last().Start, hour.Add(-4*time.Hour))
+
+	// Different matchers use different cache entries
+	q.Fields = evdb.MatchFields{"color": evdb.MatchString("red")}
+	results, err = db.Scan(ctx, q)
+	assert.NoError(t, err)
+	assert.Equal(t, len(results), 0)
+	assert.Equal(t, mem.last().Start, hour.Add(-4*time.Hour))
+
+	if _, err := evdb.Open("cachetest://", evdb.CacheResults(0)); err == nil {
+		t.Error("CacheResults(0) no error")
+	}
+}
+
+func TestCacheResults_Evict(t *testing.T) {
+	mem := new(scanLog)
+	if err := evdb.Register("cachetest-evict", &scanLogOpener{mem}); err != nil {
+		t.Fatal(err)
+	}
+	// Room for a single entry
+	db, err := evdb.Open("cachetest-evict://", evdb.CacheResults(300))
+	assert.NoError(t, err)
+	now := time.Now()
+	hour := now.Truncate(time.Hour)
+	ctx := context.Background()
+	scan := func(color string) time.Time {
+		_, err := db.Scan(ctx, evdb.Query{
+			Event: "foo",
+			TimeRange: evdb.TimeRange{
+				Start: hour.Add(-2 * time.Hour),
+				End:   now,
+				Step:  time.Hour,
+			},
+			Fields: evdb.MatchFields{"color": evdb.MatchString(color)},
+		})
+		assert.NoError(t, err)
+		return mem.last().Start
+	}
+	assert.Equal(t, scan("blue"), hour.Add(-2*time.Hour))
+	assert.Equal(t, scan("blue"), hour)
+	assert.Equal(t, scan("red"), hour.Add(-2*time.Hour))
+	assert.Equal(t, scan("red"), hour)
+	// Evicted
+	assert.Equal(t, scan("blue"), hour.Add(-2*time.Hour))
+}
+
+// failPassLog fails scans of queries that are not cached and delays the rest
+type failPassLog struct {
+	scanLog
+	scans int32
+}
+
+func (s *failPassLog) Scan(ctx context.Context, queries ...evdb.Query) (evdb.Results, error) {
+	for _, q := range queries {
+		if q.Step == 0 {
+			return nil, errors.New("Scan failed")
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	defer atomic.AddInt32(&s.scans, 1)
+	return s.scanLog.Scan(ctx, queries...)
+}
+
+type failPassOpener struct {
+	db *failPassLog
+}
+
+func (o *failPassOpener) Open(string) (evdb.DB, error) {
+	return o.db, nil
+}
+
+func TestCacheResults_PassError(t *testing.T) {
+	mem := new(failPassLog)
+	if err := evdb.Register("cachetest-error", &failPassOpener{mem}); err != nil {
+		t.Fatal(err)
+	}
+	db, err := evdb.Open("cachetest-error://", evdb.CacheResults(1<<20))
+	assert.NoError(t, err)
+	now := time.Now()
+	hour := now.Truncate(time.Hour)
+	tr := evdb.TimeRange{Start: hour.Add(-2 * time.Hour), End: now, Step: time.Hour}
+	_, err = db.Scan(context.Background(),
+		evdb.Query{Event: "foo", TimeRange: tr},
+		evdb.Query{Event: "bar", TimeRange: evdb.TimeRange{Start: tr.Start, End: now}},
+	)
+	assert.OK(t, err != nil, "Scan error")
+	// Cached scans finish before Scan returns
+	assert.Equal(t, atomic.LoadInt32(&mem.scans), int32(1))
+	_, err = db.Scan(context.Background(), evdb.Query{Event: "foo", TimeRange: tr})
+	assert.NoError(t, err)
+	assert.Equal(t, mem.last().Start, hour)
+}
@@ -0,0 +1,55 @@
+// Command evbadger-migrate upgrades a badger event store to the current storage format
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/alxarch/evdb/evbadger"
+	"github.com/dgraph-io/badger/v2"
+)
+
+var (
+	dbURL    = flag.String("db", "badger:///var/lib/meterd", "Database configuration URL")
+	logInfo  = log.New(os.Stdout, "[INFO] ", log.Ldate|log.Ltime)
+	logError = log.New(os.Stderr, "[ERROR] ", log.Ldate|log.Ltime)
+)
+
+func main() {
+	flag.Parse()
+	options, err := evbadger.ParseURL(*dbURL)
+	if err != nil {
+		logError.Fatal(err)
+	}
+	if options.ReadOnly {
+		logError.Fatal("Cannot migrate a read-only database")
+	}
+	db, err := badger.Open(options)
+	if err != nil {
+		logError.Fatal(err)
+	}
+	err = migrate(db)
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		logError.Fatal(err)
+	}
+}
+
+func migrate(db *badger.DB) error {
+	logInfo.Printf("Migrating %s to storage format version %d...\n", *dbURL, evbadger.FormatVersion)
+	stats, err := evbadger.Migrate(db)
+	if err != nil {
+		return err
+	}
+	logInfo.Printf("Migrated %d keys, %d snapshots\n", stats.Keys, stats.Snapshots)
+	if stats.SizeAfter > 0 {
+		logInfo.Printf("Snapshot size %d -> %d bytes (%.1fx)\n", stats.SizeBefore, stats.SizeAfter,
+			float64(stats.SizeBefore)/float64(stats.SizeAfter))
+	}
+	// Check that the migrated database opens and build the field index
+	_, err = evbadger.Open(db)
+	return err
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/evbadger"
+	"github.com/alxarch/evdb/evhttp"
+	"github.com/alxarch/evdb/evutil"
+	"github.com/dgraph-io/badger/v2"
+	errors "golang.org/x/xerrors"
+)
+
+// commands are meterd subcommands, running meterd without a subcommand serves HTTP
+var commands = map[string]func(args []string) error{
+	"backup":  backupCmd,
+	"restore": restoreCmd,
+	"export":  exportCmd,
+	"import":  importCmd,
+	"migrate": migrateCmd,
+}
+
+func newFlagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet("meterd "+name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: meterd %s [options] %s\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func openBadger(dbURL string) (*badger.DB, error) {
+	options, err := evbadger.ParseURL(dbURL)
+	if err != nil {
+		return nil, err
+	}
+	return badger.Open(options)
+}
+
+func createFile(name string) (io.WriteCloser, error) {
+	if name == "-" {
+		return os.Stdout, nil
+	}
+	return os.Create(name)
+}
+
+func openFile(name string) (io.ReadCloser, error) {
+	if name == "-" {
+		return os.Stdin, nil
+	}
+	return os.Open(name)
+}
+
+func backupCmd(args []string) error {
+	fs := newFlagSet("backup", "")
+	var (
+		dbURL  = fs.String("db", "badger:///var/lib/meterd", "Badger database configuration URL")
+		output = fs.String("o", "-", "Output file")
+		since  = fs.Uint64("since", 0, "Only backup keys changed after this version for incremental backups")
+	)
+	fs.Parse(args)
+	db, err := openBadger(*dbURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	w, err := createFile(*output)
+	if err != nil {
+		return err
+	}
+	version, err := db.Backup(w, *since)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return err
+	}
+	logInfo.Printf("Backup complete, use -since %d for the next incremental backup\n", version)
+	return nil
+}
+
+func restoreCmd(args []string) error {
+	fs := newFlagSet("restore", "")
+	var (
+		dbURL      = fs.String("db", "badger:///var/lib/meterd", "Badger database configuration URL")
+		input      = fs.String("i", "-", "Backup file")
+		maxPending = fs.Int("max-pending", 256, "Maximum number of pending writes while loading")
+	)
+	fs.Parse(args)
+	db, err := openBadger(*dbURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	r, err := openFile(*input)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := db.Load(r, *maxPending); err != nil {
+		return err
+	}
+	if _, err := evbadger.Open(db); err != nil {
+		return errors.Errorf("Failed to open restored database: %w", err)
+	}
+	logInfo.Printf("Restored %s\n", *dbURL)
+	return nil
+}
+
+// eventLister is implemented by DBs that can list their events
+type eventLister interface {
+	Events() []string
+}
+
+func listEvents(db evdb.DB) []string {
+	for db != nil {
+		if e, ok := db.(eventLister); ok {
+			return e.Events()
+		}
+		db = evdb.Unwrap(db)
+	}
+	return nil
+}
+
+func exportCmd(args []string) error {
+	fs := newFlagSet("export", "[EVENT...]")
+	var (
+		dbURL  = fs.String("db", "badger:///var/lib/meterd", "Database configuration URL")
+		output = fs.String("o", "-", "Output file")
+		format = fs.String("format", evutil.FormatNDJSON, "Output format (ndjson, csv), csv scans twice to find the label columns")
+		start  = fs.String("start", "", "Start time (RFC3339, date or UNIX timestamp), defaults to end - 24h")
+		end    = fs.String("end", "", "End time (RFC3339, date or UNIX timestamp), defaults to now")
+		chunk  = fs.Duration("chunk", 24*time.Hour, "Time range scanned at once")
+	)
+	fs.Parse(args)
+	if *chunk < time.Second {
+		return errors.Errorf("Invalid chunk %s", *chunk)
+	}
+	tr, err := parseTimeRange(*start, *end)
+	if err != nil {
+		return err
+	}
+	db, err := evdb.Open(*dbURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	events := fs.Args()
+	if len(events) == 0 {
+		if events = listEvents(db); len(events) == 0 {
+			return errors.New("No events to export")
+		}
+	}
+	ctx := context.Background()
+	var (
+		records []evutil.Record
+		labels  []string
+	)
+	if *format == evutil.FormatCSV {
+		// CSV columns are the labels of all records so they are collected before writing any chunk
+		err := scanChunks(ctx, db, events, tr, *chunk, time.Second, func(_ time.Time, results evdb.Results) error {
+			records = evutil.AppendRecords(records[:0], results)
+			labels = evutil.RecordLabels(labels, records)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	w, err := createFile(*output)
+	if err != nil {
+		return err
+	}
+	rw, err := evutil.NewRecordWriter(w, *format, labels...)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	err = scanChunks(ctx, db, events, tr, *chunk, time.Second, func(_ time.Time, results evdb.Results) error {
+		records = evutil.AppendRecords(records[:0], results)
+		return rw.Write(records)
+	})
+	if err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// scanChunks scans events at step resolution in chunks of tr, calling fn with the results of each chunk
+func scanChunks(ctx context.Context, s evdb.Scanner, events []string, tr evdb.TimeRange, chunk, step time.Duration, fn func(end time.Time, results evdb.Results) error) error {
+	for start := tr.Start; start.Before(tr.End); start = start.Add(chunk) {
+		end := start.Add(chunk)
+		if end.After(tr.End) {
+			end = tr.End
+		}
+		queries := make([]evdb.Query, len(events))
+		for i, event := range events {
+			queries[i] = evdb.Query{
+				Event: event,
+				TimeRange: evdb.TimeRange{
+					Start: start,
+					End:   end,
+					Step:  step,
+				},
+			}
+		}
+		results, err := s.Scan(ctx, queries...)
+		if err != nil {
+			return err
+		}
+		if err := fn(end, results); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseTimeRange(start, end string) (tr evdb.TimeRange, err error) {
+	tr.End = time.Now()
+	if end != "" {
+		if tr.End, err = evhttp.ParseTime(end); err != nil {
+			return
+		}
+	}
+	tr.Start = tr.End.Add(-24 * time.Hour)
+	if start != "" {
+		if tr.Start, err = evhttp.ParseTime(start); err != nil {
+			return
+		}
+	}
+	if !tr.Start.Before(tr.End) {
+		err = errors.Errorf("Invalid time range %s - %s", tr.Start, tr.End)
+	}
+	return
+}
+
+func importCmd(args []string) error {
+	fs := newFlagSet("import", "[FILE...]")
+	var (
+		dbURL  = fs.String("db", "badger:///var/lib/meterd", "Database configuration URL")
+		format = fs.String("format", "", "Input format (ndjson, csv), defaults to file extension")
+	)
+	fs.Parse(args)
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	db, err := evdb.Open(*dbURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	im := evutil.Importer{Store: db}
+	for _, name := range files {
+		f := *format
+		if f == "" && strings.EqualFold(filepath.Ext(name), ".csv") {
+			f = evutil.FormatCSV
+		}
+		r, err := openFile(name)
+		if err != nil {
+			return err
+		}
+		err = evutil.ReadRecords(r, f, im.Import)
+		r.Close()
+		if err != nil {
+			return errors.Errorf("Failed to import %s: %w", name, err)
+		}
+	}
+	if err := im.Flush(); err != nil {
+		return err
+	}
+	logInfo.Printf("Imported %d records in %d snapshots\n", im.Records, im.Snapshots)
+	return nil
+}
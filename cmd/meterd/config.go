@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/evalert"
+	"github.com/alxarch/evdb/evhttp"
+	"github.com/alxarch/evdb/evql"
+	errors "golang.org/x/xerrors"
+)
+
+// config is the meterd configuration.
+//
+// Config files are JSON, YAML or TOML depending on their extension.
+// Flags set their defaults, the listen flags are the defaults of every listen address. On SIGHUP the config file is reloaded
+// and changes to auth, rate limits, retention, saved queries and alert rules are applied,
+// other changes require a restart.
+type config struct {
+	Listen          []listenConfig `json:"listen"`
+	DB              string         `json:"db"`
+	ReadOnly        bool           `json:"readOnly"`
+	Batch           duration       `json:"batch"`
+	Cache           int64          `json:"cache"`
+	Timeout         duration       `json:"timeout"`
+	ShutdownTimeout duration       `json:"shutdownTimeout"`
+	Debug           bool           `json:"debug"`
+	// Events are the names of served events, a leading or trailing '*' matches any suffix or prefix
+	Events []string `json:"events"`
+
+	Auth      authConfig        `json:"auth"`
+	RateLimit rateLimitConfig   `json:"rateLimit"`
+	Retention duration          `json:"retention"`
+	Queries   []evql.SavedQuery `json:"queries"`
+	// Alerts enables alert rule evaluation
+	Alerts *evalert.Config `json:"alerts,omitempty"`
+}
+
+type listenConfig struct {
+	Addr     string `json:"addr"`
+	BasePath string `json:"basePath"`
+	// TLSCert and TLSKey enable HTTPS, TLSClientCA requires client certificates signed by its CAs
+	TLSCert     string `json:"tlsCert,omitempty"`
+	TLSKey      string `json:"tlsKey,omitempty"`
+	TLSClientCA string `json:"tlsClientCA,omitempty"`
+	// H2C accepts HTTP/2 without TLS
+	H2C bool `json:"h2c,omitempty"`
+}
+
+// Validate checks the listen config for errors
+func (l *listenConfig) Validate() error {
+	if l.Addr == "" {
+		return errors.New("Empty listen address")
+	}
+	if (l.TLSCert == "") != (l.TLSKey == "") {
+		return errors.Errorf("Listen address %s needs both a TLS certificate and key", l.Addr)
+	}
+	if l.TLSCert == "" && l.TLSClientCA != "" {
+		return errors.Errorf("Listen address %s needs a TLS certificate to verify clients", l.Addr)
+	}
+	if l.TLSCert != "" && l.H2C {
+		return errors.Errorf("Listen address %s cannot use h2c with TLS", l.Addr)
+	}
+	return nil
+}
+
+// Server creates an HTTP server for the listen config
+func (l *listenConfig) Server(h http.Handler) (*http.Server, error) {
+	srv := http.Server{
+		Addr:    l.Addr,
+		Handler: h,
+	}
+	if l.TLSCert != "" {
+		config, err := evhttp.ServerTLSConfig(l.TLSCert, l.TLSKey, l.TLSClientCA)
+		if err != nil {
+			return nil, err
+		}
+		srv.TLSConfig = config
+	}
+	if l.H2C {
+		srv.Protocols = new(http.Protocols)
+		srv.Protocols.SetHTTP1(true)
+		srv.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return &srv, nil
+}
+
+// listenAndServe serves HTTPS if the server has a TLS config
+func listenAndServe(srv *http.Server) error {
+	if srv.TLSConfig != nil {
+		return srv.ListenAndServeTLS("", "")
+	}
+	return srv.ListenAndServe()
+}
+
+// authConfig requires requests to have a bearer token or basic auth credentials if not empty
+type authConfig struct {
+	Tokens []string          `json:"tokens,omitempty"`
+	Users  map[string]string `json:"users,omitempty"`
+}
+
+// rateLimitConfig limits the requests per second of each client address, zero RPS disables limits
+type rateLimitConfig struct {
+	RPS   float64 `json:"rps"`
+	Burst int     `json:"burst"`
+}
+
+// duration is a time.Duration parsed from strings in JSON
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// loadConfig reads a config file over the defaults of base.
+// Files with .yaml, .yml or .toml extensions are parsed as YAML or TOML, other files as JSON.
+func loadConfig(filename string, base *config) (*config, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	c, err := parseConfig(filepath.Ext(filename), data, base)
+	if err != nil {
+		return nil, errors.Errorf("Invalid config file %s: %w", filename, err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, errors.Errorf("Invalid config file %s: %w", filename, err)
+	}
+	return c, nil
+}
+
+// parseConfig parses a config in the format of a file extension over the defaults of base
+func parseConfig(ext string, data []byte, base *config) (*config, error) {
+	var (
+		v   interface{}
+		err error
+	)
+	switch strings.ToLower(ext) {
+	case ".yaml", ".yml":
+		v, err = parseYAML(data)
+	case ".toml":
+		v, err = parseTOML(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if v != nil {
+		if data, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	c := *base
+	c.Listen = nil
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	var listen struct {
+		Listen []json.RawMessage `json:"listen"`
+	}
+	if err := json.Unmarshal(data, &listen); err != nil {
+		return nil, err
+	}
+	if listen.Listen == nil {
+		c.Listen = append([]listenConfig(nil), base.Listen...)
+		return &c, nil
+	}
+	// Every listen address is decoded over the listen flags
+	var defaults listenConfig
+	if len(base.Listen) > 0 {
+		defaults = base.Listen[0]
+	}
+	c.Listen = make([]listenConfig, len(listen.Listen))
+	for i, raw := range listen.Listen {
+		c.Listen[i] = defaults
+		if err := json.Unmarshal(raw, &c.Listen[i]); err != nil {
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+// Validate checks the config for errors
+func (c *config) Validate() error {
+	if c.DB == "" {
+		return errors.New("Missing db URL")
+	}
+	if len(c.Listen) == 0 {
+		return errors.New("No listen addresses")
+	}
+	addrs := make(map[string]bool, len(c.Listen))
+	for i := range c.Listen {
+		l := &c.Listen[i]
+		if err := l.Validate(); err != nil {
+			return err
+		}
+		if addrs[l.Addr] {
+			return errors.Errorf("Duplicate listen address %s", l.Addr)
+		}
+		addrs[l.Addr] = true
+	}
+	if c.RateLimit.RPS < 0 || c.RateLimit.Burst < 0 {
+		return errors.Errorf("Invalid rate limit %v", c.RateLimit)
+	}
+	if c.Retention < 0 {
+		return errors.Errorf("Invalid retention %s", time.Duration(c.Retention))
+	}
+	for i := range c.Queries {
+		if err := c.Queries[i].Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Alerts != nil {
+		return c.Alerts.Validate()
+	}
+	return nil
+}
+
+// Options returns the DB options of the config
+func (c *config) Options() []evdb.Option {
+	var opts []evdb.Option
+	if len(c.Events) > 0 {
+		opts = append(opts, evdb.MatchEvents(eventMatcher(c.Events)))
+	}
+	if c.ReadOnly {
+		opts = append(opts, evdb.ReadOnly())
+	}
+	if c.Cache > 0 {
+		opts = append(opts, evdb.CacheResults(c.Cache))
+	}
+	if c.Batch > 0 {
+		opts = append(opts, evdb.BatchInterval(time.Duration(c.Batch), logError))
+	}
+	return append(opts, evdb.CollectStats())
+}
+
+func eventMatcher(events []string) evdb.Matcher {
+	var (
+		names []string
+		m     evdb.Matchers
+	)
+	for _, event := range events {
+		switch {
+		case strings.HasSuffix(event, "*"):
+			m = append(m, evdb.MatchPrefix(strings.TrimSuffix(event, "*")))
+		case strings.HasPrefix(event, "*"):
+			m = append(m, evdb.MatchSuffix(strings.TrimPrefix(event, "*")))
+		default:
+			names = append(names, event)
+		}
+	}
+	if len(names) > 0 {
+		m = append(m, evdb.MatchAny(names...))
+	}
+	if len(m) == 1 {
+		return m[0]
+	}
+	return m
+}
+
+// restartRequired reports whether changes from c to other cannot be applied without restarting
+func (c *config) restartRequired(other *config) bool {
+	a, b := *c, *other
+	a.Auth, b.Auth = authConfig{}, authConfig{}
+	a.RateLimit, b.RateLimit = rateLimitConfig{}, rateLimitConfig{}
+	a.Retention, b.Retention = 0, 0
+	a.Queries, b.Queries = nil, nil
+	// Alert rules and receivers are reloaded if alerts remain enabled
+	if (a.Alerts == nil) == (b.Alerts == nil) {
+		a.Alerts, b.Alerts = nil, nil
+	}
+	return !reflect.DeepEqual(a, b)
+}
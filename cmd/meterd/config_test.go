@@ -0,0 +1,153 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alxarch/evdb/evql"
+	"github.com/alxarch/evdb/internal/assert"
+)
+
+func TestParseConfig(t *testing.T) {
+	base := config{
+		Listen:          []listenConfig{{Addr: ":8080", BasePath: "/meter", H2C: true}},
+		DB:              "badger:///var/lib/meterd",
+		ShutdownTimeout: duration(30 * time.Second),
+	}
+	want := base
+	want.Listen = []listenConfig{
+		{Addr: ":8080", BasePath: "/api", H2C: true},
+		{Addr: ":9090", BasePath: "/meter", H2C: true},
+		{Addr: ":9443", BasePath: "/meter", TLSCert: "cert.pem", TLSKey: "key.pem"},
+	}
+	want.Cache = 1 << 20
+	want.Batch = duration(5 * time.Second)
+	want.Events = []string{"http_*", "errors"}
+	want.Auth = authConfig{Users: map[string]string{"admin": "se#cret"}}
+	want.RateLimit = rateLimitConfig{RPS: 2.5, Burst: 10}
+	want.Queries = []evql.SavedQuery{
+		{Name: "by-host", Query: "*BY{host};\nhttp_requests{host: $host}\n", Params: []evql.Param{{Name: "host", Value: "www"}}},
+		{Name: "all", Query: "http_requests"},
+	}
+	for _, tc := range []struct {
+		Ext  string
+		Data string
+	}{
+		{".json", `{
+	"listen": [
+		{"basePath": "/api"},
+		{"addr": ":9090"},
+		{"addr": ":9443", "tlsCert": "cert.pem", "tlsKey": "key.pem", "h2c": false}
+	],
+	"cache": 1048576,
+	"batch": "5s",
+	"events": ["http_*", "errors"],
+	"auth": {"users": {"admin": "se#cret"}},
+	"rateLimit": {"rps": 2.5, "burst": 10},
+	"queries": [
+		{"name": "by-host", "query": "*BY{host};\nhttp_requests{host: $host}\n", "params": [{"name": "host", "value": "www"}]},
+		{"name": "all", "query": "http_requests"}
+	]
+}`},
+		{".yaml", `
+# Listen on three addresses
+listen:
+- basePath: /api
+- addr: ":9090"
+-   addr: :9443
+    tlsCert: cert.pem
+    tlsKey: 'key.pem'
+    h2c: false
+cache: 1048576 # 1MB
+batch: 5s
+events: ["http_*", errors]
+auth:
+  users:
+    admin: "se#cret"
+rateLimit: {rps: 2.5, burst: 10}
+queries:
+  - name: by-host
+    query: |
+      *BY{host};
+      http_requests{host: $host}
+    params:
+      - name: host
+        value: www
+  - name: all
+    query: http_requests
+`},
+		{".toml", `
+cache = 1_048_576 # 1MB
+batch = "5s"
+events = [
+	"http_*",
+	"errors",
+]
+rateLimit = {rps = 2.5, burst = 10}
+
+[auth.users]
+admin = "se#cret"
+
+[[listen]]
+basePath = "/api"
+
+[[listen]]
+addr = ":9090"
+
+[[listen]]
+addr = ":9443"
+tlsCert = 'cert.pem'
+tlsKey = "key.pem"
+h2c = false
+
+[[queries]]
+name = "by-host"
+query = """
+*BY{host};
+http_requests{host: $host}
+"""
+params = [{name = "host", value = "www"}]
+
+[[queries]]
+name = "all"
+query = "http_requests"
+`},
+	} {
+		t.Run(tc.Ext, func(t *testing.T) {
+			c, err := parseConfig(tc.Ext, []byte(tc.Data), &base)
+			assert.NoError(t, err)
+			assert.Equal(t, c, &want)
+		})
+	}
+	// The listen flags are used without listen addresses in the config
+	c, err := parseConfig(".yml", []byte("db: redis://localhost:6379"), &base)
+	assert.NoError(t, err)
+	assert.Equal(t, c.Listen, base.Listen)
+	assert.Equal(t, c.DB, "redis://localhost:6379")
+	// Listen addresses inherit the -addr flag
+	c, err = parseConfig(".yml", []byte("listen:\n- basePath: /a\n- basePath: /b"), &base)
+	assert.NoError(t, err)
+	assert.OK(t, c.Validate() != nil, "Duplicate listen addresses are invalid")
+}
+
+func TestParseConfig_Errors(t *testing.T) {
+	for _, tc := range []struct {
+		Ext  string
+		Data string
+	}{
+		{".yaml", "listen:\n  - addr: :80\n   basePath: /"},
+		{".yaml", "cache: 1\ncache: 2"},
+		{".yaml", "events: [a, b"},
+		{".yaml", "db"},
+		{".toml", "cache = "},
+		{".toml", "cache = 1\ncache = 2"},
+		{".toml", "db = \"redis://\" extra"},
+		{".toml", "[listen\naddr = \":80\""},
+		{".toml", `db = "\q"`},
+		{".json", "{"},
+	} {
+		if _, err := parseConfig(tc.Ext, []byte(tc.Data), &config{}); err == nil {
+			t.Errorf("parseConfig(%q, %q) no error", tc.Ext, tc.Data)
+		}
+	}
+}
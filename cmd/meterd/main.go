@@ -3,17 +3,21 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/alxarch/evdb"
-	_ "github.com/alxarch/evdb/evbadger"
 	"github.com/alxarch/evdb/evhttp"
+	_ "github.com/alxarch/evdb/evmulti"
 	_ "github.com/alxarch/evdb/evredis"
+	_ "github.com/alxarch/evdb/evshard"
 	"github.com/gorilla/handlers"
 )
 
@@ -23,62 +27,175 @@ var (
 	debug    = flag.Bool("debug", false, "Debug logs")
 	basePath = flag.String("basepath", "", "Basepath for URLs")
 	dbURL    = flag.String("db", "badger:///var/lib/meterd", "Database configuration URL")
+	cache    = flag.Int64("cache", 0, "Query result cache size in bytes (0 disables caching)")
+	timeout  = flag.Duration("timeout", 0, "Maximum duration of HTTP requests (0 disables timeouts)")
+	batch    = flag.Duration("batch", 0, "Batch stored snapshots and flush them at this interval (0 disables batching)")
+	shutdown = flag.Duration("shutdown-timeout", 30*time.Second, "Maximum duration of graceful shutdown")
+	tlsCert  = flag.String("tls-cert", "", "TLS certificate file, serves HTTPS with -tls-key")
+	tlsKey   = flag.String("tls-key", "", "TLS private key file")
+	clientCA = flag.String("tls-client-ca", "", "Require TLS client certificates signed by the CAs in this file")
+	h2c      = flag.Bool("h2c", false, "Accept HTTP/2 without TLS")
+	confFile = flag.String("config", "", "Config file (JSON, YAML or TOML by extension), flags set its defaults and SIGHUP reloads it")
 	logInfo  = log.New(os.Stdout, "[INFO] ", log.Ldate|log.Ltime)
 	logError = log.New(os.Stderr, "[ERROR] ", log.Ldate|log.Ltime)
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd(os.Args[2:]); err != nil {
+				logError.Fatal(err)
+			}
+			return
+		}
+	}
+	flag.Usage = usage
 	flag.Parse()
-	var opts []evdb.Option
-	events := flag.Args()
-	if len(events) > 0 {
-		opts = append(opts, evdb.MatchEvents(evdb.MatchAny(events...)))
+	conf := &config{
+		Listen: []listenConfig{{
+			Addr:        *addr,
+			BasePath:    *basePath,
+			TLSCert:     *tlsCert,
+			TLSKey:      *tlsKey,
+			TLSClientCA: *clientCA,
+			H2C:         *h2c,
+		}},
+		DB:              *dbURL,
+		ReadOnly:        *readOnly,
+		Batch:           duration(*batch),
+		Cache:           *cache,
+		Timeout:         duration(*timeout),
+		ShutdownTimeout: duration(*shutdown),
+		Debug:           *debug,
+		Events:          flag.Args(),
+	}
+	defaults := conf
+	if *confFile != "" {
+		c, err := loadConfig(*confFile, defaults)
+		if err != nil {
+			logError.Fatal(err)
+		}
+		conf = c
+	} else if err := conf.Validate(); err != nil {
+		logError.Fatal(err)
 	}
 
-	db, err := evdb.Open(*dbURL, opts...)
+	db, err := evdb.Open(conf.DB, conf.Options()...)
 	if err != nil {
 		logError.Fatal(err)
 	}
-	defer db.Close()
-	sigc := make(chan os.Signal)
-	signal.Notify(sigc, syscall.SIGTERM)
-	signal.Notify(sigc, syscall.SIGINT)
-	ctx := context.Background()
-	done := ctx.Done()
-	go func() {
-		select {
-		case <-sigc:
-		case <-done:
-		}
-		logInfo.Println("Shutting down...")
-		if err := db.Close(); err != nil {
-			logError.Printf("Failed to close db: %s\n", err)
-			os.Exit(1)
-		}
-		os.Exit(0)
-	}()
+	s, err := newServer(db, conf)
+	if err != nil {
+		logError.Fatal(err)
+	}
+	if err := s.saveQueries(); err != nil {
+		logError.Printf("Failed to save queries: %s\n", err)
+	}
 	var w evdb.Store
-	if !*readOnly {
+	if !conf.ReadOnly {
 		w = db
+	}
+	handler := s.Mux(evhttp.DefaultMux(db, w))
+	handler = evhttp.MaxTimeout(handler, time.Duration(conf.Timeout))
+	handler = s.Handler(handler)
 
+	errc := make(chan error, len(conf.Listen))
+	// Event streams last until the client disconnects so they are ended explicitly on shutdown
+	streamsDone := make(chan struct{})
+	baseContext := func(net.Listener) context.Context {
+		return evhttp.WithShutdown(context.Background(), streamsDone)
 	}
-	srv := http.Server{
-		Addr:     *addr,
-		ErrorLog: logError,
-		Handler:  evhttp.DefaultMux(db, w),
+	servers := make([]*http.Server, len(conf.Listen))
+	for i, l := range conf.Listen {
+		srv, err := l.Server(handler)
+		if err != nil {
+			logError.Fatal(err)
+		}
+		srv.ErrorLog = logError
+		srv.BaseContext = baseContext
+		if prefix := l.BasePath; prefix != "" {
+			prefix = "/" + strings.Trim(prefix, "/")
+			srv.Handler = http.StripPrefix(prefix, srv.Handler)
+		}
+		if conf.Debug {
+			srv.Handler = handlers.CombinedLoggingHandler(os.Stdout, srv.Handler)
+		}
+		servers[i] = srv
+		go func() {
+			logInfo.Printf("Serving %s on %s...\n", conf.DB, srv.Addr)
+			errc <- listenAndServe(srv)
+		}()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.runRetention(ctx)
+	go s.runAlerts(ctx)
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	for running := true; running; {
+		select {
+		case sig := <-sigc:
+			if sig == syscall.SIGHUP {
+				reload(s, *confFile, defaults)
+				continue
+			}
+			logInfo.Printf("Received %s, shutting down...\n", sig)
+			running = false
+		case err := <-errc:
+			logError.Printf("Server failed: %s\n", err)
+			running = false
+		}
+	}
+	cancel()
+	close(streamsDone)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Duration(conf.ShutdownTimeout))
+	defer cancel()
+	// Stop accepting requests and drain in-flight requests before flushing batches
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			logError.Printf("Failed to drain HTTP requests on %s: %s\n", srv.Addr, err)
+		}
 	}
-	if prefix := *basePath; prefix != "" {
-		prefix = "/" + strings.Trim(prefix, "/")
-		srv.Handler = http.StripPrefix(prefix, srv.Handler)
+	// Flushing batches gets its own timeout even if draining requests used it up
+	ctx, cancel = context.WithTimeout(context.Background(), time.Duration(conf.ShutdownTimeout))
+	defer cancel()
+	if err := closeDB(ctx, db); err != nil {
+		logError.Fatalf("Failed to close db: %s\n", err)
 	}
+	logInfo.Println("Shutdown complete")
+}
 
-	if *debug {
-		srv.Handler = handlers.CombinedLoggingHandler(os.Stdout, srv.Handler)
+// reload reloads the config file
+func reload(s *server, filename string, defaults *config) {
+	if filename == "" {
+		return
+	}
+	c, err := loadConfig(filename, defaults)
+	if err != nil {
+		logError.Printf("Failed to reload config: %s\n", err)
+		return
 	}
+	s.Reload(c)
+	logInfo.Printf("Reloaded %s\n", filename)
+}
 
-	logInfo.Printf("Serving %s on %s...\n", *dbURL, srv.Addr)
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		logError.Printf("Server failed: %s\n", err)
+// closeDB closes a DB unless ctx is done first
+func closeDB(ctx context.Context, db evdb.DB) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- db.Close()
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
 
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "Usage: meterd [options] [EVENT...]\n")
+	fmt.Fprintf(w, "       meterd backup|restore|export|import|migrate [options]\n")
+	flag.PrintDefaults()
 }
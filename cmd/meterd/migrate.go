@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/evutil"
+	errors "golang.org/x/xerrors"
+)
+
+// checkpoint records the progress of a migration
+type checkpoint struct {
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Events []string  `json:"events"`
+	Done   time.Time `json:"done"`
+}
+
+func loadCheckpoint(name string) (*checkpoint, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	cp := checkpoint{}
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, errors.Errorf("Invalid checkpoint %s: %w", name, err)
+	}
+	return &cp, nil
+}
+
+// save atomically replaces the checkpoint file
+func (cp *checkpoint) save(name string) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// migrateStats are the per event counts of a migration
+type migrateStats struct {
+	Records int64
+	Total   int64
+}
+
+// discardStore is a Store dropping all snapshots for dry runs
+type discardStore struct{}
+
+func (discardStore) Storer(event string) (evdb.Storer, error) {
+	return evutil.StorerFunc(func(*evdb.Snapshot) error { return nil }), nil
+}
+
+// stepper is implemented by DBs that store counters at a coarser step than one second
+type stepper interface {
+	MinStep() time.Duration
+}
+
+// sourceStep returns the smallest step a DB can be scanned at
+func sourceStep(db evdb.DB) time.Duration {
+	for db != nil {
+		if s, ok := db.(stepper); ok {
+			return s.MinStep()
+		}
+		db = evdb.Unwrap(db)
+	}
+	return time.Second
+}
+
+// migration copies events to a Store in chunks scanned at the source step
+type migration struct {
+	Events []string
+	Chunk  time.Duration
+	Step   time.Duration
+	Stats  map[string]*migrateStats
+	evutil.Importer
+}
+
+// Run migrates events in tr from src calling done with the end of each stored chunk
+func (m *migration) Run(ctx context.Context, src evdb.Scanner, tr evdb.TimeRange, done func(end time.Time) error) error {
+	if m.Stats == nil {
+		m.Stats = make(map[string]*migrateStats)
+	}
+	var records []evutil.Record
+	return scanChunks(ctx, src, m.Events, tr, m.Chunk, m.Step, func(end time.Time, results evdb.Results) error {
+		records = evutil.AppendRecords(records[:0], results)
+		for i := range records {
+			r := &records[i]
+			if err := m.Import(r); err != nil {
+				return err
+			}
+			s := m.Stats[r.Event]
+			if s == nil {
+				s = new(migrateStats)
+				m.Stats[r.Event] = s
+			}
+			s.Records++
+			s.Total += r.Count
+		}
+		if err := m.Flush(); err != nil {
+			return err
+		}
+		return done(end)
+	})
+}
+
+// migrateCmd copies events between any two backends.
+//
+// Progress is saved to the checkpoint file after each chunk and a migration resumes from the last saved chunk.
+// Counters of a chunk interrupted before its checkpoint is saved are stored again on resume,
+// smaller chunks limit the duplicates. Events are scanned at the smallest step of the source.
+func migrateCmd(args []string) error {
+	fs := newFlagSet("migrate", "[EVENT...]")
+	var (
+		from   = fs.String("from", "", "Source database configuration URL")
+		to     = fs.String("to", "", "Destination database configuration URL")
+		start  = fs.String("start", "", "Start time (RFC3339, date or UNIX timestamp), defaults to end - 24h")
+		end    = fs.String("end", "", "End time (RFC3339, date or UNIX timestamp), defaults to the start of the current minute")
+		chunk  = fs.Duration("chunk", time.Hour, "Time range migrated at once, a multiple of the source step")
+		cpFile = fs.String("checkpoint", "", "Checkpoint file to save progress and resume from")
+		dryRun = fs.Bool("dry-run", false, "Report counts per event without writing to the destination")
+	)
+	fs.Parse(args)
+	if *from == "" || (*to == "" && !*dryRun) {
+		fs.Usage()
+		return errors.New("Missing -from or -to database")
+	}
+	if *chunk < time.Second {
+		return errors.Errorf("Invalid chunk %s", *chunk)
+	}
+	if *end == "" {
+		// Counters of the running minute are migrated when resuming
+		*end = time.Now().Truncate(time.Minute).Format(time.RFC3339)
+	}
+	tr, err := parseTimeRange(*start, *end)
+	if err != nil {
+		return err
+	}
+	src, err := evdb.Open(*from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	cp := &checkpoint{
+		From:   *from,
+		To:     *to,
+		Events: fs.Args(),
+	}
+	if *cpFile != "" {
+		saved, err := loadCheckpoint(*cpFile)
+		if err != nil {
+			return err
+		}
+		if saved != nil {
+			if saved.From != cp.From || saved.To != cp.To {
+				return errors.Errorf("Checkpoint %s is for migrating %s to %s", *cpFile, saved.From, saved.To)
+			}
+			if len(cp.Events) == 0 {
+				cp.Events = saved.Events
+			}
+			if *start == "" || saved.Done.After(tr.Start) {
+				tr.Start = saved.Done
+			}
+			logInfo.Printf("Resuming migration from %s\n", tr.Start)
+		}
+	}
+	if len(cp.Events) == 0 {
+		if cp.Events = listEvents(src); len(cp.Events) == 0 {
+			return errors.New("No events to migrate")
+		}
+	}
+	var dst evdb.Store = discardStore{}
+	if !*dryRun {
+		db, err := evdb.Open(*to)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		dst = db
+	}
+	m := migration{
+		Events:   cp.Events,
+		Chunk:    *chunk,
+		Step:     sourceStep(src),
+		Importer: evutil.Importer{Store: dst},
+	}
+	if *chunk%m.Step != 0 {
+		return errors.Errorf("Invalid chunk %s, source step is %s", *chunk, m.Step)
+	}
+	startTime := time.Now()
+	err = m.Run(context.Background(), src, tr, func(end time.Time) error {
+		cp.Done = end
+		if *dryRun || *cpFile == "" {
+			return nil
+		}
+		return cp.save(*cpFile)
+	})
+	if err != nil {
+		return errors.Errorf("Migration failed after %s: %w", cp.Done, err)
+	}
+
+	names := make([]string, 0, len(m.Stats))
+	for event := range m.Stats {
+		names = append(names, event)
+	}
+	sort.Strings(names)
+	for _, event := range names {
+		s := m.Stats[event]
+		logInfo.Printf("Event %q: %d records, total count %d\n", event, s.Records, s.Total)
+	}
+	if *dryRun {
+		logInfo.Printf("Dry run found %d records in %d snapshots\n", m.Records, m.Snapshots)
+		return nil
+	}
+	logInfo.Printf("Migrated %d records in %d snapshots up to %s in %s\n", m.Records, m.Snapshots, cp.Done, time.Since(startTime))
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/evutil"
+	"github.com/alxarch/evdb/internal/assert"
+	errors "golang.org/x/xerrors"
+)
+
+var errReadOnly = errors.New("Read only source")
+
+// hourlyScanner is a source that only supports hourly scans with a count of 1 per hour
+type hourlyScanner struct {
+	queries []evdb.Query
+}
+
+func (s *hourlyScanner) Scan(ctx context.Context, queries ...evdb.Query) (evdb.Results, error) {
+	var results evdb.Results
+	for _, q := range queries {
+		if q.Step != time.Hour {
+			return nil, errors.Errorf("Invalid step %s", q.Step)
+		}
+		s.queries = append(s.queries, q)
+		r := evdb.Result{
+			Event:     q.Event,
+			Fields:    evdb.Fields{{Label: "host", Value: "a"}},
+			TimeRange: q.TimeRange,
+		}
+		for tm := q.Start; tm.Before(q.End); tm = tm.Add(q.Step) {
+			r.Data = append(r.Data, evdb.DataPoint{Timestamp: tm.Unix(), Value: 1})
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+func (s *hourlyScanner) MinStep() time.Duration {
+	return time.Hour
+}
+
+func (s *hourlyScanner) Storer(string) (evdb.Storer, error) {
+	return nil, errReadOnly
+}
+
+func (s *hourlyScanner) Close() error {
+	return nil
+}
+
+func TestMigration(t *testing.T) {
+	src := new(hourlyScanner)
+	step := sourceStep(src)
+	assert.Equal(t, step, time.Hour)
+	dst := evutil.NewMemoryStore("foo")
+	m := migration{
+		Events:   []string{"foo"},
+		Chunk:    2 * time.Hour,
+		Step:     step,
+		Importer: evutil.Importer{Store: dst},
+	}
+	start := time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC)
+	tr := evdb.TimeRange{Start: start, End: start.Add(5 * time.Hour)}
+	var done []time.Time
+	err := m.Run(context.Background(), src, tr, func(end time.Time) error {
+		done = append(done, end)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, done, []time.Time{start.Add(2 * time.Hour), start.Add(4 * time.Hour), start.Add(5 * time.Hour)})
+	assert.Equal(t, len(src.queries), 3)
+	assert.Equal(t, m.Stats["foo"].Records, int64(5))
+	assert.Equal(t, m.Stats["foo"].Total, int64(5))
+	assert.Equal(t, m.Snapshots, 5)
+	assert.Equal(t, dst["foo"].Len(), 5)
+	last := dst["foo"].Last()
+	assert.Equal(t, last.Time, start.Add(4*time.Hour))
+	assert.Equal(t, last.Labels, []string{"host"})
+}
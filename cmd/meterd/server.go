@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/evalert"
+	"github.com/alxarch/evdb/evhttp"
+	"github.com/alxarch/evdb/evql"
+	"github.com/alxarch/httperr"
+	errors "golang.org/x/xerrors"
+)
+
+// server applies the reloadable part of the config to HTTP requests and background tasks
+type server struct {
+	db     evdb.DB
+	alerts *evalert.Engine
+
+	mu      sync.RWMutex
+	config  *config
+	limiter *rateLimiter
+}
+
+func newServer(db evdb.DB, c *config) (*server, error) {
+	s := server{db: db}
+	if c.Alerts != nil {
+		store := evalert.FindStateStore(db)
+		if store == nil {
+			logError.Println("DB does not support alert state, alerts are kept in memory")
+		}
+		e, err := evalert.NewEngine(evql.NewExecer(db), store, c.Alerts)
+		if err != nil {
+			return nil, err
+		}
+		s.alerts = e
+	}
+	s.setConfig(c)
+	return &s, nil
+}
+
+func (s *server) currentConfig() (*config, *rateLimiter) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config, s.limiter
+}
+
+func (s *server) setConfig(c *config) {
+	var limiter *rateLimiter
+	if c.RateLimit.RPS > 0 {
+		limiter = newRateLimiter(c.RateLimit.RPS, c.RateLimit.Burst)
+	}
+	s.mu.Lock()
+	s.config, s.limiter = c, limiter
+	s.mu.Unlock()
+}
+
+// Reload applies the reloadable parts of a config
+func (s *server) Reload(c *config) {
+	old, _ := s.currentConfig()
+	if old.restartRequired(c) {
+		logError.Println("Config changes other than auth, rate limits, retention, queries and alert rules require a restart")
+	}
+	if s.alerts != nil && c.Alerts != nil {
+		if err := s.alerts.SetConfig(c.Alerts); err != nil {
+			logError.Printf("Failed to reload alerts: %s\n", err)
+		}
+	}
+	s.setConfig(c)
+	if err := s.saveQueries(); err != nil {
+		logError.Printf("Failed to save queries: %s\n", err)
+	}
+}
+
+// Mux adds the alerts endpoints to h if alerts are enabled
+func (s *server) Mux(h http.Handler) http.Handler {
+	if s.alerts == nil {
+		return h
+	}
+	c, _ := s.currentConfig()
+	mux := http.NewServeMux()
+	mux.Handle("/", h)
+	mux.HandleFunc("/alerts", evhttp.AlertsHandler(s.alerts))
+	mux.HandleFunc("/silences/", evhttp.SilencesHandler(s.alerts, "/silences/", c.ReadOnly))
+	return mux
+}
+
+// runAlerts evaluates alert rules until ctx is done
+func (s *server) runAlerts(ctx context.Context) {
+	if s.alerts != nil {
+		s.alerts.Run(ctx, func(err error) {
+			logError.Println(err)
+		})
+	}
+}
+
+// Handler wraps h with authentication and rate limits, health checks are not limited
+func (s *server) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimSuffix(r.URL.Path, "/") {
+		case "/healthz", "/readyz":
+			h.ServeHTTP(w, r)
+			return
+		}
+		c, limiter := s.currentConfig()
+		if !c.Auth.allow(r) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="meterd"`)
+			httperr.RespondJSON(w, httperr.New(http.StatusUnauthorized, nil))
+			return
+		}
+		if limiter != nil && !limiter.allow(clientAddr(r), time.Now()) {
+			httperr.RespondJSON(w, httperr.New(http.StatusTooManyRequests, nil))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (a *authConfig) allow(r *http.Request) bool {
+	if len(a.Tokens) == 0 && len(a.Users) == 0 {
+		return true
+	}
+	if user, pass, ok := r.BasicAuth(); ok {
+		if want, ok := a.Users[user]; ok {
+			return subtle.ConstantTimeCompare([]byte(pass), []byte(want)) == 1
+		}
+		return false
+	}
+	const bearer = "Bearer "
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, bearer) {
+		token := []byte(strings.TrimPrefix(h, bearer))
+		for _, t := range a.Tokens {
+			if subtle.ConstantTimeCompare(token, []byte(t)) == 1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimiter is a token bucket per client address
+type rateLimiter struct {
+	rps   float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// maxBuckets is the number of tracked clients that triggers removal of full buckets
+const maxBuckets = 10000
+
+func newRateLimiter(rps float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rps:     rps,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (l *rateLimiter) allow(addr string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.buckets[addr]
+	if b == nil {
+		if len(l.buckets) >= maxBuckets {
+			l.prune(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[addr] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rps
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// prune removes buckets that would be full at now
+func (l *rateLimiter) prune(now time.Time) {
+	for addr, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rps >= l.burst {
+			delete(l.buckets, addr)
+		}
+	}
+}
+
+// saveQueries stores the saved queries of the config
+func (s *server) saveQueries() error {
+	c, _ := s.currentConfig()
+	if len(c.Queries) == 0 {
+		return nil
+	}
+	queries := evql.FindQueryStore(s.db)
+	if queries == nil {
+		return errors.New("DB does not support saved queries")
+	}
+	for i := range c.Queries {
+		if err := queries.SaveQuery(&c.Queries[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retainer is implemented by DBs that can delete old data
+type retainer interface {
+	DeleteBefore(ctx context.Context, tm time.Time) (int, error)
+}
+
+func findRetainer(db evdb.DB) retainer {
+	for ; db != nil; db = evdb.Unwrap(db) {
+		if r, ok := db.(retainer); ok {
+			return r
+		}
+	}
+	return nil
+}
+
+// retentionInterval is the interval between deletions of data older than the retention period
+const retentionInterval = time.Hour
+
+// runRetention deletes data older than the configured retention until ctx is done
+func (s *server) runRetention(ctx context.Context) {
+	r := findRetainer(s.db)
+	if r == nil {
+		if c, _ := s.currentConfig(); c.Retention > 0 {
+			logError.Println("DB does not support retention")
+		}
+		return
+	}
+	tick := time.NewTicker(retentionInterval)
+	defer tick.Stop()
+	for {
+		if c, _ := s.currentConfig(); c.Retention > 0 {
+			before := time.Now().Add(-time.Duration(c.Retention))
+			n, err := r.DeleteBefore(ctx, before)
+			if err != nil && ctx.Err() == nil {
+				logError.Printf("Failed to delete data before %s: %s\n", before, err)
+			} else if n > 0 {
+				logInfo.Printf("Deleted %d blocks before %s\n", n, before)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
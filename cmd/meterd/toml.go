@@ -0,0 +1,387 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	errors "golang.org/x/xerrors"
+)
+
+// parseTOML parses the subset of TOML used by config files into JSON encodable values.
+//
+// Supported are tables, arrays of tables, dotted keys, strings, integers, floats, booleans,
+// arrays and inline tables. Dates and times are not.
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	p := tomlParser{s: strings.ReplaceAll(string(data), "\r\n", "\n"), line: 1}
+	root := map[string]interface{}{}
+	table := root
+	for {
+		p.skipSpace(true)
+		if p.pos == len(p.s) {
+			return root, nil
+		}
+		var err error
+		if p.s[p.pos] == '[' {
+			table, err = p.header(root)
+		} else {
+			err = p.keyValue(table)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := p.endOfLine(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type tomlParser struct {
+	s    string
+	pos  int
+	line int
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	return errors.Errorf("TOML line %d: %s", p.line, errors.Errorf(format, args...))
+}
+
+// skipSpace skips spaces and comments and optionally new lines
+func (p *tomlParser) skipSpace(newlines bool) {
+	for p.pos < len(p.s) {
+		switch p.s[p.pos] {
+		case ' ', '\t':
+		case '\n':
+			if !newlines {
+				return
+			}
+			p.line++
+		case '#':
+			for p.pos < len(p.s) && p.s[p.pos] != '\n' {
+				p.pos++
+			}
+			continue
+		default:
+			return
+		}
+		p.pos++
+	}
+}
+
+func (p *tomlParser) endOfLine() error {
+	p.skipSpace(false)
+	if p.pos < len(p.s) && p.s[p.pos] != '\n' {
+		return p.errorf("unexpected %q", p.rest())
+	}
+	return nil
+}
+
+func (p *tomlParser) rest() string {
+	rest := p.s[p.pos:]
+	if i := strings.IndexByte(rest, '\n'); i >= 0 {
+		rest = rest[:i]
+	}
+	return rest
+}
+
+func (p *tomlParser) consume(prefix string) bool {
+	if strings.HasPrefix(p.s[p.pos:], prefix) {
+		p.pos += len(prefix)
+		return true
+	}
+	return false
+}
+
+// header parses a [table] or [[array]] header and returns the table for the following keys
+func (p *tomlParser) header(root map[string]interface{}) (map[string]interface{}, error) {
+	array := p.consume("[[")
+	if !array {
+		p.pos++
+	}
+	p.skipSpace(false)
+	keys, err := p.keys()
+	if err != nil {
+		return nil, err
+	}
+	end := "]"
+	if array {
+		end = "]]"
+	}
+	if p.skipSpace(false); !p.consume(end) {
+		return nil, p.errorf("expected %q", end)
+	}
+	parent, err := p.table(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+	key := keys[len(keys)-1]
+	table := map[string]interface{}{}
+	if !array {
+		switch v := parent[key].(type) {
+		case nil:
+			parent[key] = table
+		case map[string]interface{}:
+			table = v
+		default:
+			return nil, p.errorf("key %q is not a table", key)
+		}
+		return table, nil
+	}
+	switch v := parent[key].(type) {
+	case nil:
+		parent[key] = []interface{}{table}
+	case []interface{}:
+		parent[key] = append(v, table)
+	default:
+		return nil, p.errorf("key %q is not an array of tables", key)
+	}
+	return table, nil
+}
+
+// table returns the table of a dotted key path, creating missing tables.
+// Arrays of tables resolve to their last table.
+func (p *tomlParser) table(t map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for _, key := range keys {
+		switch v := t[key].(type) {
+		case nil:
+			next := map[string]interface{}{}
+			t[key] = next
+			t = next
+		case map[string]interface{}:
+			t = v
+		case []interface{}:
+			last, ok := v[len(v)-1].(map[string]interface{})
+			if !ok {
+				return nil, p.errorf("key %q is not a table", key)
+			}
+			t = last
+		default:
+			return nil, p.errorf("key %q is not a table", key)
+		}
+	}
+	return t, nil
+}
+
+func (p *tomlParser) keyValue(table map[string]interface{}) error {
+	keys, err := p.keys()
+	if err != nil {
+		return err
+	}
+	if p.skipSpace(false); !p.consume("=") {
+		return p.errorf("expected '=' after key")
+	}
+	t, err := p.table(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	key := keys[len(keys)-1]
+	if _, duplicate := t[key]; duplicate {
+		return p.errorf("duplicate key %q", key)
+	}
+	t[key], err = p.value()
+	return err
+}
+
+// keys parses a dotted key
+func (p *tomlParser) keys() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace(false)
+		if p.pos == len(p.s) {
+			return nil, p.errorf("expected a key")
+		}
+		var key string
+		switch c := p.s[p.pos]; {
+		case c == '"' || c == '\'':
+			v, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			key = v
+		default:
+			start := p.pos
+			for p.pos < len(p.s) && isTOMLBareKey(p.s[p.pos]) {
+				p.pos++
+			}
+			if start == p.pos {
+				return nil, p.errorf("invalid key %q", p.rest())
+			}
+			key = p.s[start:p.pos]
+		}
+		keys = append(keys, key)
+		if p.skipSpace(false); !p.consume(".") {
+			return keys, nil
+		}
+	}
+}
+
+func isTOMLBareKey(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) value() (interface{}, error) {
+	p.skipSpace(false)
+	if p.pos == len(p.s) {
+		return nil, p.errorf("missing value")
+	}
+	switch c := p.s[p.pos]; c {
+	case '"', '\'':
+		return p.str()
+	case '[':
+		return p.array()
+	case '{':
+		return p.inlineTable()
+	}
+	start := p.pos
+	for p.pos < len(p.s) && strings.IndexByte(" \t\n#,]}", p.s[p.pos]) < 0 {
+		p.pos++
+	}
+	s := p.s[start:p.pos]
+	switch s {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	num := strings.ReplaceAll(s, "_", "")
+	if n, err := strconv.ParseInt(num, 0, 64); err == nil {
+		return n, nil
+	}
+	if x, err := strconv.ParseFloat(num, 64); err == nil {
+		return x, nil
+	}
+	return nil, p.errorf("invalid value %q", s)
+}
+
+func (p *tomlParser) array() (interface{}, error) {
+	p.pos++
+	arr := []interface{}{}
+	for {
+		if p.skipSpace(true); p.consume("]") {
+			return arr, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, v)
+		if p.skipSpace(true); p.consume("]") {
+			return arr, nil
+		}
+		if !p.consume(",") {
+			return nil, p.errorf("expected ',' or ']' in array")
+		}
+	}
+}
+
+func (p *tomlParser) inlineTable() (interface{}, error) {
+	p.pos++
+	table := map[string]interface{}{}
+	if p.skipSpace(false); p.consume("}") {
+		return table, nil
+	}
+	for {
+		if err := p.keyValue(table); err != nil {
+			return nil, err
+		}
+		p.skipSpace(false)
+		if p.consume("}") {
+			return table, nil
+		}
+		if !p.consume(",") {
+			return nil, p.errorf("expected ',' or '}' in inline table")
+		}
+	}
+}
+
+// str parses basic, literal and multi-line strings
+func (p *tomlParser) str() (string, error) {
+	quote := p.s[p.pos : p.pos+1]
+	if multi := strings.Repeat(quote, 3); p.consume(multi) {
+		// A new line following the opening quotes is trimmed
+		if p.consume("\n") {
+			p.line++
+		}
+		end := strings.Index(p.s[p.pos:], multi)
+		if end < 0 {
+			return "", p.errorf("unterminated string")
+		}
+		s := p.s[p.pos : p.pos+end]
+		p.line += strings.Count(s, "\n")
+		p.pos += end + len(multi)
+		if quote == "'" {
+			return s, nil
+		}
+		return unquoteTOML(s)
+	}
+	p.pos++
+	for i := p.pos; i < len(p.s); i++ {
+		switch c := p.s[i]; {
+		case c == '\n':
+			return "", p.errorf("unterminated string")
+		case c == '\\' && quote == `"`:
+			i++
+		case c == quote[0]:
+			s := p.s[p.pos:i]
+			p.pos = i + 1
+			if quote == "'" {
+				return s, nil
+			}
+			return unquoteTOML(s)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// unquoteTOML replaces the escape sequences of a basic string
+func unquoteTOML(s string) (string, error) {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		if i++; i == len(s) {
+			return "", errors.New("invalid escape at end of string")
+		}
+		switch c := s[i]; c {
+		case 'b':
+			b.WriteByte('\b')
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'f':
+			b.WriteByte('\f')
+		case 'r':
+			b.WriteByte('\r')
+		case '"', '\\':
+			b.WriteByte(c)
+		case 'u', 'U':
+			size := 4
+			if c == 'U' {
+				size = 8
+			}
+			if i+size >= len(s) {
+				return "", errors.Errorf("invalid escape \\%s", s[i:])
+			}
+			r, err := strconv.ParseUint(s[i+1:i+1+size], 16, 32)
+			if err != nil {
+				return "", errors.Errorf("invalid escape \\%s", s[i:i+1+size])
+			}
+			b.WriteRune(rune(r))
+			i += size
+		case '\n', ' ', '\t':
+			// A line ending backslash trims all whitespace up to the next non whitespace character
+			for i+1 < len(s) && strings.IndexByte(" \t\n", s[i+1]) >= 0 {
+				i++
+			}
+		default:
+			return "", errors.Errorf("invalid escape \\%c", c)
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	errors "golang.org/x/xerrors"
+)
+
+// parseYAML parses the subset of YAML used by config files into JSON encodable values.
+//
+// Supported are block mappings and sequences, plain, quoted and block (| and >) scalars,
+// single line flow sequences and mappings and comments. Anchors, tags and multiple documents are not.
+func parseYAML(data []byte) (interface{}, error) {
+	p := yamlParser{lines: strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")}
+	p.skip()
+	if p.n < len(p.lines) && strings.TrimSpace(p.lines[p.n]) == "---" {
+		p.n++
+		p.skip()
+	}
+	if p.n == len(p.lines) {
+		return map[string]interface{}{}, nil
+	}
+	v, err := p.block(p.indent())
+	if err != nil {
+		return nil, err
+	}
+	if p.skip(); p.n < len(p.lines) {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return v, nil
+}
+
+type yamlParser struct {
+	lines []string
+	n     int
+	// item replaces the current line with the content of a sequence item
+	item    string
+	hasItem bool
+}
+
+func (p *yamlParser) errorf(format string, args ...interface{}) error {
+	return errors.Errorf("YAML line %d: %s", p.n+1, errors.Errorf(format, args...))
+}
+
+// skip skips blank and comment lines
+func (p *yamlParser) skip() {
+	if p.hasItem {
+		return
+	}
+	for ; p.n < len(p.lines); p.n++ {
+		if line := strings.TrimSpace(p.lines[p.n]); line != "" && line[0] != '#' {
+			return
+		}
+	}
+}
+
+func (p *yamlParser) line() string {
+	if p.hasItem {
+		return p.item
+	}
+	return p.lines[p.n]
+}
+
+func (p *yamlParser) next() {
+	if p.hasItem {
+		p.hasItem = false
+	}
+	p.n++
+	p.skip()
+}
+
+func (p *yamlParser) indent() int {
+	line := p.line()
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// text returns the current line without indentation and comments
+func (p *yamlParser) text() string {
+	return strings.TrimSpace(stripYAMLComment(p.line()))
+}
+
+func (p *yamlParser) done(indent int) bool {
+	return p.n >= len(p.lines) || p.indent() < indent
+}
+
+func (p *yamlParser) block(indent int) (interface{}, error) {
+	if strings.HasPrefix(p.line()[indent:], "\t") {
+		return nil, p.errorf("tabs are not allowed in indentation")
+	}
+	if isYAMLItem(p.text()) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func isYAMLItem(s string) bool {
+	return s == "-" || strings.HasPrefix(s, "- ")
+}
+
+func (p *yamlParser) sequence(indent int) (interface{}, error) {
+	seq := []interface{}{}
+	for !p.done(indent) {
+		if p.indent() > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		text := p.text()
+		if !isYAMLItem(text) {
+			break
+		}
+		line := p.line()
+		rest := strings.TrimLeft(line[indent+1:], " ")
+		if strings.TrimSpace(stripYAMLComment(rest)) == "" {
+			p.next()
+			if p.done(indent + 1) {
+				seq = append(seq, nil)
+				continue
+			}
+			v, err := p.block(p.indent())
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+			continue
+		}
+		// Parse the item content as a block indented at its column
+		p.item = strings.Repeat(" ", len(line)-len(rest)) + rest
+		p.hasItem = true
+		v, err := p.block(p.indent())
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, v)
+	}
+	return seq, nil
+}
+
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	m := map[string]interface{}{}
+	for !p.done(indent) {
+		if p.indent() > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		text := p.text()
+		if isYAMLItem(text) {
+			break
+		}
+		key, value, ok := splitYAMLKey(text)
+		if !ok {
+			return nil, p.errorf("expected a key: %q", text)
+		}
+		k, err := parseYAMLKey(key)
+		if err != nil {
+			return nil, p.errorf("%s", err)
+		}
+		if _, duplicate := m[k]; duplicate {
+			return nil, p.errorf("duplicate key %q", k)
+		}
+		switch {
+		case value == "":
+			p.next()
+			switch {
+			case !p.done(indent + 1):
+				m[k], err = p.block(p.indent())
+			case !p.done(indent) && p.indent() == indent && isYAMLItem(p.text()):
+				// Sequences can have the indentation of their key
+				m[k], err = p.sequence(indent)
+			default:
+				m[k] = nil
+			}
+		case value[0] == '|' || value[0] == '>':
+			m[k], err = p.blockScalar(indent, value)
+		default:
+			m[k], err = parseYAMLFlow(value)
+			if err != nil {
+				err = p.errorf("%s", err)
+			}
+			p.next()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// blockScalar parses a literal (|) or folded (>) scalar with clip (default) or strip (-) chomping
+func (p *yamlParser) blockScalar(indent int, header string) (string, error) {
+	style, chomp := header[0], header[1:]
+	if chomp != "" && chomp != "-" {
+		return "", p.errorf("unsupported block scalar header %q", header)
+	}
+	p.hasItem = false
+	p.n++
+	var (
+		lines       []string
+		blockIndent = -1
+	)
+	for ; p.n < len(p.lines); p.n++ {
+		line := p.lines[p.n]
+		if strings.TrimSpace(line) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " "))
+		if blockIndent < 0 {
+			blockIndent = n
+		}
+		if n < blockIndent || n <= indent {
+			break
+		}
+		lines = append(lines, line[blockIndent:])
+	}
+	p.skip()
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	var s string
+	if style == '|' {
+		s = strings.Join(lines, "\n")
+	} else {
+		for i, line := range lines {
+			switch {
+			case i == 0:
+			case line == "" || lines[i-1] == "":
+				s += "\n"
+			default:
+				s += " "
+			}
+			s += line
+		}
+	}
+	if chomp == "" && len(lines) > 0 {
+		s += "\n"
+	}
+	return s, nil
+}
+
+// stripYAMLComment removes a comment outside of quotes
+func stripYAMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// splitYAMLKey splits `key: value` at the first colon outside of quotes followed by a space
+func splitYAMLKey(s string) (key, value string, ok bool) {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && i == 0:
+			quote = c
+		case c == ':' && (i+1 == len(s) || s[i+1] == ' '):
+			return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:]), i > 0
+		}
+	}
+	return "", "", false
+}
+
+func parseYAMLKey(s string) (string, error) {
+	v, err := parseYAMLFlow(s)
+	if err != nil {
+		return "", err
+	}
+	if k, ok := v.(string); ok {
+		return k, nil
+	}
+	return s, nil
+}
+
+// parseYAMLFlow parses a single line flow value
+func parseYAMLFlow(s string) (interface{}, error) {
+	f := yamlFlow{s: s}
+	v, err := f.value()
+	if err != nil {
+		return nil, err
+	}
+	if f.skipSpace(); f.pos < len(f.s) {
+		return nil, errors.Errorf("unexpected %q", f.s[f.pos:])
+	}
+	return v, nil
+}
+
+type yamlFlow struct {
+	s     string
+	pos   int
+	depth int
+}
+
+func (f *yamlFlow) skipSpace() {
+	for f.pos < len(f.s) && f.s[f.pos] == ' ' {
+		f.pos++
+	}
+}
+
+func (f *yamlFlow) value() (interface{}, error) {
+	f.skipSpace()
+	if f.pos == len(f.s) {
+		return nil, nil
+	}
+	switch f.s[f.pos] {
+	case '[':
+		return f.sequence()
+	case '{':
+		return f.mapping()
+	case '"', '\'':
+		return f.quoted()
+	default:
+		return f.plain(), nil
+	}
+}
+
+func (f *yamlFlow) sequence() (interface{}, error) {
+	f.pos++
+	f.depth++
+	seq := []interface{}{}
+	for {
+		if f.skipSpace(); f.pos < len(f.s) && f.s[f.pos] == ']' {
+			f.pos++
+			f.depth--
+			return seq, nil
+		}
+		v, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, v)
+		if err := f.separator(']'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (f *yamlFlow) mapping() (interface{}, error) {
+	f.pos++
+	f.depth++
+	m := map[string]interface{}{}
+	for {
+		if f.skipSpace(); f.pos < len(f.s) && f.s[f.pos] == '}' {
+			f.pos++
+			f.depth--
+			return m, nil
+		}
+		k, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			key = fmt.Sprint(k)
+		}
+		if f.skipSpace(); f.pos == len(f.s) || f.s[f.pos] != ':' {
+			return nil, errors.Errorf("missing value for key %q", key)
+		}
+		f.pos++
+		v, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+		if err := f.separator('}'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// separator consumes a comma or stays on the closing bracket
+func (f *yamlFlow) separator(end byte) error {
+	f.skipSpace()
+	switch {
+	case f.pos == len(f.s):
+		return errors.Errorf("missing %q", end)
+	case f.s[f.pos] == ',':
+		f.pos++
+		return nil
+	case f.s[f.pos] == end:
+		return nil
+	default:
+		return errors.Errorf("unexpected %q", f.s[f.pos:])
+	}
+}
+
+func (f *yamlFlow) quoted() (interface{}, error) {
+	quote := f.s[f.pos]
+	for i := f.pos + 1; i < len(f.s); i++ {
+		switch c := f.s[i]; {
+		case c == '\\' && quote == '"':
+			i++
+		case c == quote && quote == '\'' && i+1 < len(f.s) && f.s[i+1] == '\'':
+			i++
+		case c == quote:
+			s := f.s[f.pos : i+1]
+			f.pos = i + 1
+			if quote == '\'' {
+				return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+			}
+			return strconv.Unquote(s)
+		}
+	}
+	return nil, errors.Errorf("unterminated string %s", f.s[f.pos:])
+}
+
+// plain parses a plain scalar ending at the end of input or at a flow indicator inside brackets
+func (f *yamlFlow) plain() interface{} {
+	start := f.pos
+	for ; f.pos < len(f.s); f.pos++ {
+		c := f.s[f.pos]
+		if f.depth == 0 {
+			continue
+		}
+		if c == ',' || c == ']' || c == '}' || (c == ':' && (f.pos+1 == len(f.s) || f.s[f.pos+1] == ' ')) {
+			break
+		}
+	}
+	s := strings.TrimSpace(f.s[start:f.pos])
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n
+	}
+	if x, err := strconv.ParseFloat(s, 64); err == nil && !strings.ContainsAny(s, "xXpPnN_") {
+		return x
+	}
+	return s
+}
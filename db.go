@@ -76,6 +76,18 @@ func (ro *readOnlyDB) Storer(string) (Storer, error) {
 	return nil, errors.Errorf("Readonly DB")
 }
 
+func (ro *readOnlyDB) Unwrap() DB {
+	return ro.DB
+}
+
+// Unwrap returns the DB wrapped by an Option or nil
+func Unwrap(db DB) DB {
+	if w, ok := db.(interface{ Unwrap() DB }); ok {
+		return w.Unwrap()
+	}
+	return nil
+}
+
 // ReadOnly disables the Store interface of a DB
 func ReadOnly() Option {
 	return fnOption(func(db DB) (DB, error) {
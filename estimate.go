@@ -0,0 +1,53 @@
+package evdb
+
+import (
+	"context"
+)
+
+// Estimator is implemented by DBs that can estimate the number of rows a scan query reads
+type Estimator interface {
+	Estimate(ctx context.Context, q *Query) (int64, error)
+}
+
+// BackendEstimate is the number of rows a backend DB reads for a scan query
+type BackendEstimate struct {
+	// Backend names the DB that reads the rows, it is empty for a single DB
+	Backend string `json:"backend"`
+	Rows    int64  `json:"rows"`
+}
+
+// BackendEstimator is implemented by DBs that scan queries from other DBs
+type BackendEstimator interface {
+	EstimateBackends(ctx context.Context, q *Query) ([]BackendEstimate, error)
+}
+
+// EstimateBackends estimates the rows each backend of a DB reads for a scan query.
+// Wrapped DBs are unwrapped until an Estimator or a BackendEstimator is found, DBs without one return no estimates.
+func EstimateBackends(ctx context.Context, db DB, q *Query) ([]BackendEstimate, error) {
+	for ; db != nil; db = Unwrap(db) {
+		switch e := db.(type) {
+		case BackendEstimator:
+			return e.EstimateBackends(ctx, q)
+		case Estimator:
+			n, err := e.Estimate(ctx, q)
+			if err != nil {
+				return nil, err
+			}
+			return []BackendEstimate{{Rows: n}}, nil
+		}
+	}
+	return nil, nil
+}
+
+// PrefixBackends prefixes the backend names of estimates with the name of the DB containing them
+func PrefixBackends(name string, estimates []BackendEstimate) []BackendEstimate {
+	for i := range estimates {
+		e := &estimates[i]
+		if e.Backend == "" {
+			e.Backend = name
+		} else {
+			e.Backend = name + "/" + e.Backend
+		}
+	}
+	return estimates
+}
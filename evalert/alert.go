@@ -0,0 +1,124 @@
+package evalert
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alxarch/evdb"
+	errors "golang.org/x/xerrors"
+)
+
+// AlertStatus is the status of an alert
+type AlertStatus string
+
+// Alert statuses
+const (
+	// StatusPending alerts match the rule condition for less than the rule's For duration
+	StatusPending AlertStatus = "pending"
+	StatusFiring  AlertStatus = "firing"
+	// StatusResolved alerts no longer match the rule condition and are removed once all receivers are notified
+	StatusResolved AlertStatus = "resolved"
+)
+
+// Alert is an alert for a group of fields of a rule result
+type Alert struct {
+	Rule   string      `json:"rule"`
+	Labels evdb.Fields `json:"labels"`
+	Value  float64     `json:"value"`
+	Status AlertStatus `json:"status"`
+	// Silenced is the id of the silence matching the alert
+	Silenced   string    `json:"silenced,omitempty"`
+	ActiveAt   time.Time `json:"activeAt"`
+	FiredAt    time.Time `json:"firedAt"`
+	ResolvedAt time.Time `json:"resolvedAt"`
+	// Notified is the status each receiver was last notified of
+	Notified map[string]AlertStatus `json:"notified,omitempty"`
+}
+
+// clone copies an alert so that it does not share the Notified map
+func (a *Alert) clone() Alert {
+	c := *a
+	if a.Notified != nil {
+		c.Notified = make(map[string]AlertStatus, len(a.Notified))
+		for name, status := range a.Notified {
+			c.Notified[name] = status
+		}
+	}
+	return c
+}
+
+// alertLabels returns the labels of an alert for a rule sample.
+// Labels include the alert name, the event and the result fields.
+func alertLabels(r *Rule, s *sample) evdb.Fields {
+	labels := evdb.Fields{{Label: "alertname", Value: r.Name}}
+	if s.Event != "" {
+		labels = labels.Set("event", s.Event)
+	}
+	for _, f := range s.Fields {
+		labels = labels.Set(f.Label, f.Value)
+	}
+	for label, value := range r.Labels {
+		labels = labels.Set(label, value)
+	}
+	return labels.Sorted()
+}
+
+// Fingerprint identifies alerts of a group
+func (a *Alert) Fingerprint() string {
+	var b strings.Builder
+	b.WriteString(a.Rule)
+	for _, f := range a.Labels {
+		b.WriteByte(0)
+		b.WriteString(f.Label)
+		b.WriteByte('=')
+		b.WriteString(f.Value)
+	}
+	return b.String()
+}
+
+// Silence mutes notifications of matching alerts between StartsAt and EndsAt
+type Silence struct {
+	ID       string           `json:"id"`
+	Matchers evdb.MatchFields `json:"matchers"`
+	StartsAt time.Time        `json:"startsAt"`
+	EndsAt   time.Time        `json:"endsAt"`
+	Comment  string           `json:"comment,omitempty"`
+}
+
+// Validate checks a silence for errors
+func (s *Silence) Validate() error {
+	if len(s.Matchers) == 0 {
+		return errors.New("Silence has no matchers")
+	}
+	if !s.EndsAt.After(s.StartsAt) {
+		return errors.New("Silence ends before it starts")
+	}
+	return nil
+}
+
+// Active checks if a silence is active at tm
+func (s *Silence) Active(tm time.Time) bool {
+	return !tm.Before(s.StartsAt) && tm.Before(s.EndsAt)
+}
+
+// Match checks if a silence matches an alert
+func (s *Silence) Match(a *Alert) bool {
+	return s.Matchers.Match(a.Labels)
+}
+
+func newSilenceID() string {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id[:])
+}
+
+func sortAlerts(alerts []Alert) {
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Fingerprint() < alerts[j].Fingerprint()
+	})
+}
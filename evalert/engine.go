@@ -0,0 +1,391 @@
+package evalert
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alxarch/evdb/evql"
+	errors "golang.org/x/xerrors"
+)
+
+// ErrSilenceNotFound is returned when deleting a silence that does not exist
+var ErrSilenceNotFound = errors.New("Silence not found")
+
+// Engine evaluates alert rules periodically and notifies receivers of firing and resolved alerts.
+//
+// Alerts are deduplicated by rule and labels, receivers are notified once when an alert fires
+// and once when it resolves. Delivery is tracked per receiver so that failed receivers are retried
+// on the next evaluation without notifying the others again. Silences mute firing notifications of matching alerts.
+type Engine struct {
+	// Client is the HTTP client for webhooks, http.DefaultClient is used if nil
+	Client *http.Client
+
+	exec  evql.Execer
+	store StateStore
+	// evalMu serializes evaluations
+	evalMu sync.Mutex
+
+	mu       sync.Mutex
+	config   *Config
+	alerts   map[string]*Alert
+	silences []Silence
+}
+
+// NewEngine creates an Engine restoring alerts and silences from store.
+// If store is nil state is kept in memory.
+func NewEngine(exec evql.Execer, store StateStore, config *Config) (*Engine, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if store == nil {
+		store = new(MemoryStateStore)
+	}
+	state, err := store.LoadAlertState()
+	if err != nil {
+		return nil, errors.Errorf("Failed to load alert state: %w", err)
+	}
+	e := Engine{
+		exec:     exec,
+		store:    store,
+		config:   config,
+		alerts:   make(map[string]*Alert, len(state.Alerts)),
+		silences: state.Silences,
+	}
+	for i := range state.Alerts {
+		a := state.Alerts[i]
+		e.alerts[a.Fingerprint()] = &a
+	}
+	e.dropRemovedRules()
+	return &e, nil
+}
+
+// SetConfig replaces the rules and receivers, alerts of removed rules are dropped
+func (e *Engine) SetConfig(config *Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.config = config
+	e.dropRemovedRules()
+	return nil
+}
+
+func (e *Engine) dropRemovedRules() {
+	for key, a := range e.alerts {
+		if e.config.rule(a.Rule) == nil {
+			delete(e.alerts, key)
+		}
+	}
+}
+
+func (c *Config) rule(name string) *Rule {
+	for i := range c.Rules {
+		if c.Rules[i].Name == name {
+			return &c.Rules[i]
+		}
+	}
+	return nil
+}
+
+// Run evaluates rules every config interval until ctx is done and calls onError with evaluation errors
+func (e *Engine) Run(ctx context.Context, onError func(err error)) {
+	for {
+		e.mu.Lock()
+		interval := time.Duration(e.config.Interval)
+		e.mu.Unlock()
+		if interval == 0 {
+			interval = DefaultInterval
+		}
+		t := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		if err := e.Eval(ctx, time.Now()); err != nil && ctx.Err() == nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// Eval evaluates all rules at now and notifies receivers.
+// Rules that fail to evaluate keep their alerts, the first error is returned.
+func (e *Engine) Eval(ctx context.Context, now time.Time) error {
+	e.evalMu.Lock()
+	defer e.evalMu.Unlock()
+
+	e.mu.Lock()
+	config := e.config
+	e.mu.Unlock()
+
+	var firstErr error
+	setErr := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	results := make(map[string][]sample, len(config.Rules))
+	for i := range config.Rules {
+		r := &config.Rules[i]
+		samples, err := r.Eval(ctx, e.exec, now)
+		if err != nil {
+			setErr(errors.Errorf("Failed to evaluate rule %q: %w", r.Name, err))
+			continue
+		}
+		results[r.Name] = samples
+	}
+
+	e.mu.Lock()
+	e.update(config, results, now)
+	pending := e.pendingNotifications(config)
+	err := e.save()
+	e.mu.Unlock()
+	if err != nil {
+		setErr(err)
+	}
+
+	type delivery struct {
+		key      string
+		receiver string
+		status   AlertStatus
+	}
+	var delivered []delivery
+	for i := range config.Receivers {
+		r := &config.Receivers[i]
+		alerts := pending[r.Name]
+		if len(alerts) == 0 {
+			continue
+		}
+		if err := r.Notify(ctx, e.Client, alerts); err != nil {
+			setErr(errors.Errorf("Failed to notify receiver %q: %w", r.Name, err))
+			continue
+		}
+		for j := range alerts {
+			delivered = append(delivered, delivery{alerts[j].Fingerprint(), r.Name, alerts[j].Status})
+		}
+	}
+	if len(delivered) == 0 {
+		return firstErr
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, d := range delivered {
+		a := e.alerts[d.key]
+		if a == nil || a.Status != d.status {
+			continue
+		}
+		if a.Notified == nil {
+			a.Notified = make(map[string]AlertStatus)
+		}
+		a.Notified[d.receiver] = d.status
+		// Resolved alerts are removed once all receivers are notified
+		if a.Status == StatusResolved && len(pendingReceivers(config, a)) == 0 {
+			delete(e.alerts, d.key)
+		}
+	}
+	if err := e.save(); err != nil {
+		setErr(err)
+	}
+	return firstErr
+}
+
+// update updates alerts with the samples of each evaluated rule
+func (e *Engine) update(config *Config, results map[string][]sample, now time.Time) {
+	active := make(map[string]bool)
+	for i := range config.Rules {
+		r := &config.Rules[i]
+		samples, ok := results[r.Name]
+		if !ok {
+			// Keep alerts of rules that failed to evaluate
+			for key, a := range e.alerts {
+				if a.Rule == r.Name {
+					active[key] = true
+				}
+			}
+			continue
+		}
+		for j := range samples {
+			s := &samples[j]
+			a := Alert{
+				Rule:     r.Name,
+				Labels:   alertLabels(r, s),
+				Status:   StatusPending,
+				ActiveAt: now,
+			}
+			key := a.Fingerprint()
+			active[key] = true
+			if prev := e.alerts[key]; prev != nil {
+				a = *prev
+				// Resolved alerts that have not been removed yet fire again
+				if a.Status == StatusResolved {
+					a.Status, a.ResolvedAt = StatusFiring, time.Time{}
+				}
+			}
+			a.Value = s.Value
+			if a.Status == StatusPending && now.Sub(a.ActiveAt) >= time.Duration(r.For) {
+				a.Status = StatusFiring
+				a.FiredAt = now
+			}
+			e.alerts[key] = &a
+		}
+	}
+	for key, a := range e.alerts {
+		if active[key] {
+			continue
+		}
+		switch a.Status {
+		case StatusPending:
+			delete(e.alerts, key)
+		case StatusFiring:
+			a.Status = StatusResolved
+			a.ResolvedAt = now
+		}
+	}
+	// Remove expired silences
+	silences := e.silences[:0]
+	for _, s := range e.silences {
+		if now.Before(s.EndsAt) {
+			silences = append(silences, s)
+		}
+	}
+	e.silences = silences
+	for _, a := range e.alerts {
+		a.Silenced = ""
+		for i := range e.silences {
+			s := &e.silences[i]
+			if s.Active(now) && s.Match(a) {
+				a.Silenced = s.ID
+				break
+			}
+		}
+	}
+}
+
+// pendingNotifications returns the alerts to notify for each receiver.
+// Resolved alerts without receivers to notify are removed.
+func (e *Engine) pendingNotifications(config *Config) map[string][]Alert {
+	pending := make(map[string][]Alert)
+	for key, a := range e.alerts {
+		receivers := pendingReceivers(config, a)
+		if len(receivers) == 0 && a.Status == StatusResolved {
+			delete(e.alerts, key)
+			continue
+		}
+		for _, name := range receivers {
+			pending[name] = append(pending[name], a.clone())
+		}
+	}
+	for _, alerts := range pending {
+		sortAlerts(alerts)
+	}
+	return pending
+}
+
+// pendingReceivers returns the receivers of an alert's rule that were not notified of its status.
+// Silenced firing alerts are not notified and resolved alerts are only notified to receivers notified as firing.
+func pendingReceivers(config *Config, a *Alert) []string {
+	r := config.rule(a.Rule)
+	if r == nil {
+		return nil
+	}
+	switch a.Status {
+	case StatusFiring:
+		if a.Silenced != "" {
+			return nil
+		}
+	case StatusResolved:
+	default:
+		return nil
+	}
+	receivers := r.Receivers
+	if len(receivers) == 0 {
+		for i := range config.Receivers {
+			receivers = append(receivers, config.Receivers[i].Name)
+		}
+	}
+	var pending []string
+	for _, name := range receivers {
+		switch notified := a.Notified[name]; {
+		case notified == a.Status:
+		case a.Status == StatusResolved && notified != StatusFiring:
+		default:
+			pending = append(pending, name)
+		}
+	}
+	return pending
+}
+
+func (e *Engine) save() error {
+	state := State{
+		Alerts:   e.alertList(),
+		Silences: e.silences,
+	}
+	if err := e.store.SaveAlertState(&state); err != nil {
+		return errors.Errorf("Failed to save alert state: %w", err)
+	}
+	return nil
+}
+
+func (e *Engine) alertList() []Alert {
+	alerts := make([]Alert, 0, len(e.alerts))
+	for _, a := range e.alerts {
+		alerts = append(alerts, a.clone())
+	}
+	sortAlerts(alerts)
+	return alerts
+}
+
+// Alerts returns all pending, firing and resolved alerts
+func (e *Engine) Alerts() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.alertList()
+}
+
+// Silences returns all silences that have not expired
+func (e *Engine) Silences() []Silence {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Silence{}, e.silences...)
+}
+
+// AddSilence adds a silence, a new ID is assigned if s has none
+func (e *Engine) AddSilence(s Silence) (*Silence, error) {
+	if s.StartsAt.IsZero() {
+		s.StartsAt = time.Now()
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	if s.ID == "" {
+		s.ID = newSilenceID()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i := range e.silences {
+		if e.silences[i].ID == s.ID {
+			e.silences[i] = s
+			return &s, e.save()
+		}
+	}
+	e.silences = append(e.silences, s)
+	return &s, e.save()
+}
+
+// DeleteSilence removes a silence
+func (e *Engine) DeleteSilence(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i := range e.silences {
+		if e.silences[i].ID == id {
+			e.silences = append(e.silences[:i], e.silences[i+1:]...)
+			return e.save()
+		}
+	}
+	return ErrSilenceNotFound
+}
@@ -0,0 +1,233 @@
+package evalert_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/evalert"
+	"github.com/alxarch/evdb/events"
+	"github.com/alxarch/evdb/evql"
+	"github.com/alxarch/evdb/evutil"
+	"github.com/alxarch/evdb/internal/assert"
+)
+
+func TestEngine(t *testing.T) {
+	var (
+		notifications []evalert.Notification
+		fail          bool
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var n evalert.Notification
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&n))
+		notifications = append(notifications, n)
+	}))
+	defer srv.Close()
+
+	mem := evutil.NewMemoryStore("errors")
+	// Strip the monotonic clock and location to compare restored alert times
+	now := time.Now().UTC().Round(0)
+	errs, _ := mem.Storer("errors")
+	assert.NoError(t, errs.Store(&evdb.Snapshot{
+		Time:   now.Add(-time.Minute),
+		Labels: []string{"host"},
+		Counters: []events.Counter{
+			{Count: 10, Values: []string{"a"}},
+			{Count: 8, Values: []string{"b"}},
+			{Count: 1, Values: []string{"c"}},
+		},
+	}))
+	config := evalert.Config{
+		Rules: []evalert.Rule{{
+			Name:      "errors",
+			Query:     `errors{}`,
+			Threshold: 5,
+			Reduce:    "sum",
+			Range:     evalert.Duration(time.Hour),
+			For:       evalert.Duration(5 * time.Minute),
+			Labels:    map[string]string{"severity": "page"},
+		}},
+		Receivers: []evalert.Receiver{{Name: "ops", URL: srv.URL}},
+	}
+	store := new(evalert.MemoryStateStore)
+	e, err := evalert.NewEngine(evql.NewExecer(mem), store, &config)
+	assert.NoError(t, err)
+	_, err = e.AddSilence(evalert.Silence{
+		Matchers: evdb.MatchFields{"host": evdb.MatchString("b")},
+		EndsAt:   now.Add(time.Hour),
+	})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	alertStatus := func(e *evalert.Engine) map[string]evalert.AlertStatus {
+		status := make(map[string]evalert.AlertStatus)
+		for _, a := range e.Alerts() {
+			host, _ := a.Labels.Get("host")
+			status[host] = a.Status
+		}
+		return status
+	}
+
+	// Pending until the condition holds for 5m
+	assert.NoError(t, e.Eval(ctx, now))
+	assert.Equal(t, alertStatus(e), map[string]evalert.AlertStatus{"a": "pending", "b": "pending"})
+	assert.Equal(t, len(notifications), 0)
+
+	// Failed notifications are retried
+	fail = true
+	assert.OK(t, e.Eval(ctx, now.Add(5*time.Minute)) != nil, "Notification fails")
+	fail = false
+	assert.NoError(t, e.Eval(ctx, now.Add(6*time.Minute)))
+	assert.Equal(t, alertStatus(e), map[string]evalert.AlertStatus{"a": "firing", "b": "firing"})
+	// Silenced alerts are not notified
+	assert.Equal(t, len(notifications), 1)
+	n := notifications[0]
+	assert.Equal(t, n.Status, evalert.StatusFiring)
+	assert.Equal(t, len(n.Alerts), 1)
+	assert.Equal(t, n.Alerts[0].Labels, evdb.Fields{
+		{Label: "alertname", Value: "errors"},
+		{Label: "event", Value: "errors"},
+		{Label: "host", Value: "a"},
+		{Label: "severity", Value: "page"},
+	})
+	assert.Equal(t, n.Alerts[0].Value, 10.0)
+
+	// Firing alerts are notified once
+	assert.NoError(t, e.Eval(ctx, now.Add(7*time.Minute)))
+	assert.Equal(t, len(notifications), 1)
+
+	// Alert state is restored from the store
+	restored, err := evalert.NewEngine(evql.NewExecer(mem), store, &config)
+	assert.NoError(t, err)
+	assert.Equal(t, restored.Alerts(), e.Alerts())
+	assert.Equal(t, len(restored.Silences()), 1)
+
+	// Alerts resolve once data is out of range
+	assert.NoError(t, restored.Eval(ctx, now.Add(2*time.Hour)))
+	assert.Equal(t, len(notifications), 2)
+	n = notifications[1]
+	assert.Equal(t, n.Status, evalert.StatusResolved)
+	assert.Equal(t, len(n.Alerts), 1)
+	host, _ := n.Alerts[0].Labels.Get("host")
+	assert.Equal(t, host, "a")
+	assert.Equal(t, len(restored.Alerts()), 0)
+	// Expired silences are removed
+	assert.Equal(t, len(restored.Silences()), 0)
+}
+
+func TestEngine_Receivers(t *testing.T) {
+	type webhook struct {
+		fail          bool
+		notifications []evalert.Notification
+	}
+	newWebhook := func(w *webhook) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if w.fail {
+				rw.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			var n evalert.Notification
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&n))
+			w.notifications = append(w.notifications, n)
+		}))
+	}
+	var ok, flaky webhook
+	okSrv, flakySrv := newWebhook(&ok), newWebhook(&flaky)
+	defer okSrv.Close()
+	defer flakySrv.Close()
+
+	mem := evutil.NewMemoryStore("errors")
+	now := time.Now()
+	errs, _ := mem.Storer("errors")
+	assert.NoError(t, errs.Store(&evdb.Snapshot{
+		Time:     now.Add(-time.Minute),
+		Counters: []events.Counter{{Count: 10}},
+	}))
+	config := evalert.Config{
+		Rules: []evalert.Rule{{
+			Name:      "errors",
+			Query:     `errors{}`,
+			Threshold: 5,
+			Reduce:    "sum",
+			Range:     evalert.Duration(time.Hour),
+		}},
+		Receivers: []evalert.Receiver{
+			{Name: "ok", URL: okSrv.URL},
+			{Name: "flaky", URL: flakySrv.URL},
+		},
+	}
+	e, err := evalert.NewEngine(evql.NewExecer(mem), nil, &config)
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	for _, step := range []struct {
+		Name   string
+		Time   time.Time
+		Fail   bool
+		OK     []evalert.AlertStatus
+		Flaky  []evalert.AlertStatus
+		Alerts int
+	}{
+		{"firing fails on flaky", now, true, []evalert.AlertStatus{"firing"}, nil, 1},
+		{"firing is retried on flaky only", now.Add(time.Minute), false, []evalert.AlertStatus{"firing"}, []evalert.AlertStatus{"firing"}, 1},
+		{"resolved is kept until flaky is notified", now.Add(2 * time.Hour), true, []evalert.AlertStatus{"firing", "resolved"}, []evalert.AlertStatus{"firing"}, 1},
+		{"resolved is removed once all receivers are notified", now.Add(3 * time.Hour), false, []evalert.AlertStatus{"firing", "resolved"}, []evalert.AlertStatus{"firing", "resolved"}, 0},
+	} {
+		flaky.fail = step.Fail
+		err := e.Eval(ctx, step.Time)
+		assert.OK(t, (err != nil) == step.Fail, "%s: %v", step.Name, err)
+		for _, tc := range []struct {
+			Webhook *webhook
+			Want    []evalert.AlertStatus
+		}{
+			{&ok, step.OK},
+			{&flaky, step.Flaky},
+		} {
+			var status []evalert.AlertStatus
+			for _, n := range tc.Webhook.notifications {
+				status = append(status, n.Status)
+			}
+			assert.Equal(t, status, tc.Want)
+		}
+		assert.Equal(t, len(e.Alerts()), step.Alerts)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	for _, tc := range []struct {
+		Name   string
+		Config evalert.Config
+		OK     bool
+	}{
+		{"valid", evalert.Config{
+			Rules:     []evalert.Rule{{Name: "foo", Query: `foo{}`, Op: ">=", Receivers: []string{"ops"}}},
+			Receivers: []evalert.Receiver{{Name: "ops", URL: "http://example.org"}},
+		}, true},
+		{"invalid query", evalert.Config{
+			Rules: []evalert.Rule{{Name: "foo", Query: `foo{`}},
+		}, false},
+		{"invalid op", evalert.Config{
+			Rules: []evalert.Rule{{Name: "foo", Query: `foo{}`, Op: "~"}},
+		}, false},
+		{"unknown receiver", evalert.Config{
+			Rules: []evalert.Rule{{Name: "foo", Query: `foo{}`, Receivers: []string{"ops"}}},
+		}, false},
+		{"duplicate rule", evalert.Config{
+			Rules: []evalert.Rule{{Name: "foo", Query: `foo{}`}, {Name: "foo", Query: `bar{}`}},
+		}, false},
+		{"invalid receiver", evalert.Config{
+			Receivers: []evalert.Receiver{{Name: "ops", URL: "ftp://example.org"}},
+		}, false},
+	} {
+		err := tc.Config.Validate()
+		assert.OK(t, (err == nil) == tc.OK, "%s: %v", tc.Name, err)
+	}
+}
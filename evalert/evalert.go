@@ -0,0 +1,144 @@
+// Package evalert evaluates alert rules using evql queries
+package evalert
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/alxarch/evdb"
+	errors "golang.org/x/xerrors"
+)
+
+// Config is the configuration of an alerting Engine
+type Config struct {
+	// Interval is the interval between rule evaluations
+	Interval  Duration   `json:"interval"`
+	Rules     []Rule     `json:"rules"`
+	Receivers []Receiver `json:"receivers"`
+}
+
+// DefaultInterval is the interval between rule evaluations if none is configured
+const DefaultInterval = time.Minute
+
+// Validate checks a config for errors
+func (c *Config) Validate() error {
+	if c.Interval < 0 {
+		return errors.Errorf("Invalid interval %s", c.Interval)
+	}
+	names := make(map[string]bool, len(c.Rules))
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		if err := r.Validate(); err != nil {
+			return err
+		}
+		if names[r.Name] {
+			return errors.Errorf("Duplicate rule %q", r.Name)
+		}
+		names[r.Name] = true
+	}
+	receivers := make(map[string]bool, len(c.Receivers))
+	for i := range c.Receivers {
+		r := &c.Receivers[i]
+		if err := r.Validate(); err != nil {
+			return err
+		}
+		if receivers[r.Name] {
+			return errors.Errorf("Duplicate receiver %q", r.Name)
+		}
+		receivers[r.Name] = true
+	}
+	for i := range c.Rules {
+		for _, name := range c.Rules[i].Receivers {
+			if !receivers[name] {
+				return errors.Errorf("Rule %q has unknown receiver %q", c.Rules[i].Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// Duration is a time.Duration parsed from strings in JSON
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler interface
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler interface
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// State is the persisted state of an Engine
+type State struct {
+	Alerts   []Alert   `json:"alerts"`
+	Silences []Silence `json:"silences"`
+}
+
+// StateStore persists alert state
+type StateStore interface {
+	SaveAlertState(s *State) error
+	// LoadAlertState returns an empty state if no state was saved
+	LoadAlertState() (*State, error)
+}
+
+// FindStateStore returns the StateStore of a DB or of the DBs it wraps
+func FindStateStore(db evdb.DB) StateStore {
+	for db != nil {
+		if s, ok := db.(StateStore); ok {
+			return s
+		}
+		db = evdb.Unwrap(db)
+	}
+	return nil
+}
+
+// MemoryStateStore keeps alert state in memory
+type MemoryStateStore struct {
+	mu    sync.Mutex
+	state []byte
+}
+
+var _ StateStore = (*MemoryStateStore)(nil)
+
+// SaveAlertState implements StateStore interface
+func (m *MemoryStateStore) SaveAlertState(s *State) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.state = data
+	m.mu.Unlock()
+	return nil
+}
+
+// LoadAlertState implements StateStore interface
+func (m *MemoryStateStore) LoadAlertState() (*State, error) {
+	m.mu.Lock()
+	data := m.state
+	m.mu.Unlock()
+	s := new(State)
+	if data == nil {
+		return s, nil
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
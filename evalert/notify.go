@@ -0,0 +1,100 @@
+package evalert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+// Receiver is a webhook notified of firing and resolved alerts
+type Receiver struct {
+	Name    string            `json:"name"`
+	URL     string            `json:"url"`
+	Header  map[string]string `json:"header,omitempty"`
+	Timeout Duration          `json:"timeout,omitempty"`
+}
+
+// defaultNotifyTimeout is the timeout of webhook requests of receivers without a timeout
+const defaultNotifyTimeout = 10 * time.Second
+
+// Validate checks a receiver for errors
+func (r *Receiver) Validate() error {
+	if r.Name == "" {
+		return errors.New("Empty receiver name")
+	}
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return errors.Errorf("Invalid receiver %q URL: %w", r.Name, err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+	default:
+		return errors.Errorf("Invalid receiver %q URL scheme %q", r.Name, u.Scheme)
+	}
+	if r.Timeout < 0 {
+		return errors.Errorf("Invalid receiver %q timeout %s", r.Name, r.Timeout)
+	}
+	return nil
+}
+
+// Notification is the JSON body of webhook requests.
+// Status is firing if any of the alerts is firing, resolved otherwise.
+type Notification struct {
+	Receiver string      `json:"receiver"`
+	Status   AlertStatus `json:"status"`
+	Alerts   []Alert     `json:"alerts"`
+}
+
+// Notify posts a notification to the receiver's webhook
+func (r *Receiver) Notify(ctx context.Context, client *http.Client, alerts []Alert) error {
+	n := Notification{
+		Receiver: r.Name,
+		Status:   StatusResolved,
+		Alerts:   alerts,
+	}
+	for i := range alerts {
+		if alerts[i].Status == StatusFiring {
+			n.Status = StatusFiring
+			break
+		}
+	}
+	body, err := json.Marshal(&n)
+	if err != nil {
+		return err
+	}
+	timeout := time.Duration(r.Timeout)
+	if timeout == 0 {
+		timeout = defaultNotifyTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodPost, r.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range r.Header {
+		req.Header.Set(key, value)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode/100 != 2 {
+		return errors.Errorf("Receiver %q responded with %s", r.Name, res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package evalert
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/evql"
+	errors "golang.org/x/xerrors"
+)
+
+// Rule is an alert rule.
+//
+// The query is executed over the last Range with Step resolution and the data of each
+// result is reduced to a single value that is compared with Threshold.
+// Alerts fire when the condition holds for each evaluation over For.
+type Rule struct {
+	Name      string   `json:"name"`
+	Query     string   `json:"query"`
+	Op        string   `json:"op,omitempty"`
+	Threshold float64  `json:"threshold"`
+	For       Duration `json:"for,omitempty"`
+	Range     Duration `json:"range,omitempty"`
+	Step      Duration `json:"step,omitempty"`
+	// Reduce is one of sum, avg, min, max or last
+	Reduce string `json:"reduce,omitempty"`
+	// Labels are added to the alert labels
+	Labels map[string]string `json:"labels,omitempty"`
+	// Receivers are the names of the receivers notified, all receivers are notified if empty
+	Receivers []string `json:"receivers,omitempty"`
+}
+
+// defaultStep is the step of rules without a step
+const defaultStep = time.Minute
+
+// Validate checks a rule for errors
+func (r *Rule) Validate() error {
+	if r.Name == "" {
+		return errors.New("Empty rule name")
+	}
+	if _, err := evql.Parse(r.Query); err != nil {
+		return errors.Errorf("Invalid rule %q query: %w", r.Name, err)
+	}
+	if _, ok := ops[r.Op]; !ok && r.Op != "" {
+		return errors.Errorf("Invalid rule %q op %q", r.Name, r.Op)
+	}
+	if _, ok := reducers[r.Reduce]; !ok && r.Reduce != "" {
+		return errors.Errorf("Invalid rule %q reduce %q", r.Name, r.Reduce)
+	}
+	if r.For < 0 || r.Range < 0 || r.Step < 0 {
+		return errors.Errorf("Invalid rule %q durations", r.Name)
+	}
+	if r.Step > 0 && r.Step < Duration(time.Second) {
+		return errors.Errorf("Invalid rule %q step %s", r.Name, r.Step)
+	}
+	return nil
+}
+
+// TimeRange returns the time range of a rule evaluation at now
+func (r *Rule) TimeRange(now time.Time) evdb.TimeRange {
+	step := time.Duration(r.Step)
+	if step == 0 {
+		step = defaultStep
+	}
+	window := time.Duration(r.Range)
+	if window < step {
+		window = step
+	}
+	return evdb.TimeRange{
+		Start: now.Add(-window),
+		End:   now,
+		Step:  step,
+	}
+}
+
+// sample is the reduced value of a query result
+type sample struct {
+	Event  string
+	Fields evdb.Fields
+	Value  float64
+}
+
+// Eval executes the rule query and returns the samples matching the condition
+func (r *Rule) Eval(ctx context.Context, exec evql.Execer, now time.Time) ([]sample, error) {
+	rows, err := exec.Exec(ctx, r.TimeRange(now), r.Query)
+	if err != nil {
+		return nil, err
+	}
+	op := ops[r.Op]
+	reduce := reducers[r.Reduce]
+	var samples []sample
+	for _, results := range rows {
+		for i := range results {
+			res := &results[i]
+			v := reduce(res.Data)
+			if math.IsNaN(v) || !op(v, r.Threshold) {
+				continue
+			}
+			samples = append(samples, sample{
+				Event:  res.Event,
+				Fields: res.Fields,
+				Value:  v,
+			})
+		}
+	}
+	return samples, nil
+}
+
+var ops = map[string]func(v, threshold float64) bool{
+	"":   func(v, t float64) bool { return v > t },
+	">":  func(v, t float64) bool { return v > t },
+	">=": func(v, t float64) bool { return v >= t },
+	"<":  func(v, t float64) bool { return v < t },
+	"<=": func(v, t float64) bool { return v <= t },
+	"==": func(v, t float64) bool { return v == t },
+	"!=": func(v, t float64) bool { return v != t },
+}
+
+var reducers = map[string]func(data evdb.DataPoints) float64{
+	"":    lastValue,
+	"sum": func(data evdb.DataPoints) float64 { return data.Sum() },
+	"avg": func(data evdb.DataPoints) float64 { return data.Avg() },
+	"min": func(data evdb.DataPoints) float64 {
+		v := math.NaN()
+		for _, p := range data {
+			if math.IsNaN(v) || p.Value < v {
+				v = p.Value
+			}
+		}
+		return v
+	},
+	"max": func(data evdb.DataPoints) float64 {
+		v := math.NaN()
+		for _, p := range data {
+			if math.IsNaN(v) || p.Value > v {
+				v = p.Value
+			}
+		}
+		return v
+	},
+	"last": lastValue,
+}
+
+func lastValue(data evdb.DataPoints) float64 {
+	if p := data.Last(); p != nil {
+		return p.Value
+	}
+	return math.NaN()
+}
@@ -0,0 +1,47 @@
+package evbadger
+
+import (
+	"encoding/json"
+
+	"github.com/alxarch/evdb/evalert"
+	"github.com/dgraph-io/badger/v2"
+)
+
+// Alert state is stored as JSON under the `[keyVersion, prefixByteAlert]` key
+
+var _ evalert.StateStore = (*DB)(nil)
+
+func alertStateKey() []byte {
+	return []byte{keyVersion, prefixByteAlert}
+}
+
+// SaveAlertState implements evalert.StateStore interface
+func (db *DB) SaveAlertState(s *evalert.State) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return db.badger.Update(func(txn *badger.Txn) error {
+		return txn.Set(alertStateKey(), data)
+	})
+}
+
+// LoadAlertState implements evalert.StateStore interface
+func (db *DB) LoadAlertState() (*evalert.State, error) {
+	s := new(evalert.State)
+	if err := db.badger.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(alertStateKey())
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(v []byte) error {
+			return json.Unmarshal(v, s)
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
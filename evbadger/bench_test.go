@@ -0,0 +1,155 @@
+package evbadger_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/evbadger"
+	"github.com/alxarch/evdb/events"
+	"github.com/dgraph-io/badger/v2"
+)
+
+func openBenchDB(b *testing.B, numEvents, numSnapshots, numHosts int, end time.Time) (*badger.DB, *evbadger.DB, func()) {
+	b.Helper()
+	d, err := ioutil.TempDir("", "evbadger-bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	opts := badger.DefaultOptions
+	opts.Dir = d
+	opts.ValueDir = d
+	db, err := badger.Open(opts)
+	if err != nil {
+		os.RemoveAll(d)
+		b.Fatal("Failed to open badger", err)
+	}
+	edb, err := evbadger.Open(db)
+	if err != nil {
+		db.Close()
+		os.RemoveAll(d)
+		b.Fatal("Failed to open badger store", err)
+	}
+	closeDB := func() {
+		edb.Close()
+		os.RemoveAll(d)
+	}
+	start := end.Add(-time.Duration(numSnapshots) * time.Second)
+	for i := 0; i < numEvents; i++ {
+		st, err := edb.Storer(fmt.Sprintf("bench%d", i))
+		if err != nil {
+			closeDB()
+			b.Fatal(err)
+		}
+		for j := 0; j < numSnapshots; j++ {
+			snap := evdb.Snapshot{
+				Time:   start.Add(time.Duration(j) * time.Second),
+				Labels: []string{"host", "method"},
+			}
+			for h := 0; h < numHosts; h++ {
+				host := fmt.Sprintf("www%d.example.org", h)
+				snap.Counters = append(snap.Counters,
+					events.Counter{Values: []string{host, "GET"}, Count: int64(j)},
+					events.Counter{Values: []string{host, "POST"}, Count: 1},
+				)
+			}
+			if err := st.Store(&snap); err != nil {
+				closeDB()
+				b.Fatal("Failed to store counters", err)
+			}
+		}
+	}
+	return db, edb, closeDB
+}
+
+func BenchmarkDB_Query(b *testing.B) {
+	end := time.Date(2019, time.May, 15, 13, 0, 0, 0, time.UTC)
+	_, edb, closeDB := openBenchDB(b, 3, 20000, 1, end)
+	defer closeDB()
+	ctx := context.Background()
+	for _, rng := range []time.Duration{time.Minute, time.Hour, 24 * time.Hour} {
+		q := evdb.Query{
+			Event: "bench1",
+			TimeRange: evdb.TimeRange{
+				Start: end.Add(-rng),
+				End:   end,
+				Step:  time.Minute,
+			},
+		}
+		b.Run(rng.String(), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				results, err := edb.Query(ctx, &q)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(results) != 2 {
+					b.Fatal("numResults", len(results))
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDB_Estimate(b *testing.B) {
+	end := time.Date(2019, time.May, 15, 13, 0, 0, 0, time.UTC)
+	_, edb, closeDB := openBenchDB(b, 3, 20000, 1, end)
+	defer closeDB()
+	ctx := context.Background()
+	q := evdb.Query{
+		Event: "bench1",
+		TimeRange: evdb.TimeRange{
+			Start: end.Add(-time.Minute),
+			End:   end,
+			Step:  time.Minute,
+		},
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := edb.Estimate(ctx, &q); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDB_QueryMatch queries a single host of a high cardinality event
+func BenchmarkDB_QueryMatch(b *testing.B) {
+	end := time.Date(2019, time.May, 15, 13, 0, 0, 0, time.UTC)
+	db, _, closeDB := openBenchDB(b, 1, 1000, 200, end)
+	defer closeDB()
+	ctx := context.Background()
+	q := evdb.Query{
+		Event: "bench0",
+		TimeRange: evdb.TimeRange{
+			Start: end.Add(-time.Hour),
+			End:   end,
+			Step:  time.Minute,
+		},
+		Fields: evdb.MatchFields{
+			"host": evdb.MatchString("www1.example.org"),
+		},
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Reopen to scan with a cold field cache
+		b.StopTimer()
+		edb, err := evbadger.Open(db)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+		results, err := edb.Query(ctx, &q)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(results) != 2 {
+			b.Fatal("numResults", len(results))
+		}
+	}
+}
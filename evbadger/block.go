@@ -0,0 +1,159 @@
+package evbadger
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"sync"
+
+	errors "golang.org/x/xerrors"
+)
+
+// Snapshot values are stored in columnar blocks:
+//
+//   flags byte | uvarint(numCounters) | ids | counts
+//
+// ids are uvarint deltas of field ids in ascending order and counts are zigzag varints.
+// If flags has blockFlate set ids and counts are flate compressed.
+// Compression is only used for blocks merged by compaction since decompressing
+// each snapshot block is too slow for scans over recent data.
+
+const (
+	blockFlate = 1 << iota
+)
+
+// minFlateSize is the minimum size of block data to try compressing
+const minFlateSize = 256
+
+var errInvalidBlock = errors.New("Invalid value block")
+
+// appendBlock encodes counters in a block, compressing it if it is large enough.
+// Counters are sorted and merged by field id in place.
+func appendBlock(dst []byte, cc compactionBuffer, compress bool) []byte {
+	cc = cc.Compact()
+	data := getBuffer()[:0]
+	defer func() {
+		putBuffer(data)
+	}()
+	var last uint64
+	for i := range cc {
+		data = appendUvarint(data, cc[i].id-last)
+		last = cc[i].id
+	}
+	for i := range cc {
+		data = appendVarint(data, cc[i].n)
+	}
+	flags := byte(0)
+	if compress && len(data) >= minFlateSize {
+		z := getBuffer()[:0]
+		z = flateBlock(z, data)
+		if len(z) < len(data) {
+			flags |= blockFlate
+			putBuffer(data)
+			data = z
+		} else {
+			putBuffer(z)
+		}
+	}
+	dst = append(dst, flags)
+	dst = appendUvarint(dst, uint64(len(cc)))
+	return append(dst, data...)
+}
+
+// blockSize returns the number of counters in a block
+func blockSize(block []byte) (int, error) {
+	if len(block) == 0 {
+		return 0, errInvalidBlock
+	}
+	n, size := binary.Uvarint(block[1:])
+	if size <= 0 {
+		return 0, errInvalidBlock
+	}
+	return int(n), nil
+}
+
+// ReadBlock appends the counters of a block
+func (cc compactionBuffer) ReadBlock(block []byte) (compactionBuffer, error) {
+	n, err := blockSize(block)
+	if err != nil {
+		return cc, err
+	}
+	flags, data := block[0], block[1+uvarintSize(uint64(n)):]
+	if flags&blockFlate != 0 {
+		buf := getBuffer()[:0]
+		defer func() {
+			putBuffer(buf)
+		}()
+		if buf, err = inflateBlock(buf, data); err != nil {
+			return cc, err
+		}
+		data = buf
+	}
+	offset := len(cc)
+	var id uint64
+	for i := 0; i < n; i++ {
+		delta, size := binary.Uvarint(data)
+		if size <= 0 {
+			return cc[:offset], errInvalidBlock
+		}
+		id += delta
+		data = data[size:]
+		cc = append(cc, compactionEntry{id: id})
+	}
+	for i := offset; i < len(cc); i++ {
+		v, size := binary.Varint(data)
+		if size <= 0 {
+			return cc[:offset], errInvalidBlock
+		}
+		cc[i].n = v
+		data = data[size:]
+	}
+	return cc, nil
+}
+
+func appendVarint(dst []byte, n int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	size := binary.PutVarint(buf[:], n)
+	return append(dst, buf[:size]...)
+}
+
+func uvarintSize(n uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], n)
+}
+
+var flateWriters sync.Pool
+
+func flateBlock(dst, data []byte) []byte {
+	buf := bytes.NewBuffer(dst)
+	w, _ := flateWriters.Get().(*flate.Writer)
+	if w == nil {
+		w, _ = flate.NewWriter(buf, flate.BestSpeed)
+	} else {
+		w.Reset(buf)
+	}
+	// Writes to a bytes.Buffer never fail
+	w.Write(data)
+	w.Close()
+	flateWriters.Put(w)
+	return buf.Bytes()
+}
+
+var flateReaders sync.Pool
+
+func inflateBlock(dst, data []byte) ([]byte, error) {
+	src := bytes.NewReader(data)
+	r, _ := flateReaders.Get().(io.ReadCloser)
+	if r == nil {
+		r = flate.NewReader(src)
+	} else if err := r.(flate.Resetter).Reset(src, nil); err != nil {
+		return dst, err
+	}
+	defer flateReaders.Put(r)
+	buf := bytes.NewBuffer(dst)
+	if _, err := buf.ReadFrom(r); err != nil {
+		return dst, errInvalidBlock
+	}
+	return buf.Bytes(), nil
+}
@@ -1,28 +1,28 @@
 package evbadger
 
 import (
+	"context"
 	"encoding/binary"
 	"sort"
 	"sync"
 	"time"
 
-	"github.com/alxarch/evdb/blob"
 	"github.com/dgraph-io/badger/v2"
 )
 
-// Compaction merges event snapshot compacting data to hourly batches
-func (db *DB) Compaction(now time.Time) error {
+// Compaction merges event snapshot compacting data to hourly batches.
+// Compaction stops once ctx is done, batches compacted up to that point are kept.
+func (db *DB) Compaction(ctx context.Context, now time.Time) error {
 	var (
 		wg   sync.WaitGroup
 		errc = make(chan error, len(db.events))
-		gc   *badger.DB
 	)
 	for event := range db.events {
 		b := db.events[event]
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			errc <- compactionScan(db.badger, b.id, now)
+			errc <- compactionScan(ctx, db.badger, &db.writer, b.id, now)
 		}()
 	}
 	wg.Wait()
@@ -32,10 +32,7 @@ func (db *DB) Compaction(now time.Time) error {
 			return err
 		}
 	}
-	if gc == nil {
-		return nil
-	}
-	return gc.RunValueLogGC(0.5)
+	return nil
 }
 
 type compactionEntry struct {
@@ -56,6 +53,7 @@ func (cc compactionBuffer) Less(i, j int) bool {
 	return cc[i].id < cc[j].id
 }
 
+// Read appends counters stored in the legacy format of 16-byte (id, count) pairs
 func (cc compactionBuffer) Read(value []byte) compactionBuffer {
 	for tail := value; len(tail) >= 16; tail = tail[16:] {
 		id := binary.BigEndian.Uint64(tail)
@@ -88,8 +86,8 @@ func (cc compactionBuffer) Compact() compactionBuffer {
 			last.n += c.n
 			continue
 		}
-		last = c
 		cc[j] = *c
+		last = &cc[j]
 		j++
 	}
 	return cc[:j]
@@ -99,98 +97,108 @@ func (cc compactionBuffer) Reset() compactionBuffer {
 	return cc[:0]
 }
 
-func (cc compactionBuffer) AppendBlob(s []byte) ([]byte, error) {
-	for i := range cc {
-		c := &cc[i]
-		s = blob.WriteU64BE(s, c.id)
-		s = blob.WriteU64BE(s, uint64(c.n))
+func compactionScan(ctx context.Context, db *badger.DB, w *blockWriter, id eventID, now time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
-	return s, nil
-}
-
-func compactionScan(db *badger.DB, id eventID, now time.Time) error {
 	txn := db.NewTransaction(false)
 	defer txn.Discard()
-	iter := txn.NewIterator(badger.IteratorOptions{})
+	iter := newPrefixIterator(txn, eventPrefix(id), false)
 	defer iter.Close()
-	seekEvent(iter, id, time.Time{})
-	if !iter.Valid() {
-		return nil
-	}
-	key := iter.Item().Key()
-	ts, ok := parseEventKey(id, key)
-	const step = int64(time.Hour)
-	// Truncate timestamp to step
-	ts -= -ts % step
-
+	// Seeking to the zero time would skip all keys since its Unix timestamp is negative
+	iter.Rewind()
+	const step = int64(time.Hour / time.Second)
 	max := now.Truncate(time.Hour).Add(-1 * time.Hour).Unix()
-	for start, end, n := ts, ts+step, 0; ok && start < max; start, end, n = end, start+step, 0 {
+	for iter.Valid() {
+		ts, ok := parseEventKey(id, iter.Item().Key())
+		if !ok {
+			break
+		}
+		// Truncate timestamp to step
+		start := ts - ts%step
+		if start >= max {
+			break
+		}
+		end, n := start+step, 0
 		for ; iter.Valid(); iter.Next() {
-			key = iter.Item().Key()
-			ts, ok = parseEventKey(id, key)
-			if ok && start < ts && ts < end {
-				n++
-			} else if start == ts {
-				continue
-			} else {
+			ts, ok = parseEventKey(id, iter.Item().Key())
+			if !ok || ts >= end {
 				break
 			}
+			n++
+		}
+		if err := ctx.Err(); err != nil {
+			return err
 		}
-		if n > 0 {
-			err := compactionTask(db, id, start, end)
-			if err != nil {
+		// Batches with a single block are already compacted
+		if n > 1 {
+			if err := compactionTask(db, w, id, start, end); err != nil {
 				return err
 			}
 		}
 	}
 	return nil
-
 }
 
-func compactionTask(db *badger.DB, id eventID, start, end int64) error {
-	txn := db.NewTransaction(true)
-	defer txn.Discard()
-	opt := badger.DefaultIteratorOptions
-	iter := txn.NewIterator(opt)
-	defer iter.Close()
-	seek := eventKey(id, start)
+// compactionTask merges the blocks of a batch, retrying on conflicts with other writes like blockWriter
+func compactionTask(db *badger.DB, w *blockWriter, id eventID, start, end int64) error {
 	cc := getCompactionBuffer()
-	defer putCompactionBuffer(cc)
-
-	for iter.Seek(seek[:]); iter.Valid(); iter.Next() {
-		item := iter.Item()
-		key := item.Key()
-		ts, ok := parseEventKey(id, key)
-		if !ok || ts >= end {
-			break
-		}
-		err := item.Value(func(v []byte) error {
-			cc = cc.Read(v)
-			return nil
-
-		})
+	defer func() {
+		putCompactionBuffer(cc)
+	}()
+	return w.retry(func() error {
+		txn := db.NewTransaction(true)
+		defer txn.Discard()
+		var (
+			keys [][]byte
+			err  error
+		)
+		cc, keys, err = readBatch(txn, cc.Reset(), id, start, end)
 		if err != nil {
 			return err
 		}
-		if ts > start {
+		if len(keys) < 2 {
+			return nil
+		}
+		for _, key := range keys {
 			if err := txn.Delete(key); err != nil {
 				return err
 			}
 		}
+		// Blocks are merged into the first block of the batch
+		value := appendBlock(getBuffer()[:0], cc, true)
+		defer putBuffer(value)
+		if err := txn.Set(blockKey(id, start, 0, 0), value); err != nil {
+			return err
+		}
+		return txn.Commit()
+	})
+}
+
+// readBatch reads all blocks in [start, end)
+func readBatch(txn *badger.Txn, cc compactionBuffer, id eventID, start, end int64) (compactionBuffer, [][]byte, error) {
+	iter := newPrefixIterator(txn, eventPrefix(id), true)
+	defer iter.Close()
+	seek := eventKey(id, start)
+	var keys [][]byte
+	for iter.Seek(seek[:]); iter.Valid(); iter.Next() {
+		item := iter.Item()
+		ts, ok := parseEventKey(id, item.Key())
+		if !ok || ts >= end {
+			break
+		}
 		if ts < start {
 			panic("Invalid seek")
 		}
-	}
-	cc = cc.Compact()
-	if len(cc) > 0 {
-		value := getBuffer()
-		value, _ = cc.AppendBlob(value[:0])
-		defer putBuffer(value)
-		if err := txn.Set(seek[:], value); err != nil {
+		err := item.Value(func(v []byte) error {
+			var err error
+			cc, err = cc.ReadBlock(v)
 			return err
+		})
+		if err != nil {
+			return cc, nil, err
 		}
-		return txn.Commit()
+		keys = append(keys, item.KeyCopy(nil))
 	}
-	return nil
-
+	return cc, keys, nil
 }
@@ -7,6 +7,7 @@ import (
 	"io"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/alxarch/evdb/internal/misc"
@@ -24,26 +25,58 @@ type DB struct {
 	badger *badger.DB
 	mu     sync.RWMutex
 	events map[string]*eventDB
+	writer blockWriter
+
+	// MaxScanKeys limits the number of keys a single query can read, zero means no limit
+	MaxScanKeys int
+	// Dir is the directory checked for free space by Health, empty disables the check
+	Dir string
+	// MinFreeSpace is the minimum free space in bytes in Dir for the DB to be healthy
+	MinFreeSpace int64
+
+	closed int32
 }
 
 var _ evdb.DB = (*DB)(nil)
+var _ evdb.Estimator = (*DB)(nil)
+var _ evdb.QueryStore = (*DB)(nil)
 
-// Open opens a new Event collection stored in BadgerDB
+// Open opens a new Event collection stored in BadgerDB.
+// It returns ErrLegacyFormat if the DB needs to be migrated to the current storage format.
 func Open(b *badger.DB) (*DB, error) {
+	legacy, err := hasLegacyKeys(b)
+	if err != nil {
+		return nil, err
+	}
+	if legacy {
+		return nil, ErrLegacyFormat
+	}
 	eventIDs, err := loadEventIDs(b)
 	if err != nil {
 		return nil, err
 	}
+	writerID, err := nextWriterID(b)
+	if err != nil {
+		return nil, err
+	}
 	db := DB{
 		badger: b,
 		events: make(map[string]*eventDB, len(eventIDs)),
+		writer: blockWriter{id: writerID},
 	}
-	db.Scanner = evdb.NewScanner(&db)
+	// DB embeds Scanner so NewScanner would return DB itself
+	db.Scanner = evdb.NewScanner(evdb.QuerierFunc(db.Query))
 
 	for event, id := range eventIDs {
+		indexed, err := buildIndex(b, id)
+		if err != nil {
+			return nil, err
+		}
 		db.events[event] = &eventDB{
-			badger: b,
-			id:     id,
+			badger:  b,
+			id:      id,
+			indexed: indexed,
+			writer:  &db.writer,
 		}
 	}
 
@@ -67,9 +100,15 @@ func (db *DB) Storer(event string) (evdb.Storer, error) {
 	if !ok {
 		return nil, errors.Errorf("Failed to register event id")
 	}
+	indexed, err := buildIndex(db.badger, id)
+	if err != nil {
+		return nil, err
+	}
 	e := eventDB{
-		badger: db.badger,
-		id:     id,
+		badger:  db.badger,
+		id:      id,
+		indexed: indexed,
+		writer:  &db.writer,
 	}
 
 	db.mu.Lock()
@@ -84,24 +123,59 @@ func (db *DB) Storer(event string) (evdb.Storer, error) {
 	return &e, nil
 }
 
+// Events returns the names of all registered events
+func (db *DB) Events() []string {
+	db.mu.RLock()
+	events := make([]string, 0, len(db.events))
+	for event := range db.events {
+		events = append(events, event)
+	}
+	db.mu.RUnlock()
+	sort.Strings(events)
+	return events
+}
+
 // Query implements evdb.Querier interface
 func (db *DB) Query(ctx context.Context, q *evdb.Query) (evdb.Results, error) {
-	if s, ok := db.events[q.Event]; ok {
-		return s.Query(ctx, q)
+	db.mu.RLock()
+	s, ok := db.events[q.Event]
+	db.mu.RUnlock()
+	if ok {
+		return s.Query(ctx, q, db.MaxScanKeys)
 	}
 	return nil, errors.Errorf("Invalid event %q", q.Event)
 }
 
+// Estimate implements evdb.Estimator interface
+func (db *DB) Estimate(ctx context.Context, q *evdb.Query) (int64, error) {
+	db.mu.RLock()
+	e := db.events[q.Event]
+	db.mu.RUnlock()
+	if e == nil {
+		return 0, nil
+	}
+	return e.Estimate(ctx, q)
+}
+
 // Close implements evdb.DB interface
 func (db *DB) Close() error {
+	atomic.StoreInt32(&db.closed, 1)
 	return db.badger.Close()
 }
 
+// Snapshot keys are `[keyVersion, prefixByteEvent, event, ts, writer, seq]`, see blockWriter
 const (
-	keySize         = 16
-	keyVersion      = 0
-	prefixByteValue = 1
-	prefixByteEvent = 2
+	keySize          = 16
+	eventKeySize     = keySize + 8
+	keyVersion       = 1
+	prefixByteValue  = 1
+	prefixByteEvent  = 2
+	prefixByteQuery  = 3
+	prefixByteIndex  = 4
+	prefixByteWriter = 5
+	prefixByteAlert  = 6
+	prefixByteLabels = 7
+	prefixByteHash   = 8
 )
 
 type keyBuffer [keySize]byte
@@ -128,8 +202,51 @@ func valueKey(event eventID, id uint64) (k keyBuffer) {
 	return k
 }
 
+// Field ids are dense per event starting at 1 so that they delta encode to a byte or two in blocks.
+// Fields are stored under value keys and looked up by the FNV-1a hash of their value under
+// `[keyVersion, prefixByteHash, event, hash, id]` keys with empty values.
+// The `[keyVersion, prefixByteHash, event]` key holds the last field id of the event.
+
+func hashKey(event eventID, h uint32, id uint64) []byte {
+	k := make([]byte, keyPrefixSize+4+8)
+	k[0] = keyVersion
+	k[1] = prefixByteHash
+	binary.BigEndian.PutUint32(k[2:], uint32(event))
+	binary.BigEndian.PutUint32(k[keyPrefixSize:], h)
+	binary.BigEndian.PutUint64(k[keyPrefixSize+4:], id)
+	return k
+}
+
+// hashPrefix is the key prefix of the hash keys of fields with the same hash
+func hashPrefix(event eventID, h uint32) []byte {
+	return hashKey(event, h, 0)[:keyPrefixSize+4]
+}
+
+func lastIDKey(event eventID) []byte {
+	return hashKey(event, 0, 0)[:keyPrefixSize]
+}
+
+// blockKey is the key of a snapshot block at ts
+func blockKey(event eventID, ts int64, writer, seq uint32) []byte {
+	k := eventKey(event, ts)
+	key := make([]byte, eventKeySize)
+	copy(key, k[:])
+	binary.BigEndian.PutUint32(key[keySize:], writer)
+	binary.BigEndian.PutUint32(key[keySize+4:], seq)
+	return key
+}
+
+// registryKey holds the names of registered events
+func registryKey() (k keyBuffer) {
+	k[0] = keyVersion
+	return k
+}
+
 func parseEventKey(e eventID, k []byte) (int64, bool) {
-	p, event, id := parseKey(k)
+	if len(k) <= keySize {
+		return 0, false
+	}
+	p, event, id := parseKey(k[:keySize])
 	return int64(id), p == prefixByteEvent && e == event
 }
 
@@ -145,6 +262,34 @@ func parseKey(k []byte) (byte, eventID, uint64) {
 	return 0, 0, 0
 }
 
+// keyPrefixSize is the size of the key prefix shared by all keys of an event
+const keyPrefixSize = 6
+
+// eventPrefix is the key prefix of all snapshot keys of an event
+func eventPrefix(event eventID) []byte {
+	k := eventKey(event, 0)
+	return k[:keyPrefixSize]
+}
+
+// valuePrefix is the key prefix of all field value keys of an event
+func valuePrefix(event eventID) []byte {
+	k := valueKey(event, 0)
+	return k[:keyPrefixSize]
+}
+
+// newPrefixIterator creates an iterator over keys with prefix.
+// Values are only fetched for items that are read if prefetchValues is false.
+func newPrefixIterator(txn *badger.Txn, prefix []byte, prefetchValues bool) *badger.Iterator {
+	opt := badger.IteratorOptions{
+		Prefix:         prefix,
+		PrefetchValues: prefetchValues,
+	}
+	if prefetchValues {
+		opt.PrefetchSize = badger.DefaultIteratorOptions.PrefetchSize
+	}
+	return txn.NewIterator(opt)
+}
+
 func seekEvent(iter *badger.Iterator, event eventID, tm time.Time) {
 	key := eventKey(event, tm.Unix())
 	iter.Seek(key[:])
@@ -160,11 +305,13 @@ func (db *DB) DumpKeys(w io.Writer) error {
 	return db.badger.View(func(txn *badger.Txn) error {
 		iter := txn.NewIterator(badger.DefaultIteratorOptions)
 		defer iter.Close()
-		var k keyBuffer
 		var fields evdb.Fields
-		for iter.Seek(k[:]); iter.Valid(); iter.Next() {
+		for iter.Seek([]byte{keyVersion}); iter.ValidForPrefix([]byte{keyVersion}); iter.Next() {
 			item := iter.Item()
 			key := item.Key()
+			if len(key) > keySize && key[1] == prefixByteEvent {
+				key = key[:keySize]
+			}
 			switch typ, event, id := parseKey(key); typ {
 			case prefixByteValue:
 				if err := item.Value(fields.UnmarshalBinary); err != nil {
@@ -173,9 +320,12 @@ func (db *DB) DumpKeys(w io.Writer) error {
 				fmt.Fprintf(w, "v event %d field %d value %v\n", event, id, fields)
 			case prefixByteEvent:
 				item.Value(func(v []byte) error {
-					fmt.Fprintf(w, "e event %d field %d size %d\n", event, id, len(v)/16)
+					n, _ := blockSize(v)
+					fmt.Fprintf(w, "e event %d ts %d block %x size %d\n", event, id, item.Key()[keySize:], n)
 					return nil
 				})
+			case prefixByteIndex:
+				fmt.Fprintf(w, "i %x\n", key)
 			default:
 				fmt.Fprintf(w, "? %x\n", key)
 			}
@@ -191,8 +341,7 @@ func (event errMissingEvent) Error() string {
 }
 
 func loadEvents(txn *badger.Txn) ([]string, error) {
-	var key keyBuffer
-	// Zero key holds registered events
+	key := registryKey()
 	itm, err := txn.Get(key[:])
 	if err == badger.ErrKeyNotFound {
 		return nil, nil
@@ -242,8 +391,8 @@ func loadEventIDs(db *badger.DB, events ...string) (map[string]eventID, error) {
 		// Serialize registered event names
 		v := blob.WriteStrings(nil, dbEvents)
 
-		// Store event names at zero key
-		var key keyBuffer
+		// Store event names at registry key
+		key := registryKey()
 		if err := txn.Set(key[:], v); err != nil {
 			return nil, err
 		}
@@ -0,0 +1,34 @@
+package evbadger
+
+import (
+	"testing"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/internal/assert"
+)
+
+// IndexKeyPrefix is the prefix of all field index keys
+var IndexKeyPrefix = []byte{keyVersion, prefixByteIndex}
+
+// LegacyFieldID is the id of the n-th field with the same hash in the legacy storage format
+func LegacyFieldID(data []byte, n uint32) uint64 {
+	return uint64(hashFNVa32(data))<<32 | uint64(n)
+}
+
+func TestLabelSetKey(t *testing.T) {
+	for _, tc := range []struct {
+		Fields evdb.Fields
+		Want   []string
+	}{
+		{nil, nil},
+		{evdb.Fields{{Label: "foo", Value: "bar"}}, []string{"foo"}},
+		{evdb.Fields{{Label: "b", Value: ""}, {Label: "a", Value: "x"}}, []string{"a", "b"}},
+	} {
+		k := labelSetKey(42, tc.Fields)
+		labels, ok := parseLabelSet(nil, k)
+		assert.OK(t, ok, "Invalid label set key %v", k)
+		assert.Equal(t, labels, tc.Want)
+	}
+	_, ok := parseLabelSet(nil, append(labelSetPrefix(42), 5, 'a'))
+	assert.OK(t, !ok, "Truncated label set key")
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package evbadger
+
+// freeSpace returns -1 on platforms without statfs
+func freeSpace(dir string) (int64, error) {
+	return -1, nil
+}
@@ -4,6 +4,7 @@ package evbadger
 import (
 	"log"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/alxarch/evdb"
@@ -18,11 +19,59 @@ func (opener) Open(configURL string) (evdb.DB, error) {
 	if err != nil {
 		return nil, err
 	}
+	maxScanKeys, err := parseMaxScanKeys(configURL)
+	if err != nil {
+		return nil, err
+	}
+	minFreeSpace, err := parseMinFreeSpace(configURL)
+	if err != nil {
+		return nil, err
+	}
 	db, err := badger.Open(options)
 	if err != nil {
 		return nil, err
 	}
-	return Open(db)
+	edb, err := Open(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	edb.MaxScanKeys = maxScanKeys
+	edb.Dir = options.Dir
+	edb.MinFreeSpace = minFreeSpace
+	return edb, nil
+}
+
+func parseMaxScanKeys(configURL string) (int, error) {
+	u, err := url.Parse(configURL)
+	if err != nil {
+		return 0, err
+	}
+	v := u.Query().Get("max-scan-keys")
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, errors.Errorf("Invalid max-scan-keys %q", v)
+	}
+	return n, nil
+}
+
+func parseMinFreeSpace(configURL string) (int64, error) {
+	u, err := url.Parse(configURL)
+	if err != nil {
+		return 0, err
+	}
+	v := u.Query().Get("min-free-space")
+	if v == "" {
+		return defaultMinFreeSpace, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.Errorf("Invalid min-free-space %q", v)
+	}
+	return n, nil
 }
 
 const urlScheme = "badger"
@@ -2,16 +2,24 @@ package evbadger_test
 
 import (
 	"context"
+	"encoding/binary"
 	"fmt"
+	"math"
 	"os"
 	"path"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/blob"
+	"github.com/alxarch/evdb/evalert"
 	"github.com/alxarch/evdb/evbadger"
 	"github.com/alxarch/evdb/events"
+	"github.com/alxarch/evdb/evql"
+	"github.com/alxarch/evdb/internal/assert"
 	"github.com/dgraph-io/badger/v2"
+	errors "golang.org/x/xerrors"
 )
 
 func TestBadgerEvents(t *testing.T) {
@@ -85,5 +93,488 @@ func TestBadgerEvents(t *testing.T) {
 	if len(results) != 3 {
 		t.Fatal("numResults", len(results))
 	}
+	if results, err = edb.Scan(ctx, q); err != nil {
+		t.Fatal("Scan failed", err)
+	}
+	if len(results) != 3 {
+		t.Fatal("Scan numResults", len(results))
+	}
+	n, err := edb.Estimate(ctx, &q)
+	if err != nil {
+		t.Fatal("Estimate failed", err)
+	}
+	if n != 4 {
+		t.Fatal("Estimate", n)
+	}
+	req.Time = tm.Add(time.Hour)
+	if err := st.Store(&req); err != nil {
+		t.Fatal("Failed to store counters", err)
+	}
+	edb.MaxScanKeys = 1
+	if _, err := edb.Query(ctx, &q); !errors.Is(err, evdb.ErrScanLimit) {
+		t.Errorf("Query error = %v, want %v", err, evdb.ErrScanLimit)
+	}
+	edb.MaxScanKeys = 0
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := edb.Query(canceled, &q); err != context.Canceled {
+		t.Errorf("Query error = %v, want %v", err, context.Canceled)
+	}
+	if err := edb.Compaction(canceled, tm.Add(24*time.Hour)); err != context.Canceled {
+		t.Errorf("Compaction error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestSavedQueries(t *testing.T) {
+	d := path.Join(os.TempDir(), fmt.Sprintf("meter-test-%d", time.Now().UnixNano()))
+	if err := os.MkdirAll(d, os.ModeDir|os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	opts := badger.DefaultOptions
+	opts.Dir = d
+	opts.ValueDir = d
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal("Failed to open badger", err)
+	}
+	edb, err := evbadger.Open(db)
+	if err != nil {
+		t.Fatal("Failed to open badger store", err)
+	}
+	defer edb.Close()
+	if _, err := edb.Storer("test"); err != nil {
+		t.Fatal(err)
+	}
+	store := evql.FindQueryStore(edb)
+	if store == nil {
+		t.Fatal("FindQueryStore() nil")
+	}
+	q := evql.SavedQuery{
+		Name:   "by-host",
+		Query:  `test{host: $host}`,
+		Params: []evql.Param{{Name: "host", Value: "www.example.org"}},
+	}
+	assert.NoError(t, store.SaveQuery(&q))
+	assert.NoError(t, store.SaveQuery(&evql.SavedQuery{Name: "all", Query: `test`}))
+	if err := store.SaveQuery(&evql.SavedQuery{Name: "invalid", Query: `test{`}); err == nil {
+		t.Error("SaveQuery() invalid query no error")
+	}
+	loaded, err := store.LoadQuery("by-host")
+	assert.NoError(t, err)
+	assert.Equal(t, loaded, &q)
+	queries, err := store.SavedQueries()
+	assert.NoError(t, err)
+	assert.Equal(t, len(queries), 2)
+	assert.Equal(t, queries[0].Name, "all")
+	assert.NoError(t, store.DeleteQuery("all"))
+	if _, err := store.LoadQuery("all"); err != evql.ErrQueryNotFound {
+		t.Errorf("LoadQuery() error = %v", err)
+	}
+	if err := store.DeleteQuery("all"); err != evql.ErrQueryNotFound {
+		t.Errorf("DeleteQuery() error = %v", err)
+	}
+	// Alert state is stored along saved queries
+	state, err := edb.LoadAlertState()
+	assert.NoError(t, err)
+	assert.Equal(t, state, &evalert.State{})
+	state.Silences = []evalert.Silence{{ID: "foo", Comment: "bar"}}
+	assert.NoError(t, edb.SaveAlertState(state))
+	loadedState, err := edb.LoadAlertState()
+	assert.NoError(t, err)
+	assert.Equal(t, loadedState.Silences[0].Comment, "bar")
+	// Saved queries don't interfere with event keys
+	events, err := evbadger.Open(db)
+	assert.NoError(t, err)
+	_, err = events.Query(context.Background(), &evdb.Query{Event: "test", TimeRange: evdb.TimeRange{Step: time.Second}})
+	assert.NoError(t, err)
+}
+
+func TestFieldIndex(t *testing.T) {
+	d := path.Join(os.TempDir(), fmt.Sprintf("meter-test-%d", time.Now().UnixNano()))
+	if err := os.MkdirAll(d, os.ModeDir|os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	opts := badger.DefaultOptions
+	opts.Dir = d
+	opts.ValueDir = d
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal("Failed to open badger", err)
+	}
+	defer db.Close()
+	edb, err := evbadger.Open(db)
+	if err != nil {
+		t.Fatal("Failed to open badger store", err)
+	}
+	st, err := edb.Storer("test")
+	assert.NoError(t, err)
+	tm := time.Date(2019, time.May, 15, 13, 14, 0, 0, time.UTC)
+	assert.NoError(t, st.Store(&evdb.Snapshot{
+		Time:   tm,
+		Labels: []string{"host", "method"},
+		Counters: []events.Counter{
+			{Values: []string{"example.org", "GET"}, Count: 1},
+			{Values: []string{"example.org", "POST"}, Count: 2},
+			{Values: []string{"example.org.gr", "GET"}, Count: 3},
+			{Values: []string{"example.com", ""}, Count: 4},
+		},
+	}))
+	ctx := context.Background()
+	tr := evdb.TimeRange{
+		Start: tm,
+		End:   tm.Add(time.Second),
+		Step:  time.Second,
+	}
+	// WantMissing is the number of results after storing fields without a host
+	tests := []struct {
+		Name        string
+		Fields      evdb.MatchFields
+		Want        int
+		WantMissing int
+	}{
+		{"all", nil, 4, 5},
+		{"string", evdb.MatchFields{"host": evdb.MatchString("example.org")}, 2, 3},
+		{"any", evdb.MatchFields{"host": evdb.MatchAny("example.org.gr", "example.com")}, 2, 3},
+		{"both", evdb.MatchFields{"host": evdb.MatchString("example.org"), "method": evdb.MatchString("GET")}, 1, 1},
+		{"method", evdb.MatchFields{"method": evdb.MatchString("PUT")}, 0, 1},
+		{"empty", evdb.MatchFields{"method": evdb.MatchString("")}, 1, 1},
+		{"none", evdb.MatchFields{"host": evdb.MatchString("example.net")}, 0, 1},
+		{"present", evdb.MatchFields{"host": evdb.MatchPresent()}, 4, 4},
+		{"unindexed", evdb.MatchFields{"host": evdb.MatchPrefix("example.org")}, 3, 4},
+	}
+	check := func(t *testing.T, edb *evbadger.DB, missing bool) {
+		for _, tc := range tests {
+			results, err := edb.Query(ctx, &evdb.Query{
+				Event:     "test",
+				TimeRange: tr,
+				Fields:    tc.Fields,
+			})
+			assert.NoError(t, err)
+			want := tc.Want
+			if missing {
+				want = tc.WantMissing
+			}
+			if len(results) != want {
+				t.Errorf("%s: numResults %d != %d", tc.Name, len(results), want)
+			}
+		}
+	}
+	check(t, edb, false)
+
+	// Fields missing a label pass ordinary matchers of the label
+	assert.NoError(t, st.Store(&evdb.Snapshot{
+		Time:     tm,
+		Labels:   []string{"method"},
+		Counters: []events.Counter{{Values: []string{"PUT"}, Count: 5}},
+	}))
+	check(t, edb, true)
+
+	// Drop the index and check that it is rebuilt on open
+	indexKeys := func(txn *badger.Txn) (keys [][]byte) {
+		iter := txn.NewIterator(badger.IteratorOptions{Prefix: evbadger.IndexKeyPrefix})
+		defer iter.Close()
+		for iter.Rewind(); iter.Valid(); iter.Next() {
+			keys = append(keys, iter.Item().KeyCopy(nil))
+		}
+		return
+	}
+	var numKeys int
+	assert.NoError(t, db.Update(func(txn *badger.Txn) error {
+		keys := indexKeys(txn)
+		numKeys = len(keys)
+		for _, k := range keys {
+			if err := txn.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	assert.OK(t, numKeys > 0, "No index keys")
+	edb, err = evbadger.Open(db)
+	assert.NoError(t, err)
+	assert.NoError(t, db.View(func(txn *badger.Txn) error {
+		assert.Equal(t, len(indexKeys(txn)), numKeys)
+		return nil
+	}))
+	check(t, edb, true)
+}
+
+func TestMigrate(t *testing.T) {
+	d := path.Join(os.TempDir(), fmt.Sprintf("meter-test-%d", time.Now().UnixNano()))
+	if err := os.MkdirAll(d, os.ModeDir|os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	opts := badger.DefaultOptions
+	opts.Dir = d
+	opts.ValueDir = d
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal("Failed to open badger", err)
+	}
+	defer db.Close()
+
+	// Write keys in the legacy format
+	const numFields = 1000
+	tm := time.Date(2019, time.May, 15, 13, 14, 0, 0, time.UTC)
+	legacyKey := func(prefix byte, n uint64) []byte {
+		k := []byte{0, prefix, 0, 0, 0, 1, 0, 0}
+		return blob.WriteU64BE(k, n)
+	}
+	assert.NoError(t, db.Update(func(txn *badger.Txn) error {
+		if err := txn.Set(make([]byte, 16), blob.WriteStrings(nil, []string{"test"})); err != nil {
+			return err
+		}
+		var snapshot []byte
+		for i := 0; i < numFields; i++ {
+			fields, _ := evdb.Fields{{Label: "host", Value: fmt.Sprintf("www%d.example.org", i)}}.AppendBlob(nil)
+			id := evbadger.LegacyFieldID(fields, 0)
+			if err := txn.Set(legacyKey(1, id), fields); err != nil {
+				return err
+			}
+			snapshot = blob.WriteU64BE(snapshot, id)
+			snapshot = blob.WriteU64BE(snapshot, uint64(i))
+		}
+		return txn.Set(legacyKey(2, uint64(tm.Unix())), snapshot)
+	}))
+	if _, err := evbadger.Open(db); err != evbadger.ErrLegacyFormat {
+		t.Fatalf("Open() error = %v, want %v", err, evbadger.ErrLegacyFormat)
+	}
+	stats, err := evbadger.Migrate(db)
+	assert.NoError(t, err)
+	assert.Equal(t, stats.Keys, numFields+2)
+	assert.Equal(t, stats.Snapshots, 1)
+	if stats.SizeAfter*4 > stats.SizeBefore {
+		t.Errorf("Migrated size %d, legacy size %d", stats.SizeAfter, stats.SizeBefore)
+	}
+	edb, err := evbadger.Open(db)
+	assert.NoError(t, err)
+	ctx := context.Background()
+	q := evdb.Query{
+		Event: "test",
+		TimeRange: evdb.TimeRange{
+			Start: tm,
+			End:   tm.Add(time.Second),
+			Step:  time.Second,
+		},
+		Fields: evdb.MatchFields{
+			"host": evdb.MatchString("www42.example.org"),
+		},
+	}
+	results, err := edb.Query(ctx, &q)
+	assert.NoError(t, err)
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, results[0].Data, evdb.DataPoints{{Timestamp: tm.Unix(), Value: 42}})
+
+	// Snapshots at the same time are appended
+	st, err := edb.Storer("test")
+	assert.NoError(t, err)
+	snap := evdb.Snapshot{
+		Time:     tm,
+		Labels:   []string{"host"},
+		Counters: []events.Counter{{Values: []string{"www42.example.org"}, Count: 8}},
+	}
+	assert.NoError(t, st.Store(&snap))
+	assert.NoError(t, st.Store(&snap))
+	results, err = edb.Query(ctx, &q)
+	assert.NoError(t, err)
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, results[0].Data, evdb.DataPoints{{Timestamp: tm.Unix(), Value: 58}})
+	n, err := edb.Estimate(ctx, &q)
+	assert.NoError(t, err)
+	assert.Equal(t, n, int64(numFields+2))
+
+	// Migrating again is a no-op
+	stats, err = evbadger.Migrate(db)
+	assert.NoError(t, err)
+	assert.Equal(t, stats.Keys, 0)
+}
+
+func TestCompaction(t *testing.T) {
+	d := path.Join(os.TempDir(), fmt.Sprintf("meter-test-%d", time.Now().UnixNano()))
+	if err := os.MkdirAll(d, os.ModeDir|os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	opts := badger.DefaultOptions
+	opts.Dir = d
+	opts.ValueDir = d
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal("Failed to open badger", err)
+	}
+	edb, err := evbadger.Open(db)
+	if err != nil {
+		t.Fatal("Failed to open badger store", err)
+	}
+	defer edb.Close()
+	st, err := edb.Storer("test")
+	assert.NoError(t, err)
+	tm := time.Date(2019, time.May, 15, 13, 0, 0, 0, time.UTC)
+	snap := evdb.Snapshot{Labels: []string{"host"}}
+	for i := 0; i < 100; i++ {
+		snap.Counters = append(snap.Counters, events.Counter{
+			Values: []string{fmt.Sprintf("www%d.example.org", i)},
+			Count:  int64(i),
+		})
+	}
+	for i := 0; i < 3; i++ {
+		snap.Time = tm.Add(time.Duration(i) * time.Minute)
+		assert.NoError(t, st.Store(&snap))
+		snap.Time = tm.Add(time.Duration(i) * time.Hour)
+		assert.NoError(t, st.Store(&snap))
+	}
+	ctx := context.Background()
+	q := evdb.Query{
+		Event: "test",
+		TimeRange: evdb.TimeRange{
+			Start: tm,
+			End:   tm.Add(3 * time.Hour),
+			Step:  time.Hour,
+		},
+		Fields: evdb.MatchFields{"host": evdb.MatchString("www42.example.org")},
+	}
+	want := evdb.DataPoints{
+		{Timestamp: tm.Unix(), Value: 4 * 42},
+		{Timestamp: tm.Add(time.Hour).Unix(), Value: 42},
+		{Timestamp: tm.Add(2 * time.Hour).Unix(), Value: 42},
+	}
+	results, err := edb.Query(ctx, &q)
+	assert.NoError(t, err)
+	assert.Equal(t, results[0].Data, want)
+	n, err := edb.Estimate(ctx, &q)
+	assert.NoError(t, err)
+	assert.Equal(t, n, int64(600))
+
+	assert.NoError(t, edb.Compaction(ctx, tm.Add(3*time.Hour)))
+	results, err = edb.Query(ctx, &q)
+	assert.NoError(t, err)
+	assert.Equal(t, results[0].Data, want)
+	n, err = edb.Estimate(ctx, &q)
+	assert.NoError(t, err)
+	assert.Equal(t, n, int64(300))
+
+	// A block of an event that is not registered
+	orphan := []byte{1, 2, 0, 0, 0, 99, 0, 0}
+	orphan = binary.BigEndian.AppendUint64(orphan, uint64(tm.Unix()))
+	orphan = append(orphan, make([]byte, 8)...)
+	assert.NoError(t, db.Update(func(txn *badger.Txn) error {
+		return txn.Set(orphan, nil)
+	}))
+
+	deleted, err := edb.DeleteBefore(ctx, tm.Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, deleted, 3)
+	results, err = edb.Query(ctx, &q)
+	assert.NoError(t, err)
+	assert.Equal(t, results[0].Data, want[2:])
+}
+
+func TestConcurrentStore(t *testing.T) {
+	d := path.Join(os.TempDir(), fmt.Sprintf("meter-test-%d", time.Now().UnixNano()))
+	if err := os.MkdirAll(d, os.ModeDir|os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	opts := badger.DefaultOptions
+	opts.Dir = d
+	opts.ValueDir = d
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal("Failed to open badger", err)
+	}
+	edb, err := evbadger.Open(db)
+	if err != nil {
+		t.Fatal("Failed to open badger store", err)
+	}
+	defer edb.Close()
+	st, err := edb.Storer("test")
+	assert.NoError(t, err)
+	tm := time.Date(2019, time.May, 15, 13, 14, 0, 0, time.UTC)
+	const numWriters, numWrites = 8, 50
+	var wg sync.WaitGroup
+	errc := make(chan error, numWriters*numWrites)
+	for i := 0; i < numWriters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < numWrites; j++ {
+				errc <- st.Store(&evdb.Snapshot{
+					Time:     tm,
+					Labels:   []string{"host"},
+					Counters: []events.Counter{{Values: []string{"example.org"}, Count: 1}},
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		assert.NoError(t, err)
+	}
+	stats := edb.WriteStats()
+	assert.Equal(t, stats.Blocks, uint64(numWriters*numWrites))
+	assert.Equal(t, stats.Conflicts, uint64(0))
+	assert.Equal(t, stats.Failures, uint64(0))
+	results, err := edb.Query(context.Background(), &evdb.Query{
+		Event: "test",
+		TimeRange: evdb.TimeRange{
+			Start: tm,
+			End:   tm.Add(time.Second),
+			Step:  time.Second,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, results[0].Data, evdb.DataPoints{{Timestamp: tm.Unix(), Value: numWriters * numWrites}})
+
+	// Reopened DBs use a new writer id
+	edb2, err := evbadger.Open(db)
+	assert.NoError(t, err)
+	st2, err := edb2.Storer("test")
+	assert.NoError(t, err)
+	assert.NoError(t, st2.Store(&evdb.Snapshot{
+		Time:     tm,
+		Labels:   []string{"host"},
+		Counters: []events.Counter{{Values: []string{"example.org"}, Count: 1}},
+	}))
+	n, err := edb2.Estimate(context.Background(), &evdb.Query{
+		Event:     "test",
+		TimeRange: evdb.TimeRange{Start: tm, End: tm.Add(time.Second)},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, n, int64(numWriters*numWrites+1))
+}
+
+func TestHealth(t *testing.T) {
+	d := path.Join(os.TempDir(), fmt.Sprintf("meter-test-%d", time.Now().UnixNano()))
+	if err := os.MkdirAll(d, os.ModeDir|os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	db, err := evdb.Open("badger://" + d)
+	if err != nil {
+		t.Fatal("Failed to open badger store", err)
+	}
+	ctx := context.Background()
+	assert.NoError(t, evdb.Health(ctx, db))
+	edb := db.(*evbadger.DB)
+	st, err := edb.Storer("test")
+	assert.NoError(t, err)
+	assert.NoError(t, st.Store(&evdb.Snapshot{
+		Time:     time.Now(),
+		Labels:   []string{"host"},
+		Counters: []events.Counter{{Values: []string{"a"}, Count: 1}},
+	}))
+	stats := edb.Stats()
+	assert.Equal(t, stats.Events, 1)
+	assert.Equal(t, stats.Writes.Blocks, uint64(1))
+	assert.Equal(t, evdb.Stats(db)["badger"], stats)
 
+	edb.MinFreeSpace = math.MaxInt64
+	assert.OK(t, evdb.Health(ctx, db) != nil, "Low free space")
+	edb.MinFreeSpace = 0
+	assert.NoError(t, db.Close())
+	assert.OK(t, evdb.Health(ctx, db) != nil, "Closed DB")
 }
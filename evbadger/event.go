@@ -10,12 +10,16 @@ import (
 	"github.com/alxarch/evdb/events"
 	"github.com/alxarch/evdb/evutil"
 	"github.com/dgraph-io/badger/v2"
+	errors "golang.org/x/xerrors"
 )
 
 type eventDB struct {
 	badger *badger.DB
 	id     eventID
 	fields evutil.FieldCache
+	// indexed is set if the event has a field index
+	indexed bool
+	writer  *blockWriter
 }
 
 func (e *eventDB) Labels() ([]string, error) {
@@ -29,12 +33,15 @@ func (e *eventDB) Store(s *evdb.Snapshot) error {
 
 func (e *eventDB) store(ts int64, labels []string, counters []events.Counter) (err error) {
 	var (
-		cache   = &e.fields
-		index   = newLabelIndex(labels...)
-		scratch [16]byte
-		value   = getBuffer()[:0]
-		buf     = getBuffer()[:0]
+		cache = &e.fields
+		index = newLabelIndex(labels...)
+		cc    = getCompactionBuffer()
+		buf   = getBuffer()[:0]
 	)
+	defer putCompactionBuffer(cc)
+	defer func() {
+		putBuffer(buf)
+	}()
 	for i := range counters {
 		c := &counters[i]
 		buf = index.WriteFields(buf[:0], c.Values)
@@ -42,93 +49,99 @@ func (e *eventDB) store(ts int64, labels []string, counters []events.Counter) (e
 		if !ok {
 			id, err = e.loadID(buf)
 			if err != nil {
-				putBuffer(value)
-				putBuffer(buf)
 				return
 			}
 			cache.SetBlob(id, buf)
 		}
-		binary.BigEndian.PutUint64(scratch[:], id)
-		binary.BigEndian.PutUint64(scratch[8:], uint64(c.Count))
-		value = append(value, scratch[:]...)
+		cc = append(cc, compactionEntry{id, c.Count})
 	}
-	key := eventKey(e.id, ts)
+	value := appendBlock(getBuffer()[:0], cc, false)
+	defer putBuffer(value)
 
-retry:
-	if err = store(e.badger, key[:], value); err == badger.ErrConflict {
-		goto retry
-	}
-	putBuffer(value)
-	putBuffer(buf)
-	return nil
-}
-
-func store(db *badger.DB, key, value []byte) error {
-	txn := db.NewTransaction(true)
-	defer txn.Discard()
-	item, err := txn.Get(key)
-	switch err {
-	case badger.ErrKeyNotFound:
-	case nil:
-		// ValueCopy appends to b[:0] so it's no good
-		item.Value(func(v []byte) error {
-			value = append(value, v...)
-			return nil
-		})
-	default:
-		return err
-	}
-	if err := txn.Set(key, value); err != nil {
-		return err
-	}
-	return txn.Commit()
+	return e.writer.append(e.badger, e.id, ts, value)
 }
 
 func (e *eventDB) loadID(data []byte) (id uint64, err error) {
 	h := hashFNVa32(data)
-	id = uint64(h) << 32 // Shift 0000xxxx to xxxx0000
 	update := func(txn *badger.Txn) error {
-		seek := valueKey(e.id, id)
-		// prefix := seek[:12] // 4 byte prefix + 4 bytes reserved + 4/8 bytes of fnv hash
-		n := uint32(0)
-		iter := txn.NewIterator(badger.DefaultIteratorOptions)
+		prefix := hashPrefix(e.id, h)
+		iter := newPrefixIterator(txn, prefix, false)
 		defer iter.Close()
-		iter.Seek(seek[:])
-		for ; iter.Valid(); iter.Next() {
-			item := iter.Item()
-			vid, ok := parseValueKey(e.id, item.Key())
-			if !ok {
-				break
+		for iter.Rewind(); iter.Valid(); iter.Next() {
+			key := iter.Item().Key()
+			if len(key) != len(prefix)+8 {
+				continue
 			}
-			err := item.Value(func(value []byte) error {
-				if bytes.Equal(value, data) {
-					id = vid
-				}
-				return nil
-			})
+			vid := binary.BigEndian.Uint64(key[len(prefix):])
+			k := valueKey(e.id, vid)
+			item, err := txn.Get(k[:])
 			if err != nil {
 				return err
 			}
-			if id == vid {
+			found := false
+			if err := item.Value(func(value []byte) error {
+				found = bytes.Equal(value, data)
 				return nil
+			}); err != nil {
+				return err
 			}
-			n++
+			if found {
+				id = vid
+				return nil
+			}
+		}
+		// Concurrent inserts conflict on the last id key
+		if id, err = nextFieldID(txn, e.id); err != nil {
+			return err
 		}
-		id = uint64(h)<<32 | uint64(n)
 		key := valueKey(e.id, id)
 		// Need to make a copy of data
 		val := make([]byte, len(data))
 		copy(val, data)
-		return txn.Set(key[:], val)
+		if err := txn.Set(key[:], val); err != nil {
+			return err
+		}
+		if err := txn.Set(hashKey(e.id, h, id), nil); err != nil {
+			return err
+		}
+		var fields evdb.Fields
+		if err := fields.UnmarshalBinary(data); err != nil {
+			return err
+		}
+		return indexFields(txn, e.id, id, fields)
 	}
 
-	const maxRetries = 5
-	for i := 0; i < maxRetries; i++ {
-		if err = e.badger.Update(update); err != badger.ErrConflict {
-			return
+	err = e.writer.retry(func() error {
+		return e.badger.Update(update)
+	})
+	return
+}
+
+// nextFieldID increments the last field id of an event
+func nextFieldID(txn *badger.Txn, event eventID) (uint64, error) {
+	var last uint64
+	key := lastIDKey(event)
+	item, err := txn.Get(key)
+	switch err {
+	case nil:
+		err = item.Value(func(v []byte) error {
+			if len(v) != 8 {
+				return errors.Errorf("Invalid last field id %x", v)
+			}
+			last = binary.BigEndian.Uint64(v)
+			return nil
+		})
+		if err != nil {
+			return 0, err
 		}
+	case badger.ErrKeyNotFound:
+	default:
+		return 0, err
 	}
-	return
+	id := last + 1
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], id)
+	return id, txn.Set(key, buf[:])
 }
 
 func (e *eventDB) Fields(id uint64) (evdb.Fields, error) {
@@ -152,13 +165,19 @@ func (e *eventDB) Fields(id uint64) (evdb.Fields, error) {
 
 type resolver func(uint64) (evdb.Fields, error)
 
-func (e *eventDB) resolver(m evdb.MatchFields) resolver {
+// resolver resolves field ids matching m.
+// If ids is not nil, ids not in it are skipped without a fields lookup.
+func (e *eventDB) resolver(m evdb.MatchFields, ids map[uint64]bool) resolver {
 	cache := make(map[uint64]evdb.Fields)
 	return func(id uint64) (evdb.Fields, error) {
 		fields, ok := cache[id]
 		if ok {
 			return fields, nil
 		}
+		if ids != nil && !ids[id] {
+			cache[id] = nil
+			return nil, nil
+		}
 		fields, err := e.Fields(id)
 		if err != nil {
 			if err != badger.ErrKeyNotFound {
@@ -167,6 +186,9 @@ func (e *eventDB) resolver(m evdb.MatchFields) resolver {
 			fields = nil
 		} else if !m.Match(fields) {
 			fields = nil
+		} else if fields == nil {
+			// nil fields are skipped, counters without fields are not
+			fields = evdb.Fields{}
 		}
 		cache[id] = fields
 		return fields, nil
@@ -175,40 +197,70 @@ func (e *eventDB) resolver(m evdb.MatchFields) resolver {
 
 }
 
-func (e *eventDB) Query(ctx context.Context, q *evdb.Query) (results evdb.Results, err error) {
+// ctxCheckInterval is the number of keys to iterate between context checks
+const ctxCheckInterval = 256
+
+func (e *eventDB) Query(ctx context.Context, q *evdb.Query, maxKeys int) (results evdb.Results, err error) {
 	var (
 		ok         bool
-		resolver   = e.resolver(q.Fields)
+		numKeys    int
+		resolver   resolver
+		cc         = getCompactionBuffer()
 		minT, maxT = q.Start.Unix(), q.End.Unix()
 		step       = fixStep(q.Step)
 		ts         int64
 		scanValue  = func(value []byte) error {
-			var id, n uint64
-			for len(value) >= 16 {
-				id, n, value = binary.BigEndian.Uint64(value), binary.BigEndian.Uint64(value[8:]), value[16:]
-				fields, err := resolver(id)
+			var err error
+			if cc, err = cc[:0].ReadBlock(value); err != nil {
+				return err
+			}
+			for i := range cc {
+				c := &cc[i]
+				fields, err := resolver(c.id)
 				if err != nil {
 					return err
 				}
 				if fields == nil {
 					continue
 				}
-				results = results.Add(q.Event, fields, ts, float64(int64(n)))
+				results = results.Add(q.Event, fields, ts, float64(c.n))
 			}
 			return nil
 		}
 	)
+	defer func() {
+		putCompactionBuffer(cc)
+	}()
 
 	txn := e.badger.NewTransaction(false)
 	defer txn.Discard()
-	iter := txn.NewIterator(badger.DefaultIteratorOptions)
+	var ids map[uint64]bool
+	if e.indexed {
+		if ids, ok = e.matchIDs(txn, q.Fields); ok && len(ids) == 0 {
+			return nil, ctx.Err()
+		}
+	}
+	resolver = e.resolver(q.Fields, ids)
+	// Values are read only for keys in the query's time range
+	iter := newPrefixIterator(txn, eventPrefix(e.id), false)
 	defer iter.Close()
 	seekEvent(iter, e.id, q.Start)
 	for ; iter.Valid(); iter.Next() {
 		item := iter.Item()
 		key := item.Key()
 		ts, ok = parseEventKey(e.id, key)
-		if ok && minT <= ts && ts < maxT {
+		if !ok || ts >= maxT {
+			break
+		}
+		if numKeys++; numKeys%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if 0 < maxKeys && maxKeys < numKeys {
+			return nil, errors.Errorf("Query %q scanned more than %d keys: %w", q.Event, maxKeys, evdb.ErrScanLimit)
+		}
+		if minT <= ts {
 			ts = stepTS(ts, step)
 			err = item.Value(scanValue)
 			if err != nil {
@@ -216,12 +268,63 @@ func (e *eventDB) Query(ctx context.Context, q *evdb.Query) (results evdb.Result
 			}
 		}
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	for i := range results {
 		results[i].TimeRange = q.TimeRange
 	}
 	return
 }
 
+// estimateSampleSize is the number of blocks Estimate reads to find the average size of a counter
+const estimateSampleSize = 64
+
+// Estimate returns the number of counters stored in the query's time range.
+// Only the first blocks are read, the counters of the rest are extrapolated from their size.
+func (e *eventDB) Estimate(ctx context.Context, q *evdb.Query) (int64, error) {
+	var (
+		n           int64
+		numKeys     int
+		sampleBytes int64
+		restBytes   int64
+		maxT        = q.End.Unix()
+	)
+	txn := e.badger.NewTransaction(false)
+	defer txn.Discard()
+	iter := newPrefixIterator(txn, eventPrefix(e.id), false)
+	defer iter.Close()
+	for seekEvent(iter, e.id, q.Start); iter.Valid(); iter.Next() {
+		item := iter.Item()
+		ts, ok := parseEventKey(e.id, item.Key())
+		if !ok || ts >= maxT {
+			break
+		}
+		if numKeys++; numKeys%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+		}
+		if numKeys > estimateSampleSize {
+			restBytes += item.EstimatedSize()
+			continue
+		}
+		sampleBytes += item.EstimatedSize()
+		err := item.Value(func(block []byte) error {
+			size, err := blockSize(block)
+			n += int64(size)
+			return err
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	if restBytes > 0 && sampleBytes > 0 {
+		n += int64(float64(restBytes)*float64(n)/float64(sampleBytes) + 0.5)
+	}
+	return n, ctx.Err()
+}
+
 func fixStep(step time.Duration) int64 {
 	switch {
 	case step >= time.Second:
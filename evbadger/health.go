@@ -0,0 +1,57 @@
+package evbadger
+
+import (
+	"context"
+	"sync/atomic"
+
+	errors "golang.org/x/xerrors"
+)
+
+// defaultMinFreeSpace is the default minimum free disk space of DBs opened from a URL
+const defaultMinFreeSpace = 64 << 20
+
+// Stats are the storage statistics of a DB
+type Stats struct {
+	LSMSize  int64      `json:"lsmSize"`
+	VLogSize int64      `json:"vlogSize"`
+	Events   int        `json:"events"`
+	Writes   WriteStats `json:"writes"`
+}
+
+// Health implements evdb.HealthChecker interface.
+// A DB is unhealthy once closed or if Dir has less than MinFreeSpace bytes free.
+func (db *DB) Health(ctx context.Context) error {
+	if atomic.LoadInt32(&db.closed) == 1 {
+		return errors.New("DB closed")
+	}
+	if db.Dir == "" || db.MinFreeSpace <= 0 {
+		return nil
+	}
+	free, err := freeSpace(db.Dir)
+	if err != nil {
+		return errors.Errorf("Failed to check free space in %s: %w", db.Dir, err)
+	}
+	if 0 <= free && free < db.MinFreeSpace {
+		return errors.Errorf("Low free space in %s: %d < %d bytes", db.Dir, free, db.MinFreeSpace)
+	}
+	return nil
+}
+
+// Stats returns the storage statistics of the DB
+func (db *DB) Stats() Stats {
+	lsm, vlog := db.badger.Size()
+	db.mu.RLock()
+	numEvents := len(db.events)
+	db.mu.RUnlock()
+	return Stats{
+		LSMSize:  lsm,
+		VLogSize: vlog,
+		Events:   numEvents,
+		Writes:   db.WriteStats(),
+	}
+}
+
+// ReportStats implements evdb.StatsReporter interface
+func (db *DB) ReportStats(stats map[string]interface{}) {
+	stats["badger"] = db.Stats()
+}
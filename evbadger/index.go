@@ -0,0 +1,265 @@
+package evbadger
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/alxarch/evdb"
+	"github.com/dgraph-io/badger/v2"
+)
+
+// The field index maps (label, value) pairs to field ids.
+// Index entries are stored with empty values under
+// `[keyVersion, prefixByteIndex, event, uvarint(len(label)), label, value, id]` keys.
+// The `[keyVersion, prefixByteIndex, event]` key marks an event as indexed, its value is the indexVersion.
+//
+// The label sets of the fields of an event are stored with empty values under
+// `[keyVersion, prefixByteLabels, event, uvarint(len(label)), label, ...]` keys.
+// Fields missing a label pass ordinary matchers, so labels are only resolved
+// using the index if all label sets of the event have them.
+
+// indexVersion is incremented when the index changes so that it is rebuilt
+const indexVersion = 1
+
+func indexMarkerKey(event eventID) []byte {
+	k := make([]byte, keyPrefixSize)
+	k[0] = keyVersion
+	k[1] = prefixByteIndex
+	binary.BigEndian.PutUint32(k[2:], uint32(event))
+	return k
+}
+
+func indexPrefix(event eventID, label, value string) []byte {
+	k := make([]byte, keyPrefixSize, keyPrefixSize+binary.MaxVarintLen64+len(label)+len(value)+8)
+	k[0] = keyVersion
+	k[1] = prefixByteIndex
+	binary.BigEndian.PutUint32(k[2:], uint32(event))
+	k = appendUvarint(k, uint64(len(label)))
+	k = append(k, label...)
+	return append(k, value...)
+}
+
+func indexKey(event eventID, label, value string, id uint64) []byte {
+	k := indexPrefix(event, label, value)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], id)
+	return append(k, buf[:]...)
+}
+
+func appendUvarint(dst []byte, n uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	size := binary.PutUvarint(buf[:], n)
+	return append(dst, buf[:size]...)
+}
+
+func labelSetKey(event eventID, fields evdb.Fields) []byte {
+	labels := make([]string, len(fields))
+	for i := range fields {
+		labels[i] = fields[i].Label
+	}
+	sort.Strings(labels)
+	k := make([]byte, keyPrefixSize)
+	k[0] = keyVersion
+	k[1] = prefixByteLabels
+	binary.BigEndian.PutUint32(k[2:], uint32(event))
+	for _, label := range labels {
+		k = appendUvarint(k, uint64(len(label)))
+		k = append(k, label...)
+	}
+	return k
+}
+
+func labelSetPrefix(event eventID) []byte {
+	return labelSetKey(event, nil)
+}
+
+// parseLabelSet appends the labels of a label set key to dst
+func parseLabelSet(dst []string, k []byte) ([]string, bool) {
+	if len(k) < keyPrefixSize {
+		return dst, false
+	}
+	k = k[keyPrefixSize:]
+	for len(k) > 0 {
+		n, size := binary.Uvarint(k)
+		if size <= 0 || uint64(len(k)-size) < n {
+			return dst, false
+		}
+		k = k[size:]
+		dst = append(dst, string(k[:n]))
+		k = k[n:]
+	}
+	return dst, true
+}
+
+// indexFields adds index entries for all non-empty values of fields and their label set
+func indexFields(txn *badger.Txn, event eventID, id uint64, fields evdb.Fields) error {
+	for _, f := range fields {
+		if f.Value == "" {
+			continue
+		}
+		if err := txn.Set(indexKey(event, f.Label, f.Value, id), nil); err != nil {
+			return err
+		}
+	}
+	return txn.Set(labelSetKey(event, fields), nil)
+}
+
+// buildIndex indexes all fields of an event that is not yet indexed or has an index of a previous version.
+// It reports false if the DB is read-only and the event is not indexed.
+func buildIndex(db *badger.DB, event eventID) (bool, error) {
+	marker := indexMarkerKey(event)
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(marker)
+		if err != nil {
+			return err
+		}
+		return item.Value(func(v []byte) error {
+			if len(v) != 1 || v[0] != indexVersion {
+				return badger.ErrKeyNotFound
+			}
+			return nil
+		})
+	})
+	switch err {
+	case nil:
+		return true, nil
+	case badger.ErrKeyNotFound:
+	default:
+		return false, err
+	}
+
+	w := newBatchWriter(db)
+	defer w.Discard()
+	err = db.View(func(txn *badger.Txn) error {
+		iter := newPrefixIterator(txn, valuePrefix(event), true)
+		defer iter.Close()
+		var (
+			fields    evdb.Fields
+			labelSets = make(map[string]bool)
+		)
+		for iter.Rewind(); iter.Valid(); iter.Next() {
+			item := iter.Item()
+			id, ok := parseValueKey(event, item.Key())
+			if !ok {
+				continue
+			}
+			if err := item.Value(fields.UnmarshalBinary); err != nil {
+				return err
+			}
+			for _, f := range fields {
+				if f.Value == "" {
+					continue
+				}
+				if err := w.Set(indexKey(event, f.Label, f.Value, id), nil); err != nil {
+					return err
+				}
+			}
+			if k := labelSetKey(event, fields); !labelSets[string(k)] {
+				labelSets[string(k)] = true
+				if err := w.Set(k, nil); err != nil {
+					return err
+				}
+			}
+			fields = fields[:0]
+		}
+		return nil
+	})
+	if err == nil {
+		err = w.Set(marker, []byte{indexVersion})
+	}
+	if err == nil {
+		err = w.Commit()
+	}
+	if err == badger.ErrReadOnlyTxn {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// indexValues returns the values a matcher accepts if it can be resolved using the index
+func indexValues(m evdb.Matcher) ([]string, bool) {
+	var values []string
+	switch m := m.(type) {
+	case evdb.MatchString:
+		values = []string{string(m)}
+	case evdb.MatchValues:
+		values = m
+	default:
+		return nil, false
+	}
+	for _, v := range values {
+		// Empty values also match missing labels so they are not indexed
+		if v == "" {
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+// commonLabels returns the labels that all label sets of an event have
+func commonLabels(txn *badger.Txn, event eventID) map[string]bool {
+	var (
+		common map[string]bool
+		labels []string
+	)
+	iter := newPrefixIterator(txn, labelSetPrefix(event), false)
+	defer iter.Close()
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		var ok bool
+		if labels, ok = parseLabelSet(labels[:0], iter.Item().Key()); !ok {
+			continue
+		}
+		set := make(map[string]bool, len(labels))
+		for _, label := range labels {
+			if common == nil || common[label] {
+				set[label] = true
+			}
+		}
+		common = set
+	}
+	return common
+}
+
+// matchIDs returns the ids of fields matching all indexed matchers.
+// It reports false if no matcher can be resolved using the index.
+func (e *eventDB) matchIDs(txn *badger.Txn, m evdb.MatchFields) (map[uint64]bool, bool) {
+	var (
+		ids    map[uint64]bool
+		common map[string]bool
+	)
+	for label, matcher := range m {
+		values, ok := indexValues(matcher)
+		if !ok {
+			continue
+		}
+		if common == nil {
+			common = commonLabels(txn, e.id)
+		}
+		if !common[label] {
+			// Fields missing the label match
+			continue
+		}
+		matched := make(map[uint64]bool)
+		for _, v := range values {
+			prefix := indexPrefix(e.id, label, v)
+			iter := newPrefixIterator(txn, prefix, false)
+			for iter.Rewind(); iter.Valid(); iter.Next() {
+				key := iter.Item().Key()
+				if len(key) != len(prefix)+8 {
+					// Key of a longer value with the same prefix
+					continue
+				}
+				id := binary.BigEndian.Uint64(key[len(prefix):])
+				if ids == nil || ids[id] {
+					matched[id] = true
+				}
+			}
+			iter.Close()
+		}
+		ids = matched
+		if len(ids) == 0 {
+			break
+		}
+	}
+	return ids, ids != nil
+}
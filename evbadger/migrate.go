@@ -0,0 +1,164 @@
+package evbadger
+
+import (
+	"github.com/alxarch/evdb/blob"
+	"github.com/dgraph-io/badger/v2"
+	errors "golang.org/x/xerrors"
+)
+
+// FormatVersion is the version of the storage format
+const FormatVersion = keyVersion
+
+// ErrLegacyFormat is returned by Open if the DB has keys in a previous storage format
+var ErrLegacyFormat = errors.New("Legacy storage format, use Migrate to upgrade")
+
+// legacyKeyVersion is the key version of the format storing snapshots as 16-byte (id, count) pairs
+const legacyKeyVersion = 0
+
+// MigrateStats reports the results of a storage format migration
+type MigrateStats struct {
+	Keys       int   `json:"keys"`
+	Snapshots  int   `json:"snapshots"`
+	SizeBefore int64 `json:"sizeBefore"`
+	SizeAfter  int64 `json:"sizeAfter"`
+}
+
+func hasLegacyKeys(db *badger.DB) (bool, error) {
+	found := false
+	err := db.View(func(txn *badger.Txn) error {
+		iter := newPrefixIterator(txn, []byte{legacyKeyVersion}, false)
+		defer iter.Close()
+		iter.Rewind()
+		found = iter.Valid()
+		return nil
+	})
+	return found, err
+}
+
+// Migrate upgrades all keys stored in a legacy format to the current storage format.
+//
+// Snapshots are converted to value blocks, field index keys are dropped and rebuilt on Open.
+// Fields are assigned dense ids in the order of their legacy hashed ids.
+// Legacy keys are removed once all keys are converted so an interrupted migration can be resumed.
+func Migrate(db *badger.DB) (*MigrateStats, error) {
+	var (
+		stats    MigrateStats
+		registry []byte
+		cc       = getCompactionBuffer()
+		// Legacy keys are sorted by prefix so field values are read before snapshots
+		fieldIDs = make(map[eventID]map[uint64]uint64)
+	)
+	defer func() {
+		putCompactionBuffer(cc)
+	}()
+	w := newBatchWriter(db)
+	defer w.Discard()
+	err := db.View(func(txn *badger.Txn) error {
+		iter := newPrefixIterator(txn, []byte{legacyKeyVersion}, true)
+		defer iter.Close()
+		for iter.Rewind(); iter.Valid(); iter.Next() {
+			item := iter.Item()
+			key := item.KeyCopy(nil)
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			stats.Keys++
+			if len(key) < 2 {
+				return errors.Errorf("Invalid legacy key %x", key)
+			}
+			switch key[1] {
+			case 0:
+				// Registered events
+				registry = value
+				continue
+			case prefixByteEvent:
+				if len(key) != keySize {
+					return errors.Errorf("Invalid legacy key %x", key)
+				}
+				_, event, ts := parseKey(append([]byte{keyVersion}, key[1:]...))
+				ids := fieldIDs[event]
+				legacy := cc.Read(value)
+				cc = legacy[:0]
+				for _, c := range legacy {
+					// Counters of fields without values cannot be resolved
+					if id, ok := ids[c.id]; ok {
+						cc = append(cc, compactionEntry{id: id, n: c.n})
+					}
+				}
+				block := appendBlock(nil, cc, false)
+				cc = cc[:0]
+				stats.Snapshots++
+				stats.SizeBefore += int64(len(value))
+				stats.SizeAfter += int64(len(block))
+				if err := w.Set(blockKey(event, int64(ts), 0, 0), block); err != nil {
+					return err
+				}
+			case prefixByteValue:
+				_, event, legacyID := parseKey(append([]byte{keyVersion}, key[1:]...))
+				ids := fieldIDs[event]
+				if ids == nil {
+					ids = make(map[uint64]uint64)
+					fieldIDs[event] = ids
+				}
+				id := uint64(len(ids) + 1)
+				ids[legacyID] = id
+				k := valueKey(event, id)
+				if err := w.Set(k[:], value); err != nil {
+					return err
+				}
+				if err := w.Set(hashKey(event, hashFNVa32(value), id), nil); err != nil {
+					return err
+				}
+			case prefixByteQuery:
+				key[0] = keyVersion
+				if err := w.Set(key, value); err != nil {
+					return err
+				}
+			case prefixByteIndex:
+				// Index is rebuilt on Open
+			default:
+				return errors.Errorf("Invalid legacy key %x", key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for event, ids := range fieldIDs {
+		last := blob.WriteU64BE(nil, uint64(len(ids)))
+		if err := w.Set(lastIDKey(event), last); err != nil {
+			return nil, err
+		}
+	}
+	if registry != nil {
+		key := registryKey()
+		if err := w.Set(key[:], registry); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Commit(); err != nil {
+		return nil, err
+	}
+
+	d := newBatchWriter(db)
+	defer d.Discard()
+	err = db.View(func(txn *badger.Txn) error {
+		iter := newPrefixIterator(txn, []byte{legacyKeyVersion}, false)
+		defer iter.Close()
+		for iter.Rewind(); iter.Valid(); iter.Next() {
+			if err := d.Delete(iter.Item().KeyCopy(nil)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := d.Commit(); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
@@ -0,0 +1,77 @@
+package evbadger
+
+import (
+	"github.com/alxarch/evdb"
+	"github.com/dgraph-io/badger/v2"
+)
+
+// Saved queries are stored as JSON under `[keyVersion, prefixByteQuery, name...]` keys
+
+func queryKey(name string) []byte {
+	k := make([]byte, 2, 2+len(name))
+	k[0] = keyVersion
+	k[1] = prefixByteQuery
+	return append(k, name...)
+}
+
+// PutQuery implements evdb.QueryStore interface
+func (db *DB) PutQuery(name string, doc []byte) error {
+	return db.badger.Update(func(txn *badger.Txn) error {
+		return txn.Set(queryKey(name), doc)
+	})
+}
+
+// GetQuery implements evdb.QueryStore interface
+func (db *DB) GetQuery(name string) ([]byte, error) {
+	var doc []byte
+	if err := db.badger.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(queryKey(name))
+		if err == badger.ErrKeyNotFound {
+			return evdb.ErrQueryNotFound
+		}
+		if err != nil {
+			return err
+		}
+		doc, err = item.ValueCopy(nil)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// DeleteQuery implements evdb.QueryStore interface
+func (db *DB) DeleteQuery(name string) error {
+	return db.badger.Update(func(txn *badger.Txn) error {
+		key := queryKey(name)
+		if _, err := txn.Get(key); err == badger.ErrKeyNotFound {
+			return evdb.ErrQueryNotFound
+		} else if err != nil {
+			return err
+		}
+		return txn.Delete(key)
+	})
+}
+
+// AllQueries implements evdb.QueryStore interface
+func (db *DB) AllQueries() ([][]byte, error) {
+	var docs [][]byte
+	err := db.badger.View(func(txn *badger.Txn) error {
+		prefix := queryKey("")
+		iter := txn.NewIterator(badger.IteratorOptions{
+			PrefetchValues: true,
+			PrefetchSize:   100,
+			Prefix:         prefix,
+		})
+		defer iter.Close()
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			doc, err := iter.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			docs = append(docs, doc)
+		}
+		return nil
+	})
+	return docs, err
+}
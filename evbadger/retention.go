@@ -0,0 +1,62 @@
+package evbadger
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+)
+
+// DeleteBefore deletes all snapshot blocks stored before tm and returns the number of deleted blocks.
+// Blocks of all events stored in the database are deleted, not only the events opened by db.
+// Field values and the field index are kept.
+func (db *DB) DeleteBefore(ctx context.Context, tm time.Time) (int, error) {
+	var (
+		n   int
+		max = tm.Unix()
+		w   = newBatchWriter(db.badger)
+	)
+	defer w.Discard()
+	err := db.badger.View(func(txn *badger.Txn) error {
+		iter := newPrefixIterator(txn, []byte{keyVersion, prefixByteEvent}, false)
+		defer iter.Close()
+		numKeys := 0
+		for iter.Rewind(); iter.Valid(); {
+			if numKeys++; numKeys%ctxCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+			}
+			item := iter.Item()
+			key := item.Key()
+			if len(key) <= keySize {
+				iter.Next()
+				continue
+			}
+			_, id, ts := parseKey(key[:keySize])
+			if int64(ts) >= max {
+				// Blocks are sorted by time, skip to the next event
+				if id == math.MaxUint32 {
+					break
+				}
+				next := eventPrefix(id + 1)
+				iter.Seek(next)
+				continue
+			}
+			if err := w.Delete(item.KeyCopy(nil)); err != nil {
+				return err
+			}
+			n++
+			iter.Next()
+		}
+		return nil
+	})
+	if err == nil {
+		err = w.Commit()
+	}
+	if err != nil {
+		return 0, err
+	}
+	return n, ctx.Err()
+}
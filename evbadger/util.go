@@ -2,6 +2,8 @@ package evbadger
 
 import (
 	"sync"
+
+	"github.com/dgraph-io/badger/v2"
 )
 
 const (
@@ -41,3 +43,52 @@ func getBuffer() []byte {
 func putBuffer(buf []byte) {
 	buffers.Put(buf)
 }
+
+// batchWriter writes to badger committing in as many transactions as needed
+type batchWriter struct {
+	db  *badger.DB
+	txn *badger.Txn
+}
+
+func newBatchWriter(db *badger.DB) *batchWriter {
+	return &batchWriter{
+		db:  db,
+		txn: db.NewTransaction(true),
+	}
+}
+
+// Set sets a key, key and value must not be modified until Commit
+func (w *batchWriter) Set(key, value []byte) error {
+	err := w.txn.Set(key, value)
+	if err == badger.ErrTxnTooBig {
+		if err := w.txn.Commit(); err != nil {
+			return err
+		}
+		w.txn = w.db.NewTransaction(true)
+		err = w.txn.Set(key, value)
+	}
+	return err
+}
+
+// Delete deletes a key, key must not be modified until Commit
+func (w *batchWriter) Delete(key []byte) error {
+	err := w.txn.Delete(key)
+	if err == badger.ErrTxnTooBig {
+		if err := w.txn.Commit(); err != nil {
+			return err
+		}
+		w.txn = w.db.NewTransaction(true)
+		err = w.txn.Delete(key)
+	}
+	return err
+}
+
+// Commit commits pending writes
+func (w *batchWriter) Commit() error {
+	return w.txn.Commit()
+}
+
+// Discard discards pending writes
+func (w *batchWriter) Discard() {
+	w.txn.Discard()
+}
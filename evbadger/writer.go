@@ -0,0 +1,131 @@
+package evbadger
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+
+	"github.com/dgraph-io/badger/v2"
+	errors "golang.org/x/xerrors"
+)
+
+// Snapshot blocks are appended under `[keyVersion, prefixByteEvent, event, ts, writer, seq]` keys.
+// Each DB instance is assigned a unique writer id on Open and numbers its blocks with an
+// atomic sequence so appends never read existing keys and cannot conflict.
+// Blocks at the same ts are folded by queries and merged by compaction
+// into a block with a zero suffix.
+
+// maxRetries is the number of attempts for a write that fails with badger.ErrConflict
+const maxRetries = 5
+
+// WriteStats reports write contention counters of a DB, compaction transactions included
+type WriteStats struct {
+	// Blocks is the number of snapshot blocks written
+	Blocks uint64 `json:"blocks"`
+	// Conflicts is the number of transactions that failed with a conflict
+	Conflicts uint64 `json:"conflicts"`
+	// Retries is the number of retried transactions
+	Retries uint64 `json:"retries"`
+	// Failures is the number of writes that failed after all retries
+	Failures uint64 `json:"failures"`
+}
+
+type blockWriter struct {
+	stats WriteStats
+	id    uint32
+	seq   uint32
+}
+
+// WriteStats returns the write contention counters
+func (db *DB) WriteStats() WriteStats {
+	s := &db.writer.stats
+	return WriteStats{
+		Blocks:    atomic.LoadUint64(&s.Blocks),
+		Conflicts: atomic.LoadUint64(&s.Conflicts),
+		Retries:   atomic.LoadUint64(&s.Retries),
+		Failures:  atomic.LoadUint64(&s.Failures),
+	}
+}
+
+func writerKey() []byte {
+	return []byte{keyVersion, prefixByteWriter}
+}
+
+// nextWriterID increments the writer id stored in the DB.
+// Writer ids start at 1, read-only DBs use 0.
+func nextWriterID(db *badger.DB) (uint32, error) {
+	var id uint32
+	update := func(txn *badger.Txn) error {
+		item, err := txn.Get(writerKey())
+		switch err {
+		case nil:
+			err = item.Value(func(v []byte) error {
+				if len(v) != 4 {
+					return errors.Errorf("Invalid writer id %x", v)
+				}
+				id = binary.BigEndian.Uint32(v)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		case badger.ErrKeyNotFound:
+			id = 0
+		default:
+			return err
+		}
+		id++
+		v := make([]byte, 4)
+		binary.BigEndian.PutUint32(v, id)
+		return txn.Set(writerKey(), v)
+	}
+	var err error
+	for i := 0; i < maxRetries; i++ {
+		if err = db.Update(update); err != badger.ErrConflict {
+			break
+		}
+	}
+	if err == badger.ErrReadOnlyTxn {
+		return 0, nil
+	}
+	return id, err
+}
+
+// key returns a new unique key for a block at ts
+func (w *blockWriter) key(event eventID, ts int64) []byte {
+	seq := atomic.AddUint32(&w.seq, 1)
+	return blockKey(event, ts, w.id, seq)
+}
+
+// retry runs fn until it does not fail with badger.ErrConflict, up to maxRetries times
+func (w *blockWriter) retry(fn func() error) (err error) {
+	for i := 0; i < maxRetries; i++ {
+		if i > 0 {
+			atomic.AddUint64(&w.stats.Retries, 1)
+		}
+		if err = fn(); err != badger.ErrConflict {
+			break
+		}
+		atomic.AddUint64(&w.stats.Conflicts, 1)
+	}
+	if err != nil {
+		atomic.AddUint64(&w.stats.Failures, 1)
+	}
+	return
+}
+
+// append writes a snapshot block at ts without reading any keys
+func (w *blockWriter) append(db *badger.DB, event eventID, ts int64, block []byte) error {
+	key := w.key(event, ts)
+	err := w.retry(func() error {
+		txn := db.NewTransaction(true)
+		defer txn.Discard()
+		if err := txn.Set(key, block); err != nil {
+			return err
+		}
+		return txn.Commit()
+	})
+	if err == nil {
+		atomic.AddUint64(&w.stats.Blocks, 1)
+	}
+	return err
+}
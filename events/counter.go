@@ -37,6 +37,19 @@ func (cs *CounterIndex) Len() (n int) {
 	return
 }
 
+// NumNonZero returns the number of counters with a non zero count
+func (cs *CounterIndex) NumNonZero() (n int) {
+	cs.mu.RLock()
+	src := cs.index.counters
+	for i := range src {
+		if atomic.LoadInt64(&src[i].Count) != 0 {
+			n++
+		}
+	}
+	cs.mu.RUnlock()
+	return
+}
+
 // Pack packs the counter index dropping zero counters
 func (cs *CounterIndex) Pack() {
 	cs.mu.Lock()
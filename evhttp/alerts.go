@@ -0,0 +1,78 @@
+package evhttp
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alxarch/evdb/evalert"
+	"github.com/alxarch/httperr"
+	errors "golang.org/x/xerrors"
+)
+
+// AlertsHandler returns an HTTP endpoint listing the alerts of an alerting engine
+func AlertsHandler(e *evalert.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			httperr.RespondJSON(w, httperr.MethodNotAllowed(nil))
+			return
+		}
+		httperr.RespondJSON(w, e.Alerts())
+	}
+}
+
+// SilencesHandler returns an HTTP endpoint that manages the silences of an alerting engine.
+//
+// `GET {prefix}` lists all silences, `POST {prefix}` adds a silence
+// and `DELETE {prefix}{id}` removes it.
+// If readOnly is true only GET requests are allowed.
+func SilencesHandler(e *evalert.Engine, prefix string, readOnly bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, prefix)
+		switch {
+		case r.Method == http.MethodGet && id == "":
+			httperr.RespondJSON(w, e.Silences())
+			return
+		case readOnly:
+		case (r.Method == http.MethodPost || r.Method == http.MethodPut) && id == "":
+			defer r.Body.Close()
+			data, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				httperr.RespondJSON(w, httperr.BadRequest(err))
+				return
+			}
+			var s evalert.Silence
+			if err := json.Unmarshal(data, &s); err != nil {
+				httperr.RespondJSON(w, httperr.BadRequest(err))
+				return
+			}
+			if s.StartsAt.IsZero() {
+				s.StartsAt = time.Now()
+			}
+			if err := s.Validate(); err != nil {
+				httperr.RespondJSON(w, httperr.BadRequest(err))
+				return
+			}
+			silence, err := e.AddSilence(s)
+			if err != nil {
+				httperr.RespondJSON(w, err)
+				return
+			}
+			httperr.RespondJSON(w, silence)
+			return
+		case r.Method == http.MethodDelete && id != "":
+			if err := e.DeleteSilence(id); err != nil {
+				if errors.Is(err, evalert.ErrSilenceNotFound) {
+					err = httperr.NotFound(err)
+				}
+				httperr.RespondJSON(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		httperr.RespondJSON(w, httperr.MethodNotAllowed(nil))
+	}
+}
@@ -0,0 +1,46 @@
+package evhttp_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alxarch/evdb/evalert"
+	"github.com/alxarch/evdb/evhttp"
+	"github.com/alxarch/evdb/evql"
+	"github.com/alxarch/evdb/evutil"
+	"github.com/alxarch/evdb/internal/assert"
+)
+
+func TestSilencesHandler(t *testing.T) {
+	e, err := evalert.NewEngine(evql.NewExecer(evutil.NewMemoryStore()), nil, &evalert.Config{})
+	assert.NoError(t, err)
+	srv := httptest.NewServer(evhttp.SilencesHandler(e, "/", false))
+	defer srv.Close()
+
+	res, err := http.Post(srv.URL, "application/json", strings.NewReader(`{"matchers":{}}`))
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusBadRequest)
+
+	body := `{"matchers":{"host":{"equals":"a"}},"endsAt":"2100-01-01T00:00:00Z"}`
+	res, err = http.Post(srv.URL, "application/json", strings.NewReader(body))
+	assert.NoError(t, err)
+	var s evalert.Silence
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&s))
+	res.Body.Close()
+	assert.OK(t, s.ID != "", "Silence has an id")
+	assert.Equal(t, len(e.Silences()), 1)
+
+	for _, status := range []int{http.StatusNoContent, http.StatusNotFound} {
+		req, err := http.NewRequest(http.MethodDelete, srv.URL+"/"+s.ID, nil)
+		assert.NoError(t, err)
+		res, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, res.StatusCode, status)
+	}
+	assert.Equal(t, len(e.Silences()), 0)
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/alxarch/httperr"
 	errors "golang.org/x/xerrors"
@@ -37,3 +39,127 @@ func sendJSON(ctx context.Context, c HTTPClient, req *http.Request, x interface{
 	return json.Unmarshal(data, x)
 
 }
+
+// headerClient adds headers to all requests
+type headerClient struct {
+	HTTPClient
+	header http.Header
+}
+
+func (c *headerClient) Do(req *http.Request) (*http.Response, error) {
+	for key, values := range c.header {
+		req.Header[key] = values
+	}
+	return c.HTTPClient.Do(req)
+}
+
+// RetryClient retries idempotent requests that failed or got a 429, 502, 503 or 504 response.
+// The delay between retries starts at Backoff and doubles on each retry,
+// a Retry-After header of 429 and 503 responses overrides it.
+// Requests are idempotent if their method is GET or HEAD, their context is marked WithIdempotent
+// or they have an Idempotency-Key header.
+type RetryClient struct {
+	HTTPClient
+	Retries int
+	Backoff time.Duration
+}
+
+type idempotentKey struct{}
+
+// WithIdempotent marks the requests of a context as safe for RetryClient to retry regardless of their method
+func WithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+// Do implements HTTPClient
+func (c *RetryClient) Do(req *http.Request) (*http.Response, error) {
+	if !isIdempotent(req) {
+		return c.HTTPClient.Do(req)
+	}
+	ctx := req.Context()
+	backoff := c.Backoff
+	for i := 0; ; i++ {
+		res, err := c.HTTPClient.Do(req)
+		if i == c.Retries || !shouldRetry(res, err) || ctx.Err() != nil {
+			return res, err
+		}
+		delay := backoff
+		if d, ok := retryAfter(res, time.Now()); ok {
+			delay = d
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			// The retry would fail on the deadline anyway
+			return res, err
+		}
+		if res != nil {
+			res.Body.Close()
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+		backoff *= 2
+	}
+}
+
+func isIdempotent(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	}
+	if idempotent, _ := req.Context().Value(idempotentKey{}).(bool); idempotent {
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+func shouldRetry(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses the Retry-After header of 429 and 503 responses as seconds or an HTTP date
+func retryAfter(res *http.Response, now time.Time) (time.Duration, bool) {
+	if res == nil {
+		return 0, false
+	}
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+	default:
+		return 0, false
+	}
+	v := res.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second, true
+	}
+	tm, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	if d := tm.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
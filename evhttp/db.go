@@ -7,6 +7,8 @@ import (
 	"net/url"
 	"path"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/alxarch/evdb/evutil"
@@ -18,10 +20,12 @@ import (
 )
 
 type db struct {
-	url     string
-	execer  evql.Execer
-	scanner evdb.Scanner
-	store   evdb.Store
+	url       string
+	healthURL string
+	client    HTTPClient
+	execer    evql.Execer
+	scanner   evdb.Scanner
+	store     evdb.Store
 }
 
 func (db *db) String() string {
@@ -55,36 +59,191 @@ type opener struct{}
 
 // Open implements evdb.Opener
 func (opener) Open(baseURL string) (evdb.DB, error) {
-	// TODO: [evhttp] dialer and transport options as url query params
+	config, err := ParseURL(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	return Open(config)
+}
+
+// Config is the configuration of a remote DB
+type Config struct {
+	URL string
+	// Timeout is the maximum duration of each request
+	Timeout     time.Duration
+	DialTimeout time.Duration
+	KeepAlive   time.Duration
+	IdleTimeout time.Duration
+	MaxIdle     int
+	// Header is added to all requests
+	Header http.Header
+	// Retries is the number of times idempotent requests are retried
+	Retries int
+	// Backoff is the delay before the first retry, it doubles on each retry
+	Backoff time.Duration
+	// TLSCA is a PEM file with the CAs to verify the server certificate
+	TLSCA string
+	// TLSCert and TLSKey are the files of a client certificate
+	TLSCert     string
+	TLSKey      string
+	TLSInsecure bool
+	// H2C uses HTTP/2 without TLS for http URLs
+	H2C bool
+}
+
+const defaultBackoff = 100 * time.Millisecond
+
+// ParseURL parses a remote DB config from a URL.
+// Query params configure the HTTP client and are not sent to the server:
+// timeout, dial-timeout, keep-alive, idle-timeout, max-idle, retries, backoff,
+// ca, cert, key, insecure, h2c and header.<name> for each request header.
+func ParseURL(baseURL string) (*Config, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	config := Config{
+		DialTimeout: 30 * time.Second,
+		KeepAlive:   30 * time.Second,
+		IdleTimeout: 90 * time.Second,
+		MaxIdle:     runtime.GOMAXPROCS(0) + 1,
+		Backoff:     defaultBackoff,
+	}
+	q := u.Query()
+	for key, d := range map[string]*time.Duration{
+		"timeout":      &config.Timeout,
+		"dial-timeout": &config.DialTimeout,
+		"keep-alive":   &config.KeepAlive,
+		"idle-timeout": &config.IdleTimeout,
+		"backoff":      &config.Backoff,
+	} {
+		if v, ok := q[key]; ok {
+			if *d, err = time.ParseDuration(v[0]); err != nil || *d < 0 {
+				return nil, errors.Errorf("Invalid %s %q", key, v[0])
+			}
+			delete(q, key)
+		}
+	}
+	for key, n := range map[string]*int{
+		"max-idle": &config.MaxIdle,
+		"retries":  &config.Retries,
+	} {
+		if v, ok := q[key]; ok {
+			if *n, err = strconv.Atoi(v[0]); err != nil || *n < 0 {
+				return nil, errors.Errorf("Invalid %s %q", key, v[0])
+			}
+			delete(q, key)
+		}
+	}
+	for key, b := range map[string]*bool{
+		"insecure": &config.TLSInsecure,
+		"h2c":      &config.H2C,
+	} {
+		if v, ok := q[key]; ok {
+			if *b, err = strconv.ParseBool(v[0]); err != nil {
+				return nil, errors.Errorf("Invalid %s %q", key, v[0])
+			}
+			delete(q, key)
+		}
+	}
+	for key, s := range map[string]*string{
+		"ca":   &config.TLSCA,
+		"cert": &config.TLSCert,
+		"key":  &config.TLSKey,
+	} {
+		if v, ok := q[key]; ok {
+			*s = v[0]
+			delete(q, key)
+		}
+	}
+	const headerPrefix = "header."
+	for key, values := range q {
+		if strings.HasPrefix(key, headerPrefix) {
+			if config.Header == nil {
+				config.Header = make(http.Header)
+			}
+			name := strings.TrimPrefix(key, headerPrefix)
+			config.Header[http.CanonicalHeaderKey(name)] = values
+			delete(q, key)
+		}
+	}
+	switch u.Scheme {
+	case "http":
+		if config.TLSCA != "" || config.TLSCert != "" || config.TLSKey != "" || config.TLSInsecure {
+			return nil, errors.Errorf("TLS options require an https URL")
+		}
+	case "https":
+		if config.H2C {
+			return nil, errors.Errorf("h2c requires an http URL")
+		}
+	default:
+		return nil, errors.Errorf("Invalid URL scheme %q", u.Scheme)
+	}
+	u.RawQuery = q.Encode()
+	config.URL = u.String()
+	return &config, nil
+}
+
+// Client creates an HTTP client for the config
+func (c *Config) Client() (*http.Client, error) {
 	dialer := net.Dialer{
-		Timeout:   30 * time.Second,
-		KeepAlive: 30 * time.Second,
+		Timeout:   c.DialTimeout,
+		KeepAlive: c.KeepAlive,
 		DualStack: true,
 	}
+	tlsConfig, err := ClientTLSConfig(c.TLSCA, c.TLSCert, c.TLSKey, c.TLSInsecure)
+	if err != nil {
+		return nil, err
+	}
 	transport := http.Transport{
 		Proxy:                 http.ProxyFromEnvironment,
 		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		ForceAttemptHTTP2:     true,
 		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
+		IdleConnTimeout:       c.IdleTimeout,
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 0,
-		MaxIdleConnsPerHost:   runtime.GOMAXPROCS(0) + 1,
+		MaxIdleConnsPerHost:   c.MaxIdle,
 	}
-	hc := http.Client{
-		Transport: &transport,
+	if c.H2C {
+		transport.Protocols = new(http.Protocols)
+		transport.Protocols.SetUnencryptedHTTP2(true)
 	}
-	var c HTTPClient = &hc
-	u, err := url.Parse(baseURL)
+	return &http.Client{
+		Transport: &transport,
+		Timeout:   c.Timeout,
+	}, nil
+}
+
+// Open opens a remote DB
+func Open(config *Config) (evdb.DB, error) {
+	hc, err := config.Client()
 	if err != nil {
 		return nil, err
 	}
-	switch u.Scheme {
-	case "http", "https":
-	default:
-		return nil, errors.Errorf("Invalid URL scheme %q", u.Scheme)
+	var c HTTPClient = hc
+	if len(config.Header) > 0 {
+		c = &headerClient{HTTPClient: c, header: config.Header}
+	}
+	if config.Retries > 0 {
+		c = &RetryClient{
+			HTTPClient: c,
+			Retries:    config.Retries,
+			Backoff:    config.Backoff,
+		}
+	}
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, err
 	}
 	db := new(db)
-	db.url = baseURL
+	db.url = config.URL
+	db.client = c
+
+	healthURL := *u
+	healthURL.Path = path.Join(u.Path, "readyz")
+	db.healthURL = healthURL.String()
 
 	scanURL := *u
 	scanURL.Path = path.Join(u.Path, "scan")
@@ -111,6 +270,7 @@ func (opener) Open(baseURL string) (evdb.DB, error) {
 	db.store = evutil.CacheStore(&store)
 	return db, nil
 }
+
 func init() {
 	evdb.Register("https", opener{})
 	evdb.Register("http", opener{})
@@ -0,0 +1,143 @@
+package evhttp_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/evhttp"
+	"github.com/alxarch/evdb/internal/assert"
+)
+
+func TestParseURL(t *testing.T) {
+	for _, tc := range []struct {
+		URL     string
+		Want    string
+		WantErr bool
+		Check   func(c *evhttp.Config) bool
+	}{
+		{"http://example.org/api?h2c=true&dial-timeout=1s", "http://example.org/api", false, func(c *evhttp.Config) bool {
+			return c.H2C && c.DialTimeout == time.Second
+		}},
+		{"https://example.org?insecure=1&ca=ca.pem&foo=bar", "https://example.org?foo=bar", false, func(c *evhttp.Config) bool {
+			return c.TLSInsecure && c.TLSCA == "ca.pem"
+		}},
+		{"http://example.org?timeout=5s&max-idle=50&retries=3&backoff=1s", "http://example.org", false, func(c *evhttp.Config) bool {
+			return c.Timeout == 5*time.Second && c.MaxIdle == 50 && c.Retries == 3 && c.Backoff == time.Second
+		}},
+		{"http://example.org?header.x-token=foo", "http://example.org", false, func(c *evhttp.Config) bool {
+			return c.Header.Get("X-Token") == "foo"
+		}},
+		{"https://example.org?h2c=true", "", true, nil},
+		{"http://example.org?ca=ca.pem", "", true, nil},
+		{"http://example.org?keep-alive=foo", "", true, nil},
+		{"http://example.org?retries=-1", "", true, nil},
+		{"ftp://example.org", "", true, nil},
+	} {
+		config, err := evhttp.ParseURL(tc.URL)
+		if tc.WantErr {
+			assert.OK(t, err != nil, "Expected error for %q", tc.URL)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, config.URL, tc.Want)
+		assert.OK(t, tc.Check(config), "Invalid config %v", config)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	var token string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.Header.Get("X-Token")
+	}))
+	defer srv.Close()
+	remote, err := evdb.Open(srv.URL + "?header.X-Token=secret")
+	assert.NoError(t, err)
+	assert.NoError(t, evdb.Health(context.Background(), remote))
+	assert.Equal(t, token, "secret")
+}
+
+func TestRetryClient(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	c := evhttp.RetryClient{
+		HTTPClient: http.DefaultClient,
+		Retries:    2,
+		Backoff:    time.Millisecond,
+	}
+	for _, tc := range []struct {
+		Method     string
+		Body       io.Reader
+		Idempotent bool
+		Key        string
+		Status     int
+		Calls      int
+	}{
+		{http.MethodGet, nil, false, "", http.StatusOK, 3},
+		{http.MethodPost, strings.NewReader("foo"), false, "", http.StatusServiceUnavailable, 1},
+		{http.MethodPost, strings.NewReader("foo"), true, "", http.StatusOK, 3},
+		{http.MethodPost, strings.NewReader("foo"), false, "key", http.StatusOK, 3},
+	} {
+		calls = 0
+		req, err := http.NewRequest(tc.Method, srv.URL, tc.Body)
+		assert.NoError(t, err)
+		if tc.Idempotent {
+			req = req.WithContext(evhttp.WithIdempotent(req.Context()))
+		}
+		if tc.Key != "" {
+			req.Header.Set("Idempotency-Key", tc.Key)
+		}
+		res, err := c.Do(req)
+		assert.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, res.StatusCode, tc.Status)
+		assert.Equal(t, calls, tc.Calls)
+	}
+}
+
+func TestRetryClient_RetryAfter(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+	c := evhttp.RetryClient{
+		HTTPClient: http.DefaultClient,
+		Retries:    1,
+		Backoff:    time.Millisecond,
+	}
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	assert.NoError(t, err)
+	start := time.Now()
+	res, err := c.Do(req)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	assert.Equal(t, calls, 2)
+	assert.OK(t, time.Since(start) >= time.Second, "Retry-After delays the retry")
+
+	// Retries that would wait past the deadline are not attempted
+	calls = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	res, err = c.Do(req.WithContext(ctx))
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusTooManyRequests)
+	assert.Equal(t, calls, 1)
+}
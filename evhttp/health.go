@@ -0,0 +1,62 @@
+package evhttp
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/httperr"
+)
+
+// healthTimeout limits the duration of health checks
+const healthTimeout = 5 * time.Second
+
+// LivenessHandler responds with 200 OK as long as the server is serving requests.
+// It does not check the DB so that a failing DB does not get the server restarted, use HealthHandler for readiness.
+func LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("OK\n"))
+}
+
+// HealthHandler returns a handler that responds with 200 OK if a DB is healthy and 503 Service Unavailable otherwise
+func HealthHandler(db evdb.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+		defer cancel()
+		if err := evdb.Health(ctx, db); err != nil {
+			httperr.RespondJSON(w, httperr.New(http.StatusServiceUnavailable, err))
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("OK\n"))
+	}
+}
+
+// StatsHandler returns a handler that serves the statistics of a DB as JSON
+func StatsHandler(db evdb.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		httperr.RespondJSON(w, evdb.Stats(db))
+	}
+}
+
+// Health implements evdb.HealthChecker checking the readiness of the upstream server
+func (db *db) Health(ctx context.Context) error {
+	req, err := http.NewRequest(http.MethodGet, db.healthURL, nil)
+	if err != nil {
+		return err
+	}
+	c := db.client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	res, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	if httperr.IsError(res.StatusCode) {
+		return httperr.FromResponse(res)
+	}
+	res.Body.Close()
+	return nil
+}
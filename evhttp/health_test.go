@@ -0,0 +1,68 @@
+package evhttp_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/evhttp"
+	"github.com/alxarch/evdb/evutil"
+	"github.com/alxarch/evdb/internal/assert"
+	errors "golang.org/x/xerrors"
+)
+
+type healthDB struct {
+	evutil.MemoryStore
+	err error
+}
+
+func (db *healthDB) Health(context.Context) error {
+	return db.err
+}
+
+func (db *healthDB) ReportStats(stats map[string]interface{}) {
+	stats["events"] = len(db.MemoryStore)
+}
+
+func (db *healthDB) Close() error {
+	return nil
+}
+
+func TestHealthHandler(t *testing.T) {
+	db := &healthDB{MemoryStore: evutil.NewMemoryStore("foo", "bar")}
+	srv := httptest.NewServer(evhttp.DefaultMux(db, db))
+	defer srv.Close()
+	remote, err := evdb.Open(srv.URL)
+	assert.NoError(t, err)
+	ctx := context.Background()
+	for _, path := range []string{"/healthz", "/readyz"} {
+		res, err := http.Get(srv.URL + path)
+		assert.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, res.StatusCode, http.StatusOK)
+	}
+	assert.NoError(t, evdb.Health(ctx, remote))
+
+	db.err = errors.New("Unhealthy")
+	for path, code := range map[string]int{
+		// Liveness does not depend on the DB
+		"/healthz": http.StatusOK,
+		"/readyz":  http.StatusServiceUnavailable,
+	} {
+		res, err := http.Get(srv.URL + path)
+		assert.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, res.StatusCode, code)
+	}
+	assert.OK(t, evdb.Health(ctx, remote) != nil, "Remote DB is unhealthy")
+
+	res, err := http.Get(srv.URL + "/stats")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	var stats map[string]interface{}
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&stats))
+	assert.Equal(t, stats, map[string]interface{}{"events": 2.0})
+}
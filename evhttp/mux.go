@@ -4,6 +4,8 @@ import (
 	"net/http"
 
 	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/evql"
+	"github.com/alxarch/evdb/evutil"
 )
 
 // DefaultMux creates an HTTP endpoint for a evdb.DB
@@ -13,10 +15,22 @@ func DefaultMux(r evdb.Scanner, w evdb.Store) http.Handler {
 	mux.HandleFunc("/query", QueryHandler(r))
 	mux.HandleFunc("/", serveIndexHTML)
 	mux.HandleFunc("/index.html", serveIndexHTML)
+	mux.HandleFunc("/healthz", LivenessHandler)
 	if w != nil {
-		h := StoreHandler(w, "/store/")
+		// Publish stored snapshots to subscribers
+		hub := evutil.NewHub(w)
+		h := StoreHandler(hub, "/store/")
 		h = InflateRequest(h)
 		mux.HandleFunc("/store/", h)
+		mux.HandleFunc("/subscribe", SubscribeHandler(r, hub))
+	}
+	if db, ok := r.(evdb.DB); ok {
+		mux.HandleFunc("/readyz", HealthHandler(db))
+		mux.HandleFunc("/stats", StatsHandler(db))
+		if queries := evql.FindQueryStore(db); queries != nil {
+			mux.HandleFunc("/query/", NamedQueryHandler(r, queries, "/query/"))
+			mux.HandleFunc("/queries/", SavedQueriesHandler(queries, "/queries/", w == nil))
+		}
 	}
 	return mux
 }
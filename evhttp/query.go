@@ -1,12 +1,14 @@
 package evhttp
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"io/ioutil"
 	"mime"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -38,6 +40,11 @@ func (ex *Execer) Exec(ctx context.Context, r evdb.TimeRange, q string) ([]evdb.
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/evql")
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// Queries are idempotent
+	ctx = WithIdempotent(ctx)
 	var results []evdb.Results
 	if err := sendJSON(ctx, ex.HTTPClient, req, &results); err != nil {
 		return nil, err
@@ -46,7 +53,10 @@ func (ex *Execer) Exec(ctx context.Context, r evdb.TimeRange, q string) ([]evdb.
 
 }
 
-// ExecHandler returns an HTTP endpoint that executes evql queries
+// ExecHandler returns an HTTP endpoint that executes evql queries.
+//
+// Results are JSON unless a `csv`, `tsv` or `excel` report format is set with the `format` parameter
+// or the Accept header. Report `layout` is `long` or `wide` and `pivot` sets the wide layout columns.
 func ExecHandler(scanner evdb.Scanner) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var q query
@@ -55,6 +65,14 @@ func ExecHandler(scanner evdb.Scanner) http.HandlerFunc {
 			values := r.URL.Query()
 			q.Query = values.Get("query")
 			q.Format = values.Get("format")
+			reportFromURL(&q, values)
+			q.Explain = explainFromURL(values)
+			timeout, err := TimeoutFromURL(values)
+			if err != nil {
+				httperr.RespondJSON(w, httperr.BadRequest(err))
+				return
+			}
+			q.Timeout = timeout
 			t, err := TimeRangeFromURL(values)
 			if err != nil {
 				httperr.RespondJSON(w, httperr.BadRequest(err))
@@ -85,10 +103,26 @@ func ExecHandler(scanner evdb.Scanner) http.HandlerFunc {
 				q.TimeRange = t
 				q.Query = values.Get("query")
 				q.Format = values.Get("format")
+				reportFromURL(&q, values)
+				q.Explain = explainFromURL(values)
+				timeout, err := TimeoutFromURL(values)
+				if err != nil {
+					httperr.RespondJSON(w, httperr.BadRequest(err))
+					return
+				}
+				q.Timeout = timeout
 			case "application/evql":
 				q.Query = string(data)
 				values := r.URL.Query()
 				q.Format = values.Get("format")
+				reportFromURL(&q, values)
+				q.Explain = explainFromURL(values)
+				timeout, err := TimeoutFromURL(values)
+				if err != nil {
+					httperr.RespondJSON(w, httperr.BadRequest(err))
+					return
+				}
+				q.Timeout = timeout
 				t, err := TimeRangeFromURL(values)
 				if err != nil {
 					httperr.RespondJSON(w, httperr.BadRequest(err))
@@ -109,65 +143,152 @@ func ExecHandler(scanner evdb.Scanner) http.HandlerFunc {
 			httperr.RespondJSON(w, httperr.MethodNotAllowed(nil))
 			return
 		}
-		if q.Step < time.Second {
-			err := errors.New("Invalid query.step")
-			httperr.RespondJSON(w, httperr.BadRequest(err))
-			return
-		}
-		now := time.Now()
-		if q.End.IsZero() || q.End.After(now) {
-			q.End = now
-		}
-		if q.Start.IsZero() || q.Start.After(q.End) {
-			q.Start = q.End.Add(-1 * q.Step)
-		}
-
 		e, err := evql.Parse(q.Query)
 		if err != nil {
 			httperr.RespondJSON(w, httperr.BadRequest(err))
 			return
 		}
-		queries := e.Queries(q.TimeRange)
-		if len(queries) == 0 {
-			err := errors.New("Empty query")
+		serveQuery(w, r, scanner, e, &q)
+	}
+}
+
+func serveQuery(w http.ResponseWriter, r *http.Request, scanner evdb.Scanner, e *evql.Query, q *query) {
+	if q.Format == "" {
+		q.Format = formatFromAccept(r)
+	}
+	var report *evutil.Report
+	if evutil.IsReportFormat(q.Format) {
+		report = &evutil.Report{
+			Format: strings.ToLower(q.Format),
+			Layout: q.Layout,
+			Pivot:  q.Pivot,
+		}
+		if err := report.Validate(); err != nil {
 			httperr.RespondJSON(w, httperr.BadRequest(err))
 			return
 		}
-		results, err := scanner.Scan(r.Context(), queries...)
-		if err != nil {
-			httperr.RespondJSON(w, errors.Errorf("Query evaluation failed: %s", err))
+	}
+	if q.Step < time.Second {
+		err := errors.New("Invalid query.step")
+		httperr.RespondJSON(w, httperr.BadRequest(err))
+		return
+	}
+	now := time.Now()
+	if q.End.IsZero() || q.End.After(now) {
+		q.End = now
+	}
+	if q.Start.IsZero() || q.Start.After(q.End) {
+		q.Start = q.End.Add(-1 * q.Step)
+	}
+	queries := e.Queries(q.TimeRange)
+	if len(queries) == 0 {
+		err := errors.New("Empty query")
+		httperr.RespondJSON(w, httperr.BadRequest(err))
+		return
+	}
+	ctx, cancel := withTimeout(r.Context(), q.Timeout)
+	defer cancel()
+	if q.Explain {
+		x := e.Explain(q.TimeRange)
+		if err := x.Estimate(ctx, scanner); err != nil {
+			httperr.RespondJSON(w, scanError(errors.Errorf("Query estimation failed: %w", err)))
 			return
 		}
-		rows := e.Eval(nil, q.TimeRange, results)
-		if out, ok := evutil.FormatResults(q.Format, rows...); ok {
-			httperr.RespondJSON(w, out)
-			return
+		httperr.RespondJSON(w, x)
+		return
+	}
+	results, err := scanner.Scan(ctx, queries...)
+	if err != nil {
+		httperr.RespondJSON(w, scanError(errors.Errorf("Query evaluation failed: %w", err)))
+		return
+	}
+	rows := e.Eval(nil, q.TimeRange, results)
+	if report != nil {
+		serveReport(w, report, evutil.FlattenResults(rows...))
+		return
+	}
+	if out, ok := evutil.FormatResults(q.Format, rows...); ok {
+		httperr.RespondJSON(w, out)
+		return
+	}
+	err = errors.Errorf("Invalid query format: %q", q.Format)
+	httperr.RespondJSON(w, httperr.BadRequest(err))
+}
+
+func serveReport(w http.ResponseWriter, report *evutil.Report, results evdb.Results) {
+	var buf bytes.Buffer
+	if err := report.Write(&buf, results); err != nil {
+		httperr.RespondJSON(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", report.ContentType())
+	if strings.EqualFold(report.Format, evutil.FormatExcel) {
+		w.Header().Set("Content-Disposition", `attachment; filename="`+report.FileName("results")+`"`)
+	}
+	w.Write(buf.Bytes())
+}
+
+// formatFromAccept returns the first report format in the Accept header
+func formatFromAccept(r *http.Request) string {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		m, _, _ := mime.ParseMediaType(strings.TrimSpace(accept))
+		if format := evutil.ReportFormatFromMIME(m); format != "" {
+			return format
+		}
+	}
+	return ""
+}
+
+func reportFromURL(q *query, values url.Values) {
+	q.Layout = values.Get("layout")
+	q.Pivot = nil
+	for _, pivot := range values["pivot"] {
+		for _, p := range strings.Split(pivot, ",") {
+			q.Pivot = append(q.Pivot, strings.TrimSpace(p))
 		}
-		err = errors.Errorf("Invalid query format: %q", q.Format)
-		httperr.RespondJSON(w, httperr.BadRequest(err))
 	}
 }
 
 type query struct {
 	Query string
 	evdb.TimeRange
-	Format string
+	Format  string
+	Layout  string
+	Pivot   []string
+	Explain bool
+	Timeout time.Duration
 }
 
 type jsonQuery struct {
-	Query  string `json:"query"`
-	Format string `json:"format,omitempty"`
-	Start  string `json:"start"`
-	End    string `json:"end"`
-	Step   string `json:"step"`
+	Query   string   `json:"query"`
+	Format  string   `json:"format,omitempty"`
+	Layout  string   `json:"layout,omitempty"`
+	Pivot   []string `json:"pivot,omitempty"`
+	Explain bool     `json:"explain,omitempty"`
+	Timeout string   `json:"timeout,omitempty"`
+	Start   string   `json:"start"`
+	End     string   `json:"end"`
+	Step    string   `json:"step"`
+}
+
+func explainFromURL(values url.Values) bool {
+	explain, _ := strconv.ParseBool(values.Get("explain"))
+	return explain
 }
 
 func (q *query) MarshalJSON() ([]byte, error) {
 	tmp := jsonQuery{
-		Start: q.Start.Format(time.RFC3339Nano),
-		End:   q.End.Format(time.RFC3339Nano),
-		Step:  q.Step.String(),
-		Query: q.Query,
+		Start:   q.Start.Format(time.RFC3339Nano),
+		End:     q.End.Format(time.RFC3339Nano),
+		Step:    q.Step.String(),
+		Query:   q.Query,
+		Format:  q.Format,
+		Layout:  q.Layout,
+		Pivot:   q.Pivot,
+		Explain: q.Explain,
+	}
+	if q.Timeout > 0 {
+		tmp.Timeout = q.Timeout.String()
 	}
 	return json.Marshal(&tmp)
 }
@@ -179,6 +300,16 @@ func (q *query) UnmarshalJSON(data []byte) error {
 	}
 	q.Query = tmp.Query
 	q.Format = tmp.Format
+	q.Layout = tmp.Layout
+	q.Pivot = tmp.Pivot
+	q.Explain = tmp.Explain
+	if tmp.Timeout != "" {
+		timeout, err := time.ParseDuration(tmp.Timeout)
+		if err != nil {
+			return err
+		}
+		q.Timeout = timeout
+	}
 	start, err := ParseTime(tmp.Start)
 	if err != nil {
 		return err
@@ -2,12 +2,17 @@ package evhttp_test
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 
 	"github.com/alxarch/evdb"
 	"github.com/alxarch/evdb/events"
 	"github.com/alxarch/evdb/evhttp"
+	"github.com/alxarch/evdb/evql"
 	"github.com/alxarch/evdb/evutil"
 	"github.com/alxarch/evdb/internal/assert"
 )
@@ -59,4 +64,61 @@ func TestExecer(t *testing.T) {
 			},
 		}})
 	}
+	{
+		values := url.Values{}
+		evhttp.EncodeTimeRange(values, tr)
+		values.Set("explain", "1")
+		values.Set("query", `foo{color:blue}`)
+		u := "http://example.com/query?" + values.Encode()
+		req := httptest.NewRequest(http.MethodGet, u, nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, rec.Code, http.StatusOK)
+		var x evql.Explain
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &x))
+		assert.Equal(t, len(x.Queries), 1)
+		assert.Equal(t, x.Queries[0].Event, "foo")
+		assert.Equal(t, x.Queries[0].Fields, evdb.MatchFields{"color": evdb.MatchString("blue")})
+		assert.Equal(t, x.Rows, []evql.RowEstimate{{Event: "foo", Steps: 2, Rows: -1}})
+		assert.Equal(t, x.Tree.Children[0].Children[0].Type, "scan")
+	}
+	ts := now.Truncate(time.Hour).UTC().Format(time.RFC3339)
+	for _, tc := range []struct {
+		Params url.Values
+		Accept string
+		Code   int
+		Type   string
+		Body   string
+	}{
+		{nil, "text/csv", http.StatusOK, "text/csv; charset=utf-8",
+			"time,event,color,taste,value\n" +
+				ts + ",foo,blue,bitter,112\n" +
+				ts + ",foo,red,sweet,34\n"},
+		{url.Values{"format": {"tsv"}, "pivot": {"color"}}, "text/csv", http.StatusOK, "text/tab-separated-values; charset=utf-8",
+			"time\tevent\ttaste\tblue\tred\n" +
+				ts + "\tfoo\tbitter\t112\t\n" +
+				ts + "\tfoo\tsweet\t\t34\n"},
+		{url.Values{"layout": {"wide"}}, "application/json, text/csv", http.StatusOK, "text/csv; charset=utf-8",
+			"event,color,taste," + ts + "\n" +
+				"foo,blue,bitter,112\n" +
+				"foo,red,sweet,34\n"},
+		{url.Values{"layout": {"diagonal"}}, "text/csv", http.StatusBadRequest, "", ""},
+	} {
+		values := url.Values{}
+		evhttp.EncodeTimeRange(values, tr)
+		values.Set("query", `foo`)
+		for key, v := range tc.Params {
+			values[key] = v
+		}
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/query?"+values.Encode(), nil)
+		req.Header.Set("Accept", tc.Accept)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, rec.Code, tc.Code)
+		if tc.Code != http.StatusOK {
+			continue
+		}
+		assert.Equal(t, rec.Header().Get("Content-Type"), tc.Type)
+		assert.Equal(t, rec.Body.String(), tc.Body)
+	}
 }
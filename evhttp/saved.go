@@ -0,0 +1,163 @@
+package evhttp
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/evql"
+	"github.com/alxarch/httperr"
+	errors "golang.org/x/xerrors"
+)
+
+// reservedParams are URL query params that cannot be used as saved query parameter names
+var reservedParams = []string{"query", "start", "end", "step", "format", "explain", "timeout"}
+
+// SavedQueriesHandler returns an HTTP endpoint that manages saved queries.
+//
+// `GET {prefix}` lists all saved queries, `GET {prefix}{name}` returns a saved query,
+// `PUT {prefix}{name}` saves a query and `DELETE {prefix}{name}` removes it.
+// If readOnly is true only GET requests are allowed.
+func SavedQueriesHandler(queries evql.QueryStore, prefix string, readOnly bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, prefix)
+		if name == "" {
+			if r.Method != http.MethodGet {
+				httperr.RespondJSON(w, httperr.MethodNotAllowed(nil))
+				return
+			}
+			saved, err := queries.SavedQueries()
+			if err != nil {
+				httperr.RespondJSON(w, err)
+				return
+			}
+			if saved == nil {
+				saved = []evql.SavedQuery{}
+			}
+			httperr.RespondJSON(w, saved)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			q, err := queries.LoadQuery(name)
+			if err != nil {
+				httperr.RespondJSON(w, savedQueryError(err))
+				return
+			}
+			httperr.RespondJSON(w, q)
+			return
+		case http.MethodPut, http.MethodPost:
+			if readOnly {
+				break
+			}
+			defer r.Body.Close()
+			data, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				httperr.RespondJSON(w, httperr.BadRequest(err))
+				return
+			}
+			var q evql.SavedQuery
+			if err := json.Unmarshal(data, &q); err != nil {
+				httperr.RespondJSON(w, httperr.BadRequest(err))
+				return
+			}
+			q.Name = name
+			for _, p := range q.Params {
+				for _, reserved := range reservedParams {
+					if p.Name == reserved {
+						err := errors.Errorf("Reserved parameter name %q", p.Name)
+						httperr.RespondJSON(w, httperr.BadRequest(err))
+						return
+					}
+				}
+			}
+			if err := q.Validate(); err != nil {
+				httperr.RespondJSON(w, httperr.BadRequest(err))
+				return
+			}
+			if err := queries.SaveQuery(&q); err != nil {
+				httperr.RespondJSON(w, err)
+				return
+			}
+			httperr.RespondJSON(w, &q)
+			return
+		case http.MethodDelete:
+			if readOnly {
+				break
+			}
+			if err := queries.DeleteQuery(name); err != nil {
+				httperr.RespondJSON(w, savedQueryError(err))
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		httperr.RespondJSON(w, httperr.MethodNotAllowed(nil))
+	}
+}
+
+// NamedQueryHandler returns an HTTP endpoint that executes saved queries.
+//
+// The query name is the request path after prefix and parameter values
+// are read from the URL query or form, ie `/query/{name}?host=foo&start=...`
+func NamedQueryHandler(scanner evdb.Scanner, queries evql.QueryStore, prefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodPost:
+		default:
+			httperr.RespondJSON(w, httperr.MethodNotAllowed(nil))
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, prefix)
+		saved, err := queries.LoadQuery(name)
+		if err != nil {
+			httperr.RespondJSON(w, savedQueryError(err))
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			httperr.RespondJSON(w, httperr.BadRequest(err))
+			return
+		}
+		values := r.Form
+		q := query{
+			Query:   saved.Query,
+			Format:  values.Get("format"),
+			Explain: explainFromURL(values),
+		}
+		reportFromURL(&q, values)
+		timeout, err := TimeoutFromURL(values)
+		if err != nil {
+			httperr.RespondJSON(w, httperr.BadRequest(err))
+			return
+		}
+		q.Timeout = timeout
+		t, err := TimeRangeFromURL(values)
+		if err != nil {
+			httperr.RespondJSON(w, httperr.BadRequest(err))
+			return
+		}
+		q.TimeRange = t
+		args := make(map[string]string, len(saved.Params))
+		for _, p := range saved.Params {
+			// Empty values are passed, missing values use the parameter's default
+			if v, ok := values[p.Name]; ok && len(v) > 0 {
+				args[p.Name] = v[0]
+			}
+		}
+		e, err := saved.Parse(args)
+		if err != nil {
+			httperr.RespondJSON(w, httperr.BadRequest(err))
+			return
+		}
+		serveQuery(w, r, scanner, e, &q)
+	}
+}
+
+func savedQueryError(err error) error {
+	if errors.Is(err, evql.ErrQueryNotFound) {
+		return httperr.NotFound(err)
+	}
+	return err
+}
@@ -0,0 +1,115 @@
+package evhttp_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/events"
+	"github.com/alxarch/evdb/evhttp"
+	"github.com/alxarch/evdb/evql"
+	"github.com/alxarch/evdb/evutil"
+	"github.com/alxarch/evdb/internal/assert"
+)
+
+type memQueries map[string]evql.SavedQuery
+
+func (m memQueries) SaveQuery(q *evql.SavedQuery) error {
+	m[q.Name] = *q
+	return nil
+}
+
+func (m memQueries) LoadQuery(name string) (*evql.SavedQuery, error) {
+	if q, ok := m[name]; ok {
+		return &q, nil
+	}
+	return nil, evql.ErrQueryNotFound
+}
+
+func (m memQueries) DeleteQuery(name string) error {
+	if _, ok := m[name]; !ok {
+		return evql.ErrQueryNotFound
+	}
+	delete(m, name)
+	return nil
+}
+
+func (m memQueries) SavedQueries() (queries []evql.SavedQuery, err error) {
+	for _, q := range m {
+		queries = append(queries, q)
+	}
+	return
+}
+
+func TestNamedQueryHandler(t *testing.T) {
+	s := evutil.NewMemoryStore("foo")
+	fooStore, _ := s.Storer("foo")
+	now := time.Now().Truncate(time.Hour)
+	snap := &evdb.Snapshot{
+		Time:   now,
+		Labels: []string{"color", "taste"},
+		Counters: []events.Counter{
+			{Count: 112, Values: []string{"blue", "bitter"}},
+			{Count: 34, Values: []string{"red", "sweet"}},
+		},
+	}
+	if err := fooStore.Store(snap); err != nil {
+		t.Fatal(err)
+	}
+	queries := memQueries{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/queries/", evhttp.SavedQueriesHandler(queries, "/queries/", false))
+	mux.HandleFunc("/query/", evhttp.NamedQueryHandler(s, queries, "/query/"))
+	do := func(method, u, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, u, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPut, "/queries/by-color", `{"query":"foo{color: $color}","params":[{"name":"color"}]}`)
+	assert.Equal(t, rec.Code, http.StatusOK)
+	assert.Equal(t, queries["by-color"].Query, `foo{color: $color}`)
+	rec = do(http.MethodPut, "/queries/invalid", `{"query":"foo{color: $colour}","params":[{"name":"color"}]}`)
+	assert.Equal(t, rec.Code, http.StatusBadRequest)
+	rec = do(http.MethodPut, "/queries/reserved", `{"query":"foo{color: $step}","params":[{"name":"step"}]}`)
+	assert.Equal(t, rec.Code, http.StatusBadRequest)
+	rec = do(http.MethodGet, "/queries/", "")
+	assert.Equal(t, rec.Code, http.StatusOK)
+	var saved []evql.SavedQuery
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &saved))
+	assert.Equal(t, saved, []evql.SavedQuery{{
+		Name:   "by-color",
+		Query:  `foo{color: $color}`,
+		Params: []evql.Param{{Name: "color"}},
+	}})
+
+	tr := evdb.TimeRange{
+		Start: now.Add(-time.Hour),
+		End:   now,
+		Step:  time.Hour,
+	}
+	values := url.Values{}
+	evhttp.EncodeTimeRange(values, tr)
+	values.Set("color", "blue")
+	rec = do(http.MethodGet, "/query/by-color?"+values.Encode(), "")
+	assert.Equal(t, rec.Code, http.StatusOK)
+	var results []evdb.Results
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, len(results[0]), 1)
+	color, _ := results[0][0].Fields.Get("color")
+	assert.Equal(t, color, "blue")
+	rec = do(http.MethodGet, "/query/missing?"+values.Encode(), "")
+	assert.Equal(t, rec.Code, http.StatusNotFound)
+
+	rec = do(http.MethodDelete, "/queries/by-color", "")
+	assert.Equal(t, rec.Code, http.StatusNoContent)
+	rec = do(http.MethodGet, "/queries/by-color", "")
+	assert.Equal(t, rec.Code, http.StatusNotFound)
+}
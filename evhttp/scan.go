@@ -40,6 +40,11 @@ func (s *Querier) Query(ctx context.Context, q *evdb.Query) (evdb.Results, error
 func QueryHandler(scan evdb.Scanner) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var queries []evdb.Query
+		timeout, err := TimeoutFromURL(r.URL.Query())
+		if err != nil {
+			httperr.RespondJSON(w, httperr.BadRequest(err))
+			return
+		}
 		switch r.Method {
 		case http.MethodGet:
 			values := r.URL.Query()
@@ -67,6 +72,13 @@ func QueryHandler(scan evdb.Scanner) http.HandlerFunc {
 					httperr.RespondJSON(w, httperr.BadRequest(err))
 					return
 				}
+				if _, ok := values["timeout"]; ok {
+					timeout, err = TimeoutFromURL(values)
+					if err != nil {
+						httperr.RespondJSON(w, httperr.BadRequest(err))
+						return
+					}
+				}
 				q, err := QueryFromURL(values)
 				if err != nil {
 					httperr.RespondJSON(w, httperr.BadRequest(err))
@@ -89,9 +101,12 @@ func QueryHandler(scan evdb.Scanner) http.HandlerFunc {
 			return
 		}
 
-		results, err := scan.Scan(r.Context(), queries...)
+		ctx, cancel := withTimeout(r.Context(), timeout)
+		defer cancel()
+		results, err := scan.Scan(ctx, queries...)
 		if err != nil {
-			httperr.RespondJSON(w, httperr.InternalServerError(err))
+			httperr.RespondJSON(w, scanError(err))
+			return
 		}
 
 		httperr.RespondJSON(w, results)
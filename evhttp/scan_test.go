@@ -1,7 +1,11 @@
 package evhttp_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -63,6 +67,26 @@ func TestScan(t *testing.T) {
 		})
 
 	}
+	{
+		q := q
+		q.Fields = evdb.MatchFields{
+			"color": evdb.Matchers{evdb.MatchAny("blue", "green"), evdb.MatchPrefix("bl")},
+			"taste": evdb.MatchNot{Matcher: evdb.MatchString("sweet")},
+		}
+		results, err := scan.Query(ctx, &q)
+		assert.NoError(t, err)
+		assert.Equal(t, len(results), 1)
+		data, err := json.Marshal(&q)
+		assert.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/scan", bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, rec.Code, http.StatusOK)
+		var posted evdb.Results
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &posted))
+		assert.Equal(t, posted, results)
+	}
 	{
 
 		results, err := scan.Query(ctx, &q)
@@ -0,0 +1,283 @@
+package evhttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/evql"
+	"github.com/alxarch/evdb/evutil"
+	"github.com/alxarch/httperr"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	// subscribeBuffer is the number of pending snapshots of a subscription before snapshots are dropped
+	subscribeBuffer = 64
+	// subscribePing is the interval of keep alive comments
+	subscribePing = 30 * time.Second
+	// defaultSubscribeStep is the step of subscriptions without a step param
+	defaultSubscribeStep = time.Minute
+)
+
+// SubscribeHandler returns an HTTP endpoint streaming live results as server-sent events.
+//
+// Subscriptions to an `event` with `match.*` params receive the results of each snapshot as it is stored.
+// Subscriptions to an evql `query` receive the query results over the last `range` each time
+// snapshots of the query events are stored. Results are sent as `results` events with JSON data.
+func SubscribeHandler(scanner evdb.Scanner, hub *evutil.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			httperr.RespondJSON(w, httperr.MethodNotAllowed(nil))
+			return
+		}
+		values := r.URL.Query()
+		step := defaultSubscribeStep
+		if v := values.Get("step"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < time.Second {
+				httperr.RespondJSON(w, httperr.BadRequest(errors.Errorf("Invalid step %q", v)))
+				return
+			}
+			step = d
+		}
+		var sub subscription
+		if query := values.Get("query"); query != "" {
+			e, err := evql.Parse(query)
+			if err != nil {
+				httperr.RespondJSON(w, httperr.BadRequest(err))
+				return
+			}
+			window := step
+			if v := values.Get("range"); v != "" {
+				if window, err = time.ParseDuration(v); err != nil || window < step {
+					httperr.RespondJSON(w, httperr.BadRequest(errors.Errorf("Invalid range %q", v)))
+					return
+				}
+			}
+			sub = &querySubscription{
+				scanner: scanner,
+				query:   e,
+				step:    step,
+				window:  window,
+			}
+		} else {
+			fields, err := MatchFieldsFromURL(values)
+			if err != nil {
+				httperr.RespondJSON(w, httperr.BadRequest(err))
+				return
+			}
+			q := evdb.Query{
+				Event:     values.Get("event"),
+				Fields:    fields,
+				TimeRange: evdb.TimeRange{Step: step},
+			}
+			if q.Event == "" {
+				httperr.RespondJSON(w, httperr.BadRequest(errors.New("Missing event or query")))
+				return
+			}
+			sub = &eventSubscription{query: q}
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			httperr.RespondJSON(w, httperr.InternalServerError(errors.New("Streaming not supported")))
+			return
+		}
+		stream := eventStream{w: w, flusher: flusher}
+		ctx, cancel := streamContext(r.Context())
+		defer cancel()
+		if err := sub.Run(ctx, hub, &stream); err != nil && !stream.started {
+			httperr.RespondJSON(w, err)
+		}
+	}
+}
+
+type shutdownKey struct{}
+
+// WithShutdown returns a context that ends the event streams of requests when done is closed.
+// Use it as the BaseContext of an http.Server and close done on shutdown,
+// as http.Server.Shutdown waits for event streams without cancelling them.
+func WithShutdown(ctx context.Context, done <-chan struct{}) context.Context {
+	return context.WithValue(ctx, shutdownKey{}, done)
+}
+
+// streamContext returns a context for an event stream that is cancelled on shutdown
+func streamContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if done, ok := ctx.Value(shutdownKey{}).(<-chan struct{}); ok {
+		go func() {
+			select {
+			case <-done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	return ctx, cancel
+}
+
+type subscription interface {
+	Run(ctx context.Context, hub *evutil.Hub, stream *eventStream) error
+}
+
+// eventStream writes server-sent events
+type eventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	started bool
+}
+
+// Start sends the response headers, subscriptions start the stream once they are subscribed
+func (s *eventStream) Start() {
+	s.w.Header().Set("Content-Type", "text/event-stream")
+	s.w.Header().Set("Cache-Control", "no-cache")
+	s.w.WriteHeader(http.StatusOK)
+	s.flusher.Flush()
+	s.started = true
+}
+
+// Send sends an event with JSON data
+func (s *eventStream) Send(event string, x interface{}) error {
+	data, err := json.Marshal(x)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// Ping sends a comment to keep the connection alive
+func (s *eventStream) Ping() error {
+	if _, err := s.w.Write([]byte(": ping\n\n")); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// eventSubscription streams the results of each snapshot of an event
+type eventSubscription struct {
+	query evdb.Query
+}
+
+func (s *eventSubscription) Run(ctx context.Context, hub *evutil.Hub, stream *eventStream) error {
+	sub := hub.Subscribe(s.query.Event, subscribeBuffer)
+	defer sub.Close()
+	stream.Start()
+	ping := time.NewTicker(subscribePing)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ping.C:
+			if err := stream.Ping(); err != nil {
+				return err
+			}
+		case snapshot := <-sub.C:
+			results := evutil.SnapshotResults(nil, &s.query, snapshot)
+			if len(results) == 0 {
+				continue
+			}
+			tm := snapshot.Time.Truncate(s.query.Step)
+			for i := range results {
+				results[i].TimeRange = evdb.TimeRange{
+					Start: tm,
+					End:   tm.Add(s.query.Step),
+					Step:  s.query.Step,
+				}
+			}
+			if err := stream.Send("results", results); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// querySubscription streams the results of an evql query when snapshots of its events are stored
+type querySubscription struct {
+	scanner evdb.Scanner
+	query   *evql.Query
+	step    time.Duration
+	window  time.Duration
+}
+
+func (s *querySubscription) Run(ctx context.Context, hub *evutil.Hub, stream *eventStream) error {
+	events := make(map[string]bool)
+	for _, q := range s.query.Queries(evdb.TimeRange{Step: s.step}) {
+		events[q.Event] = true
+	}
+	if len(events) == 0 {
+		return httperr.BadRequest(errors.New("Empty query"))
+	}
+	// Coalesce updates while the query is running
+	updates := make(chan struct{}, 1)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for event := range events {
+		sub := hub.Subscribe(event, 1)
+		defer sub.Close()
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case _, ok := <-sub.C:
+					if !ok {
+						return
+					}
+					select {
+					case updates <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}()
+	}
+	stream.Start()
+	ping := time.NewTicker(subscribePing)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ping.C:
+			if err := stream.Ping(); err != nil {
+				return err
+			}
+		case <-updates:
+			end := time.Now()
+			t := evdb.TimeRange{
+				Start: end.Add(-s.window),
+				End:   end,
+				Step:  s.step,
+			}
+			results, err := s.scanner.Scan(ctx, s.query.Queries(t)...)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				err = errors.Errorf("Query evaluation failed: %w", err)
+				if err := stream.Send("error", err.Error()); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := stream.Send("results", s.query.Eval(nil, t, results)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// isEventStream checks if a request accepts server-sent events
+func isEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
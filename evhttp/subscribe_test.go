@@ -0,0 +1,108 @@
+package evhttp_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/events"
+	"github.com/alxarch/evdb/evhttp"
+	"github.com/alxarch/evdb/evutil"
+	"github.com/alxarch/evdb/internal/assert"
+)
+
+func TestSubscribeHandler(t *testing.T) {
+	mem := evutil.NewMemoryStore("foo")
+	h := evhttp.MaxTimeout(evhttp.DefaultMux(mem, mem), time.Millisecond)
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	remote, err := evdb.Open(srv.URL)
+	assert.NoError(t, err)
+	foo, err := remote.Storer("foo")
+	assert.NoError(t, err)
+
+	for _, tc := range []struct {
+		Params string
+		Want   float64
+	}{
+		{"event=foo&match.color=red&step=1s", 2},
+		// Query results include the snapshot stored for the previous subscription
+		{"query=" + url.QueryEscape(`foo{color:red}; foo{color:blue}`) + "&step=1s&range=1h", 4},
+	} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/subscribe?"+tc.Params, nil)
+		assert.NoError(t, err)
+		req.Header.Set("Accept", "text/event-stream")
+		res, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, res.StatusCode, http.StatusOK)
+		assert.Equal(t, res.Header.Get("Content-Type"), "text/event-stream")
+		err = foo.Store(&evdb.Snapshot{
+			Time:   time.Now(),
+			Labels: []string{"color"},
+			Counters: []events.Counter{
+				{Count: 1, Values: []string{"blue"}},
+				{Count: 2, Values: []string{"red"}},
+			},
+		})
+		assert.NoError(t, err)
+		lines := bufio.NewScanner(res.Body)
+		assert.OK(t, lines.Scan(), "Read event")
+		assert.Equal(t, lines.Text(), "event: results")
+		assert.OK(t, lines.Scan(), "Read data")
+		data := strings.TrimPrefix(lines.Text(), "data: ")
+		var results evdb.Results
+		if strings.HasPrefix(data, "[[") {
+			var rows []evdb.Results
+			assert.NoError(t, json.Unmarshal([]byte(data), &rows))
+			assert.Equal(t, len(rows), 2)
+			results = rows[0]
+		} else {
+			assert.NoError(t, json.Unmarshal([]byte(data), &results))
+		}
+		assert.Equal(t, len(results), 1)
+		assert.Equal(t, results[0].Data.Sum(), tc.Want)
+		res.Body.Close()
+	}
+
+	res, err := http.Get(srv.URL + "/subscribe?step=1s")
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusBadRequest)
+}
+
+func TestSubscribeHandler_Shutdown(t *testing.T) {
+	mem := evutil.NewMemoryStore("foo")
+	done := make(chan struct{})
+	srv := httptest.NewUnstartedServer(evhttp.DefaultMux(mem, mem))
+	srv.Config.BaseContext = func(net.Listener) context.Context {
+		return evhttp.WithShutdown(context.Background(), done)
+	}
+	srv.Start()
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/subscribe?event=foo&step=1s")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	close(done)
+	eof := make(chan error, 1)
+	go func() {
+		_, err := ioutil.ReadAll(res.Body)
+		eof <- err
+	}()
+	select {
+	case err := <-eof:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Stream not closed on shutdown")
+	}
+}
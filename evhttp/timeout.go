@@ -0,0 +1,65 @@
+package evhttp
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/httperr"
+	errors "golang.org/x/xerrors"
+)
+
+// TimeoutFromURL parses the `timeout` URL query param as a duration
+func TimeoutFromURL(values url.Values) (time.Duration, error) {
+	v := values.Get("timeout")
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, errors.Errorf("Invalid timeout %q", v)
+	}
+	return d, nil
+}
+
+// withTimeout sets a deadline on a context if timeout is positive.
+// A deadline already set on the context is kept if it is sooner.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// MaxTimeout sets a deadline on the context of all requests handled by h.
+// Query handlers abort scans once the deadline is exceeded, requests can use
+// a shorter deadline with the `timeout` URL query param.
+// Requests accepting server-sent events are long-lived and have no deadline.
+func MaxTimeout(h http.Handler, timeout time.Duration) http.Handler {
+	if timeout <= 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isEventStream(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// scanError sets the HTTP status code of a scan error
+func scanError(err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return httperr.New(http.StatusGatewayTimeout, err)
+	case errors.Is(err, evdb.ErrScanLimit):
+		return httperr.BadRequest(err)
+	default:
+		return httperr.InternalServerError(err)
+	}
+}
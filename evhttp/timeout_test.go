@@ -0,0 +1,57 @@
+package evhttp_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/evhttp"
+	"github.com/alxarch/evdb/internal/assert"
+	errors "golang.org/x/xerrors"
+)
+
+type scannerFunc func(ctx context.Context, queries ...evdb.Query) (evdb.Results, error)
+
+func (fn scannerFunc) Scan(ctx context.Context, queries ...evdb.Query) (evdb.Results, error) {
+	return fn(ctx, queries...)
+}
+
+func TestQueryTimeout(t *testing.T) {
+	var deadline time.Time
+	scan := scannerFunc(func(ctx context.Context, _ ...evdb.Query) (evdb.Results, error) {
+		deadline, _ = ctx.Deadline()
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	limit := scannerFunc(func(ctx context.Context, _ ...evdb.Query) (evdb.Results, error) {
+		return nil, errors.Errorf("Too many keys: %w", evdb.ErrScanLimit)
+	})
+	tests := []struct {
+		handler  http.Handler
+		url      string
+		wantCode int
+	}{
+		{evhttp.QueryHandler(scan), "/scan?event=foo&start=1&end=2&step=1s&timeout=10ms", http.StatusGatewayTimeout},
+		{evhttp.QueryHandler(scan), "/scan?event=foo&start=1&end=2&step=1s&timeout=foo", http.StatusBadRequest},
+		{evhttp.QueryHandler(limit), "/scan?event=foo&start=1&end=2&step=1s", http.StatusBadRequest},
+		{evhttp.ExecHandler(scan), "/query?query=foo&start=1&end=2&step=1s&timeout=10ms", http.StatusGatewayTimeout},
+		{evhttp.ExecHandler(scan), "/query?query=foo&start=1&end=2&step=1s&timeout=-1s", http.StatusBadRequest},
+		{evhttp.MaxTimeout(evhttp.ExecHandler(scan), 10*time.Millisecond), "/query?query=foo&start=1&end=2&step=1s&timeout=1h", http.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			deadline = time.Time{}
+			start := time.Now()
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rec, req)
+			assert.Equal(t, rec.Code, tt.wantCode)
+			if !deadline.IsZero() && deadline.Sub(start) > time.Second {
+				t.Errorf("Invalid deadline %s", deadline.Sub(start))
+			}
+		})
+	}
+}
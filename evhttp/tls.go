@@ -0,0 +1,67 @@
+package evhttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+
+	errors "golang.org/x/xerrors"
+)
+
+// ServerTLSConfig creates a TLS config for serving with a certificate.
+// If clientCAFile is not empty clients must present a certificate signed by one of its CAs.
+func ServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCAFile != "" {
+		pool, err := loadCertPool(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return &config, nil
+}
+
+// ClientTLSConfig creates a TLS config for clients.
+// If caFile is not empty server certificates are verified using its CAs instead of the system's.
+// If certFile and keyFile are not empty the certificate is presented to servers.
+func ClientTLSConfig(caFile, certFile, keyFile string, insecure bool) (*tls.Config, error) {
+	config := tls.Config{
+		InsecureSkipVerify: insecure,
+	}
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return &config, nil
+}
+
+func loadCertPool(filename string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.Errorf("No PEM certificates in %s", filename)
+	}
+	return pool, nil
+}
@@ -0,0 +1,65 @@
+package evhttp_test
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/evhttp"
+	"github.com/alxarch/evdb/evutil"
+	"github.com/alxarch/evdb/internal/assert"
+)
+
+func TestTLS(t *testing.T) {
+	db := &healthDB{MemoryStore: evutil.NewMemoryStore("foo")}
+	srv := httptest.NewTLSServer(evhttp.DefaultMux(db, db))
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "evhttp")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	ca := filepath.Join(dir, "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	assert.NoError(t, ioutil.WriteFile(ca, data, 0600))
+
+	ctx := context.Background()
+	remote, err := evdb.Open(srv.URL)
+	assert.NoError(t, err)
+	assert.OK(t, evdb.Health(ctx, remote) != nil, "Unknown CA is rejected")
+	remote, err = evdb.Open(srv.URL + "?ca=" + ca)
+	assert.NoError(t, err)
+	assert.NoError(t, evdb.Health(ctx, remote))
+	remote, err = evdb.Open(srv.URL + "?insecure=true")
+	assert.NoError(t, err)
+	assert.NoError(t, evdb.Health(ctx, remote))
+}
+
+func TestH2C(t *testing.T) {
+	var proto int
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto = r.ProtoMajor
+	}))
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetHTTP1(true)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	defer srv.Close()
+	ctx := context.Background()
+	for _, tc := range []struct {
+		URL   string
+		Proto int
+	}{
+		{srv.URL, 1},
+		{srv.URL + "?h2c=true", 2},
+	} {
+		remote, err := evdb.Open(tc.URL)
+		assert.NoError(t, err)
+		assert.NoError(t, evdb.Health(ctx, remote))
+		assert.Equal(t, proto, tc.Proto)
+	}
+}
@@ -94,31 +94,57 @@ func MatchFieldsFromURL(values url.Values) (m evdb.MatchFields, err error) {
 			continue
 		}
 		label := strings.TrimPrefix(key, "match.")
+		negate := false
+		for strings.HasPrefix(strings.ToLower(label), "not.") {
+			label, negate = label[len("not."):], !negate
+		}
 		var typ string
 		if parts := strings.SplitN(label, ".", 2); len(parts) == 2 {
 			label, typ = parts[1], parts[0]
 		}
+		var matcher evdb.Matcher
 		switch strings.ToLower(typ) {
 		case "regexp":
 			rx, err := regexp.Compile(values.Get(key))
 			if err != nil {
 				return nil, errors.Errorf("Invalid query.%s: %s", key, err)
 			}
-			m[label] = rx
+			matcher = rx
 		case "suffix":
-			m[label] = evdb.MatchSuffix(values.Get(key))
+			matcher = evdb.MatchSuffix(values.Get(key))
 		case "prefix":
-			m[label] = evdb.MatchPrefix(values.Get(key))
+			matcher = evdb.MatchPrefix(values.Get(key))
 		case "equals":
-			m[label] = evdb.MatchString(values.Get(key))
+			matcher = evdb.MatchString(values.Get(key))
+		case "any":
+			matcher = evdb.MatchAny(values[key]...)
+		case "json":
+			matcher, err = evdb.UnmarshalMatcher([]byte(values.Get(key)))
+			if err != nil {
+				return nil, errors.Errorf("Invalid query.%s: %s", key, err)
+			}
+			if matcher == nil {
+				continue
+			}
+		case "present":
+			matcher = evdb.MatchPresent()
+		case "absent":
+			matcher = evdb.MatchAbsent()
 		case "":
-			m[label] = evdb.MatchAny(values[key]...)
+			if v := values[key]; len(v) == 1 {
+				matcher = evdb.MatchString(v[0])
+			} else {
+				matcher = evdb.MatchAny(v...)
+			}
 		default:
 			return nil, errors.Errorf("Invalid match type %q", typ)
 		}
+		if negate {
+			matcher = evdb.MatchNot{Matcher: matcher}
+		}
+		m[label] = matcher
 	}
 	return
-
 }
 
 // EncodeTimeRange sets URL query values for a TimeRange
@@ -140,17 +166,8 @@ func EncodeQuery(values url.Values, q *evdb.Query) error {
 		return errors.Errorf("Nil query")
 	}
 	for label, m := range q.Fields {
-		switch m := m.(type) {
-		case *regexp.Regexp:
-			values.Set("match.regexp."+label, m.String())
-		case evdb.MatchSuffix:
-			values.Set("match.suffix."+label, string(m))
-		case evdb.MatchPrefix:
-			values.Set("match.prefix."+label, string(m))
-		case evdb.MatchString:
-			values.Set("match."+label, string(m))
-		default:
-			return errors.Errorf("Cannot convert %q matcher to query", label)
+		if err := encodeMatcher(values, "match.", label, m); err != nil {
+			return err
 		}
 	}
 	EncodeTimeRange(values, q.TimeRange)
@@ -160,6 +177,30 @@ func EncodeQuery(values url.Values, q *evdb.Query) error {
 	return nil
 }
 
+func encodeMatcher(values url.Values, prefix, label string, m evdb.Matcher) error {
+	switch m := m.(type) {
+	case evdb.MatchNot:
+		return encodeMatcher(values, prefix+"not.", label, m.Matcher)
+	case *regexp.Regexp:
+		values.Set(prefix+"regexp."+label, m.String())
+	case evdb.MatchSuffix:
+		values.Set(prefix+"suffix."+label, string(m))
+	case evdb.MatchPrefix:
+		values.Set(prefix+"prefix."+label, string(m))
+	case evdb.MatchString:
+		values.Set(prefix+label, string(m))
+	case evdb.MatchValues:
+		values[prefix+"any."+label] = append([]string(nil), m...)
+	default:
+		data, err := evdb.MarshalMatcher(m)
+		if err != nil {
+			return errors.Errorf("Cannot convert %q matcher to query: %s", label, err)
+		}
+		values.Set(prefix+"json."+label, string(data))
+	}
+	return nil
+}
+
 // ParseTime parses time in various formats
 func ParseTime(v string) (time.Time, error) {
 	if strings.Contains(v, ":") {
@@ -65,6 +65,28 @@ func TestQueryFromURL(t *testing.T) {
 				"foo": regexp.MustCompile("bar.*"),
 			},
 		}, false},
+		{"start=2019-08-01&end=2019-08-02&step=1h0m0s&event=win&match.foo=bar", evdb.Query{
+			TimeRange: tr,
+			Event:     "win",
+			Fields: evdb.MatchFields{
+				"foo": evdb.MatchString("bar"),
+			},
+		}, false},
+		{"start=2019-08-01&end=2019-08-02&step=1h0m0s&event=win&match.not.prefix.foo=bar", evdb.Query{
+			TimeRange: tr,
+			Event:     "win",
+			Fields: evdb.MatchFields{
+				"foo": evdb.MatchNot{Matcher: evdb.MatchPrefix("bar")},
+			},
+		}, false},
+		{"start=2019-08-01&end=2019-08-02&step=1h0m0s&event=win&match.present.foo=&match.absent.bar=", evdb.Query{
+			TimeRange: tr,
+			Event:     "win",
+			Fields: evdb.MatchFields{
+				"foo": evdb.MatchPresent(),
+				"bar": evdb.MatchAbsent(),
+			},
+		}, false},
 		{`start=2019-08-01&end=2019-08-02&step=1h&event=win&match.regexp.foo=bar%28foo`, evdb.Query{
 			TimeRange: tr,
 		}, true},
@@ -103,7 +125,7 @@ func TestEncodeQuery(t *testing.T) {
 		wantErr bool
 	}{
 		{"", nil, true},
-		{"end=1564704000&event=win&match.regexp.foo=%5E%28bar%7Cbaz%29%24&start=1564617600&step=1h0m0s", &evdb.Query{
+		{"end=1564704000&event=win&match.any.foo=bar&match.any.foo=baz&start=1564617600&step=1h0m0s", &evdb.Query{
 			TimeRange: tr,
 			Event:     "win",
 			Fields: evdb.MatchFields{
@@ -138,6 +160,21 @@ func TestEncodeQuery(t *testing.T) {
 				"foo": regexp.MustCompile("bar.*"),
 			},
 		}, false},
+		{"end=1564704000&event=win&match.not.foo=bar&match.not.regexp.bar=bar.%2A&start=1564617600&step=1h0m0s", &evdb.Query{
+			TimeRange: tr,
+			Event:     "win",
+			Fields: evdb.MatchFields{
+				"foo": evdb.MatchNot{Matcher: evdb.MatchString("bar")},
+				"bar": evdb.MatchNot{Matcher: regexp.MustCompile("bar.*")},
+			},
+		}, false},
+		{"end=1564704000&event=win&match.json.foo=%7B%22or%22%3A%5B%7B%22prefix%22%3A%22bar%22%7D%2C%7B%22any%22%3A%5B%22baz%22%5D%7D%5D%7D&start=1564617600&step=1h0m0s", &evdb.Query{
+			TimeRange: tr,
+			Event:     "win",
+			Fields: evdb.MatchFields{
+				"foo": evdb.Matchers{evdb.MatchPrefix("bar"), evdb.MatchAny("baz")},
+			},
+		}, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.wantStr, func(t *testing.T) {
@@ -148,7 +185,17 @@ func TestEncodeQuery(t *testing.T) {
 			}
 			if s := values.Encode(); s != tt.wantStr {
 				t.Errorf("EncodeQuery() = %s, want %s", s, tt.wantStr)
-
+			}
+			if tt.q == nil {
+				return
+			}
+			q, err := QueryFromURL(values)
+			if err != nil {
+				t.Errorf("QueryFromURL() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(q.Fields, tt.q.Fields) {
+				t.Errorf("QueryFromURL() = %v, want %v", q.Fields, tt.q.Fields)
 			}
 		})
 	}
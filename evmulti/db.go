@@ -0,0 +1,186 @@
+package evmulti
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/evutil"
+	errors "golang.org/x/xerrors"
+)
+
+// defaultRetryAfter is the default time a failed DB is skipped by scans
+const defaultRetryAfter = 30 * time.Second
+
+// DB replicates writes to multiple DBs and scans from the first healthy one.
+//
+// Scans read from a single DB so they only see all acknowledged writes if every write
+// succeeds on every DB, which is the default quorum. With a lower quorum a DB that failed
+// some writes serves scans missing those snapshots until it is repaired, ie by restoring
+// a backup of another DB. OnStoreError reports such writes.
+type DB struct {
+	// RetryAfter is the time a DB is skipped by scans after an error
+	RetryAfter time.Duration
+	// OnStoreError is called with the index of a DB that failed to store a snapshot,
+	// including writes that still reached quorum. It is called concurrently for DBs failing the same write.
+	// Errors are logged if it is nil.
+	OnStoreError func(i int, err error)
+
+	dbs    []evdb.DB
+	quorum int
+
+	mu       sync.Mutex
+	failedAt []time.Time
+}
+
+var _ evdb.DB = (*DB)(nil)
+
+// Open creates a DB over dbs.
+// Writes fail if they do not succeed on at least quorum DBs, a quorum less than 1 requires all DBs.
+func Open(quorum int, dbs ...evdb.DB) *DB {
+	return &DB{
+		RetryAfter: defaultRetryAfter,
+		dbs:        dbs,
+		quorum:     quorum,
+		failedAt:   make([]time.Time, len(dbs)),
+	}
+}
+
+// DBs returns the replicated DBs
+func (db *DB) DBs() []evdb.DB {
+	return db.dbs
+}
+
+// Storer implements evdb.Store interface
+func (db *DB) Storer(event string) (evdb.Storer, error) {
+	storers := make([]evdb.Storer, len(db.dbs))
+	for i := range db.dbs {
+		i, d := i, db.dbs[i]
+		// Resolve storers on each write so a DB that was down when the event was first stored is not skipped
+		storers[i] = evutil.StorerFunc(func(s *evdb.Snapshot) error {
+			w, err := d.Storer(event)
+			if err == nil {
+				err = w.Store(s)
+			}
+			if err != nil {
+				db.storeError(i, errors.Errorf("Failed to store %q to DB %d: %w", event, i, err))
+			}
+			return err
+		})
+	}
+	return evutil.QuorumStore(db.quorum, storers...), nil
+}
+
+func (db *DB) storeError(i int, err error) {
+	if db.OnStoreError != nil {
+		db.OnStoreError(i, err)
+		return
+	}
+	log.Println(err)
+}
+
+// Scan implements evdb.Scanner interface.
+// DBs are tried in order, skipping DBs that failed in the last RetryAfter unless all of them did.
+func (db *DB) Scan(ctx context.Context, queries ...evdb.Query) (evdb.Results, error) {
+	var lastErr error
+	for _, i := range db.scanOrder(time.Now()) {
+		results, err := db.dbs[i].Scan(ctx, queries...)
+		if err == nil {
+			db.setFailed(i, time.Time{})
+			return results, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		db.setFailed(i, time.Now())
+		lastErr = err
+	}
+	if lastErr == nil {
+		return nil, errors.New("No DBs to scan")
+	}
+	return nil, errors.Errorf("Scan failed on all DBs: %w", lastErr)
+}
+
+// EstimateBackends implements evdb.BackendEstimator interface.
+// Only the DB a scan would read first is estimated, backends are named by the index of the DB.
+func (db *DB) EstimateBackends(ctx context.Context, q *evdb.Query) ([]evdb.BackendEstimate, error) {
+	order := db.scanOrder(time.Now())
+	if len(order) == 0 {
+		return nil, nil
+	}
+	i := order[0]
+	estimates, err := evdb.EstimateBackends(ctx, db.dbs[i], q)
+	if err != nil {
+		return nil, err
+	}
+	return evdb.PrefixBackends(strconv.Itoa(i), estimates), nil
+}
+
+// scanOrder returns healthy DB indexes followed by the failed ones
+func (db *DB) scanOrder(now time.Time) []int {
+	healthy := make([]int, 0, len(db.dbs))
+	var failed []int
+	db.mu.Lock()
+	for i, tm := range db.failedAt {
+		if !tm.IsZero() && now.Sub(tm) < db.RetryAfter {
+			failed = append(failed, i)
+		} else {
+			healthy = append(healthy, i)
+		}
+	}
+	db.mu.Unlock()
+	return append(healthy, failed...)
+}
+
+func (db *DB) setFailed(i int, tm time.Time) {
+	db.mu.Lock()
+	db.failedAt[i] = tm
+	db.mu.Unlock()
+}
+
+// Health implements evdb.HealthChecker interface.
+// A DB is healthy if writes to it can reach a quorum.
+func (db *DB) Health(ctx context.Context) error {
+	quorum := db.quorum
+	if quorum < 1 || quorum > len(db.dbs) {
+		quorum = len(db.dbs)
+	}
+	var (
+		healthy int
+		lastErr error
+	)
+	for _, d := range db.dbs {
+		if err := evdb.Health(ctx, d); err != nil {
+			lastErr = err
+			continue
+		}
+		healthy++
+	}
+	if healthy < quorum {
+		return errors.Errorf("%d of %d DBs are healthy, quorum is %d: %w", healthy, len(db.dbs), quorum, lastErr)
+	}
+	return nil
+}
+
+// ReportStats implements evdb.StatsReporter interface
+func (db *DB) ReportStats(stats map[string]interface{}) {
+	dbs := make([]map[string]interface{}, len(db.dbs))
+	for i, d := range db.dbs {
+		dbs[i] = evdb.Stats(d)
+	}
+	stats["dbs"] = dbs
+}
+
+// Close implements evdb.DB interface
+func (db *DB) Close() error {
+	var firstErr error
+	for _, d := range db.dbs {
+		if err := d.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
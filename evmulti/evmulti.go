@@ -0,0 +1,94 @@
+// Package evmulti provides an evdb backend replicating writes to multiple DBs
+package evmulti
+
+import (
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/alxarch/evdb"
+	errors "golang.org/x/xerrors"
+)
+
+type opener struct{}
+
+var _ evdb.Opener = opener{}
+
+// Open implements evdb.Opener interface
+func (opener) Open(configURL string) (evdb.DB, error) {
+	config, err := ParseURL(configURL)
+	if err != nil {
+		return nil, err
+	}
+	dbs := make([]evdb.DB, 0, len(config.URLs))
+	for _, u := range config.URLs {
+		db, err := evdb.Open(u)
+		if err != nil {
+			for _, db := range dbs {
+				db.Close()
+			}
+			return nil, errors.Errorf("Failed to open %s: %w", u, err)
+		}
+		dbs = append(dbs, db)
+	}
+	db := Open(config.Quorum, dbs...)
+	db.RetryAfter = config.RetryAfter
+	return db, nil
+}
+
+const urlScheme = "multi"
+
+func init() {
+	o := opener{}
+	if err := evdb.Register(urlScheme, o); err != nil {
+		log.Fatal("Failed to register db opener", err)
+	}
+}
+
+// Config is the configuration of a multi DB
+type Config struct {
+	URLs       []string
+	Quorum     int
+	RetryAfter time.Duration
+}
+
+// ParseURL parses a multi DB configuration URL.
+//
+// The URL has a `db` query param for each DB, ie `multi://?db=badger:///a&db=http://peer:8080`.
+// Param values containing '&' must be escaped.
+// The `quorum` param sets the number of DBs a write must succeed on, defaults to all.
+// Scans may miss writes that failed on some DBs with a lower quorum.
+// The `retry-after` param sets the time a DB is skipped by scans after an error, defaults to 30s.
+func ParseURL(configURL string) (*Config, error) {
+	u, err := url.Parse(configURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != urlScheme {
+		return nil, errors.Errorf(`Invalid scheme %q != %q`, u.Scheme, urlScheme)
+	}
+	q := u.Query()
+	config := Config{
+		URLs:       q["db"],
+		RetryAfter: defaultRetryAfter,
+	}
+	if len(config.URLs) == 0 {
+		return nil, errors.Errorf("No db params in %q", configURL)
+	}
+	if v := q.Get("quorum"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > len(config.URLs) {
+			return nil, errors.Errorf("Invalid quorum %q", v)
+		}
+		config.Quorum = n
+	}
+	if v := q.Get("retry-after"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, errors.Errorf("Invalid retry-after %q", v)
+		}
+		config.RetryAfter = d
+	}
+	return &config, nil
+}
@@ -0,0 +1,147 @@
+package evmulti_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/events"
+	"github.com/alxarch/evdb/evmulti"
+	"github.com/alxarch/evdb/evutil"
+	"github.com/alxarch/evdb/internal/assert"
+	errors "golang.org/x/xerrors"
+)
+
+type testDB struct {
+	evutil.MemoryStore
+	down  bool
+	scans int
+}
+
+var errDown = errors.New("DB is down")
+
+func (db *testDB) Storer(event string) (evdb.Storer, error) {
+	if db.down {
+		return nil, errDown
+	}
+	return db.MemoryStore.Storer(event)
+}
+
+func (db *testDB) Scan(ctx context.Context, queries ...evdb.Query) (evdb.Results, error) {
+	db.scans++
+	if db.down {
+		return nil, errDown
+	}
+	return db.MemoryStore.Scan(ctx, queries...)
+}
+
+func (db *testDB) Estimate(_ context.Context, q *evdb.Query) (int64, error) {
+	return int64(db.MemoryStore[q.Event].Len()), nil
+}
+
+func (db *testDB) Close() error {
+	return nil
+}
+
+func TestParseURL(t *testing.T) {
+	for _, tc := range []struct {
+		URL    string
+		Config *evmulti.Config
+		OK     bool
+	}{
+		{"multi://?db=badger:///a&db=http://peer:8080", &evmulti.Config{
+			URLs:       []string{"badger:///a", "http://peer:8080"},
+			RetryAfter: 30 * time.Second,
+		}, true},
+		{"multi://?db=badger:///a&db=badger:///b&quorum=1&retry-after=1m", &evmulti.Config{
+			URLs:       []string{"badger:///a", "badger:///b"},
+			Quorum:     1,
+			RetryAfter: time.Minute,
+		}, true},
+		{"multi://", nil, false},
+		{"multi://?db=badger:///a&quorum=2", nil, false},
+		{"redis://?db=badger:///a", nil, false},
+	} {
+		config, err := evmulti.ParseURL(tc.URL)
+		if tc.OK {
+			assert.NoError(t, err)
+			assert.Equal(t, config, tc.Config)
+		} else {
+			assert.OK(t, err != nil, "Invalid URL %q", tc.URL)
+		}
+	}
+}
+
+func TestDB(t *testing.T) {
+	a := &testDB{MemoryStore: evutil.NewMemoryStore("foo")}
+	b := &testDB{MemoryStore: evutil.NewMemoryStore("foo")}
+	db := evmulti.Open(1, a, b)
+	var (
+		mu     sync.Mutex
+		failed = make(map[int]int)
+	)
+	db.OnStoreError = func(i int, err error) {
+		assert.OK(t, errors.Is(err, errDown), "Store error %v", err)
+		mu.Lock()
+		failed[i]++
+		mu.Unlock()
+	}
+	now := time.Now()
+	snap := evdb.Snapshot{
+		Time:     now,
+		Labels:   []string{"color"},
+		Counters: []events.Counter{{Values: []string{"blue"}, Count: 3}},
+	}
+	w, err := db.Storer("foo")
+	assert.NoError(t, err)
+	assert.NoError(t, w.Store(&snap))
+	assert.Equal(t, len(failed), 0)
+	a.down = true
+	snap.Time = now.Add(time.Second)
+	assert.NoError(t, w.Store(&snap))
+	// Failed writes that reach quorum are reported
+	assert.Equal(t, failed, map[int]int{0: 1})
+	b.down = true
+	snap.Time = now.Add(2 * time.Second)
+	assert.OK(t, w.Store(&snap) != nil, "Store without quorum fails")
+	assert.Equal(t, failed, map[int]int{0: 2, 1: 1})
+	b.down = false
+
+	ctx := context.Background()
+	q := evdb.Query{
+		Event: "foo",
+		TimeRange: evdb.TimeRange{
+			Start: now.Add(-time.Minute),
+			End:   now.Add(time.Minute),
+			Step:  -1,
+		},
+	}
+	results, err := db.Scan(ctx, q)
+	assert.NoError(t, err)
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, results[0].Data.Sum(), 6.0)
+	assert.Equal(t, a.scans, 1)
+	assert.Equal(t, b.scans, 1)
+	// Failed DBs are skipped until RetryAfter
+	_, err = db.Scan(ctx, q)
+	assert.NoError(t, err)
+	assert.Equal(t, a.scans, 1)
+	assert.Equal(t, b.scans, 2)
+	// Only the DB scans read from is estimated
+	estimates, err := evdb.EstimateBackends(ctx, db, &q)
+	assert.NoError(t, err)
+	assert.Equal(t, estimates, []evdb.BackendEstimate{{Backend: "1", Rows: 2}})
+	db.RetryAfter = 0
+	a.down = false
+	results, err = db.Scan(ctx, q)
+	assert.NoError(t, err)
+	assert.Equal(t, a.scans, 2)
+	assert.Equal(t, results[0].Data.Sum(), 3.0)
+
+	b.down = true
+	a.down = true
+	_, err = db.Scan(ctx, q)
+	assert.OK(t, errors.Is(err, errDown), "Scan fails on all DBs")
+}
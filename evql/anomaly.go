@@ -0,0 +1,201 @@
+package evql
+
+import (
+	"math"
+
+	errors "golang.org/x/xerrors"
+)
+
+// anomalyParams are the keyword arguments of each anomaly function and their defaults.
+// All functions accept a threshold `k`, steps scoring |k| or more are flagged with 1, others with 0.
+var anomalyParams = map[string]map[string]float64{
+	"zscore":      {"k": 0},
+	"ewma":        {"k": 0, "alpha": 0.3},
+	"holtwinters": {"k": 0, "alpha": 0.5, "beta": 0.1, "gamma": 0.1, "season": 0},
+	"baseline":    {"k": 0},
+}
+
+// anomalyModel computes the expected value of each step of a series.
+// Steps without an expected value are NaN.
+type anomalyModel interface {
+	Expected(x []float64, baselines [][]float64) []float64
+}
+
+func newAnomalyModel(fn string, params map[string]float64) (anomalyModel, error) {
+	if k := params["k"]; k < 0 {
+		return nil, errors.Errorf("Invalid threshold %g", k)
+	}
+	switch fn {
+	case "zscore":
+		return zscoreModel{}, nil
+	case "baseline":
+		return baselineModel{}, nil
+	case "ewma":
+		alpha := params["alpha"]
+		if !(0 < alpha && alpha <= 1) {
+			return nil, errors.Errorf("Invalid alpha %g", alpha)
+		}
+		return holtWintersModel{Alpha: alpha}, nil
+	case "holtwinters":
+		m := holtWintersModel{
+			Alpha:  params["alpha"],
+			Beta:   params["beta"],
+			Gamma:  params["gamma"],
+			Season: int(params["season"]),
+		}
+		if !(0 < m.Alpha && m.Alpha <= 1) {
+			return nil, errors.Errorf("Invalid alpha %g", m.Alpha)
+		}
+		if !(0 <= m.Beta && m.Beta <= 1) {
+			return nil, errors.Errorf("Invalid beta %g", m.Beta)
+		}
+		if !(0 <= m.Gamma && m.Gamma <= 1) {
+			return nil, errors.Errorf("Invalid gamma %g", m.Gamma)
+		}
+		if s := params["season"]; s != float64(m.Season) || m.Season < 0 || m.Season == 1 {
+			return nil, errors.Errorf("Invalid season %g", s)
+		}
+		return m, nil
+	default:
+		return nil, errors.Errorf("Invalid anomaly function %q", fn)
+	}
+}
+
+// zscoreModel expects the mean of the series
+type zscoreModel struct{}
+
+func (zscoreModel) Expected(x []float64, _ [][]float64) []float64 {
+	mean := nanMean(x...)
+	out := make([]float64, len(x))
+	for i := range out {
+		out[i] = mean
+	}
+	return out
+}
+
+// baselineModel expects the mean of the baseline series at each step
+type baselineModel struct{}
+
+func (baselineModel) Expected(x []float64, baselines [][]float64) []float64 {
+	out := make([]float64, len(x))
+	values := make([]float64, len(baselines))
+	for i := range out {
+		for j, b := range baselines {
+			values[j] = b[i]
+		}
+		out[i] = nanMean(values...)
+	}
+	return out
+}
+
+// holtWintersModel is additive triple exponential smoothing.
+// The expected value of a step is the forecast from all previous steps.
+// Without a season it is Holt's linear method and with a zero beta it is an EWMA.
+type holtWintersModel struct {
+	Alpha  float64
+	Beta   float64
+	Gamma  float64
+	Season int
+}
+
+func (m holtWintersModel) Expected(x []float64, _ [][]float64) []float64 {
+	out := make([]float64, len(x))
+	for i := range out {
+		out[i] = math.NaN()
+	}
+	level, trend := math.NaN(), 0.0
+	season := make([]float64, m.Season)
+	start := 0
+	if m.Season > 0 {
+		// Initialize level and seasonal components from the first season
+		start = m.Season
+		if start > len(x) {
+			start = len(x)
+		}
+		level = nanMean(x[:start]...)
+		for i, v := range x[:start] {
+			if !math.IsNaN(v) {
+				season[i] = v - level
+			}
+		}
+	}
+	for i := start; i < len(x); i++ {
+		v := x[i]
+		s := 0.0
+		if m.Season > 0 {
+			s = season[i%m.Season]
+		}
+		if math.IsNaN(level) {
+			// Level starts at the first value
+			if !math.IsNaN(v) {
+				level = v - s
+			}
+			continue
+		}
+		out[i] = level + trend + s
+		if math.IsNaN(v) {
+			level += trend
+			continue
+		}
+		prev := level
+		level = m.Alpha*(v-s) + (1-m.Alpha)*(level+trend)
+		trend = m.Beta*(level-prev) + (1-m.Beta)*trend
+		if m.Season > 0 {
+			season[i%m.Season] = m.Gamma*(v-level) + (1-m.Gamma)*s
+		}
+	}
+	return out
+}
+
+// anomalyScores replaces values with their deviation from the expected value
+// in units of the root mean square deviation of the series.
+// Steps without a value or an expected value score NaN.
+// If all deviations are zero all scores are zero.
+func anomalyScores(values, expected []float64) {
+	var sum, n float64
+	for i, v := range values {
+		d := v - expected[i]
+		values[i] = d
+		if !math.IsNaN(d) {
+			sum += d * d
+			n++
+		}
+	}
+	rms := math.Sqrt(sum / n)
+	for i, d := range values {
+		switch {
+		case math.IsNaN(d):
+		case rms == 0:
+			values[i] = 0
+		default:
+			values[i] = d / rms
+		}
+	}
+}
+
+// anomalyFlags replaces scores with 1 if |score| >= k and 0 otherwise, NaN scores are kept
+func anomalyFlags(scores []float64, k float64) {
+	for i, s := range scores {
+		switch {
+		case math.IsNaN(s):
+		case math.Abs(s) >= k:
+			scores[i] = 1
+		default:
+			scores[i] = 0
+		}
+	}
+}
+
+func nanMean(values ...float64) float64 {
+	var sum, n float64
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			sum += v
+			n++
+		}
+	}
+	if n == 0 {
+		return math.NaN()
+	}
+	return sum / n
+}
@@ -0,0 +1,254 @@
+package evql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	db "github.com/alxarch/evdb"
+)
+
+// Explain describes the scans and the evaluation steps of a query
+type Explain struct {
+	Queries []db.Query    `json:"queries"`
+	Rows    []RowEstimate `json:"rows"`
+	Tree    *ExplainNode  `json:"tree"`
+}
+
+// RowEstimate is the estimated size of a scan query result
+type RowEstimate struct {
+	Event string `json:"event"`
+	// Steps is the number of data points per result or -1 if the query has no step
+	Steps int `json:"steps"`
+	// Rows is the number of rows all backends will scan or -1 if unknown
+	Rows int64 `json:"rows"`
+	// Backends are the rows each backend will scan
+	Backends []db.BackendEstimate `json:"backends,omitempty"`
+}
+
+// ExplainNode describes a node of the evaluation tree
+type ExplainNode struct {
+	Type     string         `json:"type"`
+	Name     string         `json:"name,omitempty"`
+	Event    string         `json:"event,omitempty"`
+	Agg      string         `json:"agg,omitempty"`
+	Func     string         `json:"func,omitempty"`
+	Op       string         `json:"op,omitempty"`
+	Group    []string       `json:"group,omitempty"`
+	On       []string       `json:"on,omitempty"`
+	Ignoring []string       `json:"ignoring,omitempty"`
+	Offset   string         `json:"offset,omitempty"`
+	Horizon  string         `json:"horizon,omitempty"`
+	Season   int            `json:"season,omitempty"`
+	Value    *float64       `json:"value,omitempty"`
+	Fields   db.MatchFields `json:"fields,omitempty"`
+	Children []*ExplainNode `json:"children,omitempty"`
+}
+
+// Explain describes how the query will be evaluated over a TimeRange
+func (q *Query) Explain(t db.TimeRange) *Explain {
+	queries := db.ScanQueries(q.Queries(t)).Compact()
+	x := Explain{
+		Queries: queries,
+		Rows:    make([]RowEstimate, len(queries)),
+		Tree:    explainNode(q.root),
+	}
+	for i := range queries {
+		q := &queries[i]
+		steps := q.NumSteps()
+		if steps >= 0 {
+			steps++
+		}
+		x.Rows[i] = RowEstimate{
+			Event: q.Event,
+			Steps: steps,
+			Rows:  -1,
+		}
+	}
+	return &x
+}
+
+// Estimate fills the row estimates of each backend of a scanner.
+// Scanners that are neither a db.DB nor a db.Estimator leave the estimates unknown.
+func (x *Explain) Estimate(ctx context.Context, s db.Scanner) error {
+	for i := range x.Queries {
+		q := &x.Queries[i]
+		var (
+			estimates []db.BackendEstimate
+			err       error
+		)
+		switch s := s.(type) {
+		case db.DB:
+			estimates, err = db.EstimateBackends(ctx, s, q)
+		case db.Estimator:
+			var n int64
+			n, err = s.Estimate(ctx, q)
+			estimates = []db.BackendEstimate{{Rows: n}}
+		}
+		if err != nil {
+			return err
+		}
+		if estimates == nil {
+			continue
+		}
+		row := &x.Rows[i]
+		row.Backends = estimates
+		row.Rows = 0
+		for _, e := range estimates {
+			row.Rows += e.Rows
+		}
+	}
+	return nil
+}
+
+func explainNode(n noder) *ExplainNode {
+	switch n := n.(type) {
+	case blockNode:
+		x := ExplainNode{Type: "block"}
+		for _, n := range n {
+			x.Children = append(x.Children, explainNode(n))
+		}
+		return &x
+	case selectNode:
+		x := ExplainNode{Type: "select"}
+		for _, n := range n {
+			x.Children = append(x.Children, explainNode(n))
+		}
+		return &x
+	case scanNode:
+		x := ExplainNode{Type: "scan"}
+		for i := range n {
+			x.Children = append(x.Children, explainNode(&n[i]))
+		}
+		return &x
+	case *scanResultNode:
+		return &ExplainNode{
+			Type:   "scan",
+			Name:   n.Event,
+			Event:  n.Event,
+			Offset: explainOffset(n.Offset),
+			Fields: n.Match,
+		}
+	case *scanAggNode:
+		x := explainNode(n.scanResultNode)
+		x.Agg = aggregatorName(n.Agg)
+		return x
+	case *groupNode:
+		return &ExplainNode{
+			Type:     "group",
+			Name:     n.Name,
+			Group:    n.Group,
+			Children: []*ExplainNode{explainNode(n.aggResult)},
+		}
+	case *aggOp:
+		return &ExplainNode{
+			Type:     "op",
+			Op:       mergerName(n.Op),
+			Children: []*ExplainNode{explainNode(n.X), explainNode(n.Y)},
+		}
+	case *zipAggNode:
+		x := ExplainNode{
+			Type:   "zip",
+			Agg:    aggregatorName(n.Agg),
+			Offset: explainOffset(n.Offset),
+		}
+		for _, n := range n.Nodes {
+			x.Children = append(x.Children, explainNode(n))
+		}
+		return &x
+	case *anomalyNode:
+		x := ExplainNode{
+			Type:     "anomaly",
+			Func:     n.Func,
+			Children: []*ExplainNode{explainNode(n.aggResult)},
+		}
+		if n.Threshold > 0 {
+			k := n.Threshold
+			x.Value = &k
+		}
+		for _, n := range n.Baselines {
+			x.Children = append(x.Children, explainNode(n))
+		}
+		return &x
+	case *matchNode:
+		x := ExplainNode{
+			Type:     "match",
+			Children: []*ExplainNode{explainNode(n.aggResult)},
+		}
+		if n.Ignoring {
+			x.Ignoring = n.Labels
+		} else {
+			x.On = n.Labels
+		}
+		return &x
+	case *predictNode:
+		return &ExplainNode{
+			Type:     "predict",
+			Horizon:  n.Horizon.String(),
+			Season:   n.Season,
+			Children: []*ExplainNode{explainNode(n.aggResult)},
+		}
+	case *aggNode:
+		return &ExplainNode{
+			Type:     "agg",
+			Agg:      aggregatorName(n.Agg),
+			Children: []*ExplainNode{explainNode(n.aggResult)},
+		}
+	case *namedAggResult:
+		x := explainNode(n.aggResult)
+		x.Name = n.Name
+		return x
+	case *valueNode:
+		v := n.Value
+		return &ExplainNode{
+			Type:   "value",
+			Value:  &v,
+			Offset: explainOffset(n.Offset),
+		}
+	default:
+		return &ExplainNode{
+			Type: fmt.Sprint(reflect.TypeOf(n)),
+		}
+	}
+}
+
+func explainOffset(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+func aggregatorName(a Aggregator) string {
+	switch a.(type) {
+	case aggSum, nil:
+		// Nil aggregators default to sum
+		return "sum"
+	case aggCount:
+		return "count"
+	case *aggAvg:
+		return "avg"
+	case aggMin:
+		return "min"
+	case aggMax:
+		return "max"
+	default:
+		return fmt.Sprint(reflect.TypeOf(a))
+	}
+}
+
+func mergerName(m merger) string {
+	switch m.(type) {
+	case mergeAdd:
+		return "+"
+	case mergeSub:
+		return "-"
+	case mergeMul:
+		return "*"
+	case mergeDiv:
+		return "/"
+	default:
+		return fmt.Sprint(reflect.TypeOf(m))
+	}
+}
@@ -0,0 +1,74 @@
+package evql_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	db "github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/evql"
+	"github.com/alxarch/evdb/internal/assert"
+)
+
+func TestQuery_Explain(t *testing.T) {
+	now := time.Now().Truncate(time.Hour)
+	tr := db.TimeRange{
+		Start: now.Add(-2 * time.Hour),
+		End:   now,
+		Step:  time.Hour,
+	}
+	q, err := evql.Parse(`*BY{color}; foo{size: s} / foo[-1:h] + 1`)
+	assert.NoError(t, err)
+	x := q.Explain(tr)
+	// Overlapping scans are merged
+	assert.Equal(t, len(x.Queries), 1)
+	assert.Equal(t, x.Queries[0].Event, "foo")
+	assert.Equal(t, x.Queries[0].Start, tr.Start.Add(-time.Hour))
+	assert.Equal(t, x.Queries[0].End, tr.End)
+	assert.Equal(t, x.Rows, []evql.RowEstimate{
+		{Event: "foo", Steps: 4, Rows: -1},
+	})
+	assert.Equal(t, x.Tree.Type, "block")
+	assert.Equal(t, len(x.Tree.Children), 1)
+	g := x.Tree.Children[0]
+	assert.Equal(t, g.Type, "group")
+	assert.Equal(t, g.Name, "foo{size: s}/foo[-1:h] + 1")
+	assert.Equal(t, g.Group, []string{"color"})
+	op := g.Children[0]
+	assert.Equal(t, op.Op, "+")
+	assert.Equal(t, op.Children[0].Op, "/")
+	assert.Equal(t, op.Children[0].Children[1].Offset, "-1h0m0s")
+	assert.Equal(t, op.Children[0].Children[1].Agg, "sum")
+	assert.Equal(t, *op.Children[1].Value, 1.0)
+}
+
+type estimatorDB struct {
+	db.DB
+}
+
+func (estimatorDB) Estimate(_ context.Context, q *db.Query) (int64, error) {
+	return int64(len(q.Event)), nil
+}
+
+type wrapDB struct {
+	db.DB
+}
+
+func (w wrapDB) Unwrap() db.DB {
+	return w.DB
+}
+
+func TestExplain_Estimate(t *testing.T) {
+	q, err := evql.Parse(`foo{}; barbaz{}`)
+	assert.NoError(t, err)
+	now := time.Now()
+	x := q.Explain(db.TimeRange{Start: now.Add(-time.Hour), End: now, Step: time.Hour})
+	assert.Equal(t, x.Tree.Children[0].Type, "scan")
+	// Estimators of wrapped DBs are used
+	assert.NoError(t, x.Estimate(context.Background(), wrapDB{wrapDB{estimatorDB{}}}))
+	assert.Equal(t, len(x.Rows), 2)
+	for _, row := range x.Rows {
+		assert.Equal(t, row.Rows, int64(len(row.Event)))
+		assert.Equal(t, row.Backends, []db.BackendEstimate{{Rows: int64(len(row.Event))}})
+	}
+}
@@ -0,0 +1,187 @@
+package evql
+
+import (
+	"go/scanner"
+	"go/token"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	errors "golang.org/x/xerrors"
+)
+
+// ParamType is the type of a query parameter
+type ParamType string
+
+// Parameter types
+const (
+	// ParamString values are substituted as quoted strings, ie `foo{host: $host}`
+	ParamString ParamType = "string"
+	// ParamNumber values are substituted as numeric literals, ie `foo * $factor`
+	ParamNumber ParamType = "number"
+	// ParamDuration values are parsed as durations and substituted as offsets, ie `foo[-$window]`
+	ParamDuration ParamType = "duration"
+	// ParamIdent values are substituted as identifiers, ie `$event{host: foo}`
+	ParamIdent ParamType = "ident"
+)
+
+// Param is a typed value for a `$name` placeholder in a query
+type Param struct {
+	Name  string    `json:"name"`
+	Type  ParamType `json:"type,omitempty"`
+	Value string    `json:"value,omitempty"`
+}
+
+func (p *Param) literal() (string, error) {
+	switch p.Type {
+	case ParamString, "":
+		return strconv.Quote(p.Value), nil
+	case ParamNumber:
+		f, err := strconv.ParseFloat(p.Value, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", errors.Errorf("Invalid number value %q for $%s", p.Value, p.Name)
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64), nil
+	case ParamDuration:
+		d, err := parseDuration(p.Value)
+		if err != nil {
+			return "", errors.Errorf("Invalid duration value %q for $%s", p.Value, p.Name)
+		}
+		return durationOffset(d), nil
+	case ParamIdent:
+		if !isIdentifier(p.Value) {
+			return "", errors.Errorf("Invalid identifier value %q for $%s", p.Value, p.Name)
+		}
+		return p.Value, nil
+	default:
+		return "", errors.Errorf("Invalid type %q for $%s", p.Type, p.Name)
+	}
+}
+
+// placeholder returns a valid value for the parameter type
+func (p *Param) placeholder() Param {
+	tmp := Param{
+		Name:  p.Name,
+		Type:  p.Type,
+		Value: p.Value,
+	}
+	if tmp.Value != "" {
+		return tmp
+	}
+	switch p.Type {
+	case ParamNumber:
+		tmp.Value = "0"
+	case ParamDuration:
+		tmp.Value = "0s"
+	case ParamIdent:
+		tmp.Value = "_"
+	}
+	return tmp
+}
+
+// parseDuration parses durations in time.ParseDuration format or days and weeks, ie `7d`, `2w`
+func parseDuration(s string) (time.Duration, error) {
+	if n := len(s) - 1; n > 0 {
+		var unit time.Duration
+		switch s[n] {
+		case 'd':
+			unit = 24 * time.Hour
+		case 'w':
+			unit = 7 * 24 * time.Hour
+		}
+		if unit != 0 {
+			v, err := strconv.ParseInt(s[:n], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return time.Duration(v) * unit, nil
+		}
+	}
+	return time.ParseDuration(s)
+}
+
+// durationOffset formats a duration as an offset with the largest unit that fits
+func durationOffset(d time.Duration) string {
+	units := []struct {
+		Name string
+		Unit time.Duration
+	}{
+		{"w", 7 * 24 * time.Hour},
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+	}
+	for _, u := range units {
+		if d%u.Unit == 0 {
+			return strconv.FormatInt(int64(d/u.Unit), 10) + ":" + u.Name
+		}
+	}
+	// Sub-second precision is not supported by offsets
+	return strconv.FormatInt(int64(d/time.Second), 10) + ":s"
+}
+
+// expandParams substitutes `$name` placeholders in a query with parameter values.
+// Placeholders inside string literals are left untouched.
+func expandParams(query string, params []Param) (string, error) {
+	if strings.IndexByte(query, '$') == -1 {
+		return query, nil
+	}
+	src := []byte(query)
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	// Errors for `$` are expected, syntax errors are reported by the parser
+	s.Init(file, src, nil, 0)
+	var (
+		w    strings.Builder
+		last int
+	)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok != token.ILLEGAL || lit != "$" {
+			continue
+		}
+		offset := file.Offset(pos)
+		pos, tok, lit = s.Scan()
+		if tok != token.IDENT && !tok.IsKeyword() || file.Offset(pos) != offset+1 {
+			return "", errors.Errorf("Invalid placeholder at offset %d", offset)
+		}
+		p := findParam(params, lit)
+		if p == nil {
+			return "", errors.Errorf("Undefined parameter $%s", lit)
+		}
+		v, err := p.literal()
+		if err != nil {
+			return "", err
+		}
+		w.WriteString(query[last:offset])
+		w.WriteString(v)
+		last = offset + 1 + len(lit)
+	}
+	w.WriteString(query[last:])
+	return w.String(), nil
+}
+
+func isIdentifier(name string) bool {
+	for i, c := range name {
+		if !unicode.IsLetter(c) && c != '_' && (i == 0 || !unicode.IsDigit(c)) {
+			return false
+		}
+	}
+	return name != "" && !token.Lookup(name).IsKeyword()
+}
+
+func findParam(params []Param, name string) *Param {
+	for i := range params {
+		if p := &params[i]; p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
@@ -28,7 +28,18 @@ type evalNode interface {
 
 type aggResult interface {
 	noder
-	Aggregate(r db.Results, t *db.TimeRange) db.Result
+	Aggregate(g *aggGroup, t *db.TimeRange) db.Result
+}
+
+// aggGroup is the input of an aggResult
+type aggGroup struct {
+	// Results are the results of the group
+	Results db.Results
+	// Fields are the group labels
+	Fields db.Fields
+	// All are the results of all groups used for vector matching
+	All   db.Results
+	Empty string
 }
 
 func parseRoot(exp ast.Expr) (blockNode, error) {
@@ -180,6 +191,9 @@ func (b *selectBlock) parseSelect(e ast.Expr) (evalNode, error) {
 		}
 		g.Node = e
 		g.aggResult = a
+		if err := g.parseScans(); err != nil {
+			return nil, err
+		}
 		return g, nil
 	}
 	scan, err := parseScanResult(b.Offset, b.Match, e)
@@ -189,6 +203,31 @@ func (b *selectBlock) parseSelect(e ast.Expr) (evalNode, error) {
 	return scanNode{*scan}, nil
 }
 
+// parseScans checks the vector matching labels of the group and finds the scans that form groups
+func (g *groupNode) parseScans() (err error) {
+	var scans []*scanResultNode
+	matched := false
+	walkAggResult(g.aggResult, func(n noder) bool {
+		switch n := n.(type) {
+		case *matchNode:
+			matched = true
+			for _, label := range n.Labels {
+				if indexOf(g.Group, label) == -1 && err == nil {
+					err = errors.Errorf("Invalid vector matching label %q not in group labels", label)
+				}
+			}
+			return false
+		case *scanResultNode:
+			scans = append(scans, n)
+		}
+		return true
+	})
+	if matched {
+		g.Scans = scans
+	}
+	return
+}
+
 func (b *selectBlock) parseBlock(block blockNode, stmts ...ast.Stmt) (blockNode, error) {
 	for _, stmt := range stmts {
 		switch stmt := stmt.(type) {
@@ -207,7 +246,11 @@ func (b *selectBlock) parseBlock(block blockNode, stmts ...ast.Stmt) (blockNode,
 			var err error
 			switch exp := stmt.X.(type) {
 			case *ast.StarExpr:
-				sel, err = b.parseSelectClause(exp)
+				var block selectNode
+				// Avoid typed nil evalNode for non SELECT clauses
+				if block, err = b.parseSelectClause(exp); block != nil {
+					sel = block
+				}
 			default:
 				sel, err = b.parseSelect(exp)
 			}
@@ -287,6 +330,8 @@ func parseAggResult(a Aggregator, d time.Duration, m db.MatchFields, e ast.Expr)
 			return nil, err
 		}
 		return parseAggResult(a, d, m, exp.Type)
+	case *ast.CallExpr:
+		return parseMatchNode(a, d, m, exp)
 	case *ast.Ident:
 		scan := scanResultNode{
 			Event:  exp.Name,
@@ -299,6 +344,33 @@ func parseAggResult(a Aggregator, d time.Duration, m db.MatchFields, e ast.Expr)
 	}
 }
 
+func parseMatchNode(a Aggregator, d time.Duration, m db.MatchFields, exp *ast.CallExpr) (*matchNode, error) {
+	sel, ok := exp.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return nil, errorf(exp, "Invalid result expression")
+	}
+	var n matchNode
+	name := sel.Sel.Name
+	switch strings.ToLower(name) {
+	case "on":
+	case "ignoring":
+		n.Ignoring = true
+	default:
+		return nil, errorf(sel.Sel, "Invalid vector matching %q", name)
+	}
+	labels, err := parseStrings(exp.Args...)
+	if err != nil {
+		return nil, errorf(exp, "Invalid %s labels: %s", name, err)
+	}
+	x, err := parseAggResult(a, d, m, sel.X)
+	if err != nil {
+		return nil, err
+	}
+	n.aggResult = x
+	n.Labels = labels
+	return &n, nil
+}
+
 func parseScanResult(d time.Duration, m db.MatchFields, exp ast.Expr) (*scanResultNode, error) {
 	switch exp := exp.(type) {
 	case *ast.SliceExpr:
@@ -334,6 +406,12 @@ func parseAggExpr(a Aggregator, d time.Duration, m db.MatchFields, exp *ast.Unar
 		return nil, errorf(exp, "Invalid aggregator keyword prefix %q", exp.Op)
 	}
 	prefix, name, args := parseAggFn(exp.X)
+	if strings.ToLower(name) == "predict" && prefix == 0 {
+		return parsePredictNode(a, d, m, exp, args)
+	}
+	if _, ok := anomalyParams[strings.ToLower(name)]; ok && prefix == 0 {
+		return parseAnomalyNode(a, d, m, exp, strings.ToLower(name), args)
+	}
 	agg := NewAggregator(name)
 	if agg == nil {
 		return nil, errorf(exp, "Invalid aggregator %s%s", exp.Op, name)
@@ -381,6 +459,115 @@ func parseAggExpr(a Aggregator, d time.Duration, m db.MatchFields, exp *ast.Unar
 	return &n, nil
 }
 
+func parseAnomalyNode(a Aggregator, d time.Duration, m db.MatchFields, exp *ast.UnaryExpr, fn string, args []ast.Expr) (*anomalyNode, error) {
+	params := make(map[string]float64)
+	for key, v := range anomalyParams[fn] {
+		params[key] = v
+	}
+	var nodes []aggResult
+	for _, arg := range args {
+		if kv, ok := arg.(*ast.KeyValueExpr); ok {
+			key := strings.ToLower(getName(kv.Key))
+			if _, ok := params[key]; !ok {
+				return nil, errorf(kv.Key, "Invalid keyword argument %q for %s%s", key, exp.Op, fn)
+			}
+			v, err := parseNumber(kv.Value)
+			if err != nil {
+				return nil, errorf(kv.Value, "Invalid %s argument: %s", key, err)
+			}
+			params[key] = v
+			continue
+		}
+		n, err := parseAggResult(a, d, m, arg)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	switch {
+	case len(nodes) == 0:
+		return nil, errorf(exp, "No arguments for %s%s", exp.Op, fn)
+	case fn == "baseline" && len(nodes) == 1:
+		return nil, errorf(exp, "No baseline arguments for %s%s", exp.Op, fn)
+	case fn != "baseline" && len(nodes) > 1:
+		return nil, errorf(exp, "Too many arguments for %s%s", exp.Op, fn)
+	}
+	model, err := newAnomalyModel(fn, params)
+	if err != nil {
+		return nil, errorf(exp, "Invalid %s%s: %s", exp.Op, fn, err)
+	}
+	return &anomalyNode{
+		aggResult: nodes[0],
+		Func:      fn,
+		Model:     model,
+		Baselines: nodes[1:],
+		Threshold: params["k"],
+	}, nil
+}
+
+func parsePredictNode(a Aggregator, d time.Duration, m db.MatchFields, exp *ast.UnaryExpr, args []ast.Expr) (*predictNode, error) {
+	var n predictNode
+	var nodes []aggResult
+	for _, arg := range args {
+		kv, ok := arg.(*ast.KeyValueExpr)
+		if !ok {
+			x, err := parseAggResult(a, d, m, arg)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, x)
+			continue
+		}
+		if key := getName(kv.Key); key != "" {
+			if strings.ToLower(key) != "season" {
+				return nil, errorf(kv.Key, "Invalid keyword argument %q for %spredict", key, exp.Op)
+			}
+			v, err := parseNumber(kv.Value)
+			if err != nil {
+				return nil, errorf(kv.Value, "Invalid season argument: %s", err)
+			}
+			if n.Season = int(v); float64(n.Season) != v || n.Season < 0 {
+				return nil, errorf(kv.Value, "Invalid season %g", v)
+			}
+			continue
+		}
+		horizon, err := parseScanOffset(kv.Key, kv.Value)
+		if err != nil {
+			return nil, err
+		}
+		if horizon <= 0 {
+			return nil, errorf(kv, "Invalid forecast horizon %s", horizon)
+		}
+		n.Horizon = horizon
+	}
+	switch {
+	case len(nodes) == 0:
+		return nil, errorf(exp, "No arguments for %spredict", exp.Op)
+	case len(nodes) > 1:
+		return nil, errorf(exp, "Too many arguments for %spredict", exp.Op)
+	case n.Horizon == 0:
+		return nil, errorf(exp, "No forecast horizon for %spredict", exp.Op)
+	}
+	n.aggResult = nodes[0]
+	return &n, nil
+}
+
+func parseNumber(exp ast.Expr) (float64, error) {
+	switch exp := exp.(type) {
+	case *ast.BasicLit:
+		switch exp.Kind {
+		case token.INT, token.FLOAT:
+			return strconv.ParseFloat(exp.Value, 64)
+		}
+	case *ast.UnaryExpr:
+		if exp.Op == token.SUB {
+			v, err := parseNumber(exp.X)
+			return -v, err
+		}
+	}
+	return 0, errors.Errorf("Invalid number expression type %s", reflect.TypeOf(exp))
+}
+
 func parseScanOffset(lo, hi ast.Expr) (time.Duration, error) {
 	n, ok := parseOffset(lo)
 	if !ok {
@@ -426,16 +613,35 @@ func parseMatchAny(values []string, exp ast.Expr) ([]string, error) {
 
 func parseMatcher(exp ast.Expr) (db.Matcher, error) {
 	switch exp := exp.(type) {
+	case *ast.ParenExpr:
+		return parseMatcher(exp.X)
 	case *ast.UnaryExpr:
 		fn, args := parseCall(exp.X)
 		name := getName(fn)
-		if len(args) != 1 {
+		if exp.Op != token.NOT {
 			return nil, errorf(exp, "Invalid matcher %s%s", exp.Op, name)
 		}
-		if exp.Op != token.NOT {
+		switch strings.ToLower(name) {
+		case "present", "absent":
+			if len(args) != 0 {
+				return nil, errorf(exp, "Invalid matcher %s%s", exp.Op, name)
+			}
+			if strings.ToLower(name) == "present" {
+				return db.MatchPresent(), nil
+			}
+			return db.MatchAbsent(), nil
+		}
+		if len(args) != 1 {
 			return nil, errorf(exp, "Invalid matcher %s%s", exp.Op, name)
 		}
 		arg := args[0]
+		if strings.ToLower(name) == "not" {
+			m, err := parseMatcher(arg)
+			if err != nil {
+				return nil, err
+			}
+			return db.MatchNot{Matcher: m}, nil
+		}
 		v, err := parseString(arg)
 		if err != nil {
 			return nil, errorf(exp, "Invalid arg for matcher %s%s: %s", exp.Op, name, err)
@@ -477,18 +683,34 @@ func parseMatch(m db.MatchFields, op token.Token, args ...ast.Expr) (db.MatchFie
 
 func parseMatchArgs(match db.MatchFields, args ...ast.Expr) (db.MatchFields, error) {
 	for _, el := range args {
-		kv, ok := el.(*ast.KeyValueExpr)
-		if !ok {
+		var key, value ast.Expr
+		negate := false
+		switch el := el.(type) {
+		case *ast.KeyValueExpr:
+			key, value = el.Key, el.Value
+		case *ast.BinaryExpr:
+			switch el.Op {
+			case token.EQL:
+			case token.NEQ:
+				negate = true
+			default:
+				return nil, errorf(el, "Invalid match op %q", el.Op)
+			}
+			key, value = el.X, el.Y
+		default:
 			return nil, errorf(el, "Invalid match expr type %s", reflect.TypeOf(el))
 		}
-		label, err := parseString(kv.Key)
+		label, err := parseString(key)
 		if err != nil {
-			return nil, errorf(kv.Key, "Failed to parse match label: %s", err)
+			return nil, errorf(key, "Failed to parse match label: %s", err)
 		}
-		m, err := parseMatcher(kv.Value)
+		m, err := parseMatcher(value)
 		if err != nil {
 			return nil, errors.Errorf("Failed to parse match values for label %q: %s", label, err)
 		}
+		if negate {
+			m = db.MatchNot{Matcher: m}
+		}
 		match = match.Set(label, m)
 	}
 	return match, nil
@@ -552,6 +774,14 @@ func nodeQueries(dst []db.Query, t *db.TimeRange, n noder) []db.Query {
 			dst = nodeQueries(dst, t, n)
 		}
 		return dst
+	case *anomalyNode:
+		dst = nodeQueries(dst, t, n.aggResult)
+		for _, n := range n.Baselines {
+			dst = nodeQueries(dst, t, n)
+		}
+		return dst
+	case *valueNode:
+		return dst
 	default:
 		fmt.Println(reflect.TypeOf(n))
 		return dst
@@ -604,11 +834,11 @@ type scanAggNode struct {
 }
 
 func (s *scanAggNode) unwrap() noder { return s.scanResultNode }
-func (s *scanAggNode) Aggregate(results db.Results, tr *db.TimeRange) db.Result {
+func (s *scanAggNode) Aggregate(g *aggGroup, tr *db.TimeRange) db.Result {
 	agg := BlankAggregator(s.Agg)
 	t := *tr
 	data := db.BlankData(tr, agg.Zero())
-	results = s.scanResultNode.Results(results, *tr)
+	results := s.scanResultNode.Results(g.Results, *tr)
 	for i := range data {
 		d := &data[i]
 		v := agg.Zero()
@@ -640,7 +870,7 @@ type zipAggNode struct {
 
 func (*zipAggNode) node() {}
 
-func (n *zipAggNode) Aggregate(results db.Results, tr *db.TimeRange) db.Result {
+func (n *zipAggNode) Aggregate(g *aggGroup, tr *db.TimeRange) db.Result {
 	if n.Offset != 0 {
 		t := tr.Offset(n.Offset)
 		tr = &t
@@ -651,11 +881,11 @@ func (n *zipAggNode) Aggregate(results db.Results, tr *db.TimeRange) db.Result {
 			Data: db.BlankData(tr, math.NaN()),
 		}
 	case 1:
-		return n.Nodes[0].Aggregate(results, tr)
+		return n.Nodes[0].Aggregate(g, tr)
 	}
 	var els []db.Result
 	for _, el := range n.Nodes {
-		els = append(els, el.Aggregate(results, tr))
+		els = append(els, el.Aggregate(g, tr))
 	}
 	out, tail := els[0], els[1:]
 	a := BlankAggregator(n.Agg)
@@ -708,9 +938,18 @@ type aggOp struct {
 }
 
 func (op *aggOp) node() {}
-func (op *aggOp) Aggregate(r db.Results, tr *db.TimeRange) db.Result {
-	x := op.X.Aggregate(r, tr)
-	y := op.Y.Aggregate(r, tr)
+func (op *aggOp) Aggregate(g *aggGroup, tr *db.TimeRange) db.Result {
+	x := op.X.Aggregate(g, tr)
+	y := op.Y.Aggregate(g, tr)
+	// Scalar values extend to the forecast steps of the other operand
+	if v, ok := op.X.(*valueNode); ok && len(x.Data) < len(y.Data) {
+		x.Data = y.Data.Copy()
+		x.Data.Fill(v.Value)
+	}
+	if v, ok := op.Y.(*valueNode); ok && len(y.Data) < len(x.Data) {
+		y.Data = x.Data.Copy()
+		y.Data.Fill(v.Value)
+	}
 	for i := range x.Data {
 		p := &x.Data[i]
 		if 0 <= i && i < len(y.Data) {
@@ -741,20 +980,52 @@ type groupNode struct {
 	Name  string
 	Group []string
 	Empty string
+	// Scans are the scans that form groups if some operands use vector matching
+	Scans []*scanResultNode
 }
 
 func (*groupNode) node()           {}
 func (g *groupNode) unwrap() noder { return g.aggResult }
 
+// groupResults returns the results that form groups.
+// Results of operands that use vector matching only join groups formed by other operands.
+func (g *groupNode) groupResults(results db.Results) db.Results {
+	if len(g.Scans) == 0 {
+		return results
+	}
+	var out db.Results
+	for i := range results {
+		r := &results[i]
+		for _, s := range g.Scans {
+			if r.Event == s.Event && s.Match.Match(r.Fields) {
+				out = append(out, *r)
+				break
+			}
+		}
+	}
+	return out
+}
+
 func (g *groupNode) Eval(out []db.Results, tr *db.TimeRange, results db.Results) []db.Results {
-	groups := results.Group(g.Empty, g.Group...)
+	groups := g.groupResults(results).Group(g.Empty, g.Group...)
 	rr := db.Results{}
 	for i := range groups {
 		group := &groups[i]
-		r := g.aggResult.Aggregate(group.Results, tr)
+		r := g.aggResult.Aggregate(&aggGroup{
+			Results: group.Results,
+			Fields:  group.Fields,
+			All:     results,
+			Empty:   g.Empty,
+		}, tr)
 		r.Fields = group.Fields
 		r.Event = g.Name
 		r.TimeRange = *tr
+		// Forecasts extend results past the end of the range
+		if last := r.Data.Last(); last != nil {
+			if end := time.Unix(last.Timestamp, 0); end.After(tr.End) {
+				r.TimeRange.End = end.In(tr.End.Location())
+			}
+		}
 		rr = append(rr, r)
 	}
 	out = append(out, rr)
@@ -767,7 +1038,7 @@ type valueNode struct {
 }
 
 func (v *valueNode) node() {}
-func (v *valueNode) Aggregate(_ db.Results, t *db.TimeRange) db.Result {
+func (v *valueNode) Aggregate(_ *aggGroup, t *db.TimeRange) db.Result {
 	if v.Offset > 0 {
 		tt := t.Offset(v.Offset)
 		t = &tt
@@ -784,8 +1055,8 @@ type namedAggResult struct {
 
 func (n *namedAggResult) unwrap() noder { return n.aggResult }
 
-func (n *namedAggResult) Aggregate(r db.Results, t *db.TimeRange) db.Result {
-	out := n.aggResult.Aggregate(r, t)
+func (n *namedAggResult) Aggregate(g *aggGroup, t *db.TimeRange) db.Result {
+	out := n.aggResult.Aggregate(g, t)
 	out.Event = n.Name
 	out.TimeRange = *t
 	out.Fields = nil
@@ -801,14 +1072,169 @@ type aggNode struct {
 // func (n *aggNode) node()         {}
 func (n *aggNode) unwrap() noder { return n.aggResult }
 
-func (n *aggNode) Aggregate(r db.Results, t *db.TimeRange) db.Result {
-	a := n.aggResult.Aggregate(r, t)
+func (n *aggNode) Aggregate(g *aggGroup, t *db.TimeRange) db.Result {
+	a := n.aggResult.Aggregate(g, t)
 	agg := BlankAggregator(n.Agg)
 	v := AggregateData(a.Data, agg)
 	a.Data.Fill(v)
 	return a
 }
 
+// anomalyNode scores the deviation of each step of a result from the value expected by a model.
+// Baselines are the results a baseline model compares against.
+// If Threshold is set steps are flagged with 1 if the score reaches the threshold and 0 otherwise.
+type anomalyNode struct {
+	aggResult
+	Func      string
+	Model     anomalyModel
+	Baselines []aggResult
+	Threshold float64
+}
+
+func (n *anomalyNode) Aggregate(g *aggGroup, tr *db.TimeRange) db.Result {
+	x := n.aggResult.Aggregate(g, tr)
+	values := make([]float64, len(x.Data))
+	for i := range x.Data {
+		values[i] = x.Data[i].Value
+	}
+	baselines := make([][]float64, len(n.Baselines))
+	for j, b := range n.Baselines {
+		data := b.Aggregate(g, tr).Data
+		baseline := make([]float64, len(values))
+		for i := range baseline {
+			baseline[i] = math.NaN()
+			if i < len(data) {
+				baseline[i] = data[i].Value
+			}
+		}
+		baselines[j] = baseline
+	}
+	anomalyScores(values, n.Model.Expected(values, baselines))
+	if n.Threshold > 0 {
+		anomalyFlags(values, n.Threshold)
+	}
+	for i := range x.Data {
+		x.Data[i].Value = values[i]
+	}
+	return db.Result{
+		Data: x.Data,
+	}
+}
+
+// predictNode extends a result past the end of the range with a forecast.
+// The forecast fits a linear trend and a seasonal component of Season steps to the result data.
+type predictNode struct {
+	aggResult
+	Horizon time.Duration
+	Season  int
+}
+
+func (n *predictNode) unwrap() noder { return n.aggResult }
+
+func (n *predictNode) Aggregate(g *aggGroup, tr *db.TimeRange) db.Result {
+	x := n.aggResult.Aggregate(g, tr)
+	if tr.Step <= 0 {
+		return db.Result{
+			Data: x.Data,
+		}
+	}
+	ext := tr.Extend(n.Horizon)
+	data := db.BlankData(&ext, math.NaN())
+	if len(data) <= len(x.Data) {
+		return db.Result{
+			Data: x.Data,
+		}
+	}
+	values := make([]float64, len(x.Data))
+	for i := range x.Data {
+		values[i] = x.Data[i].Value
+	}
+	f := forecast(values, n.Season, len(data)-len(values))
+	for i := range data {
+		if i < len(values) {
+			data[i].Value = values[i]
+		} else {
+			data[i].Value = f[i-len(values)]
+		}
+	}
+	return db.Result{
+		Data: data,
+	}
+}
+
+// matchNode aggregates the results of all groups that match the group on some of its labels.
+// Like PromQL's vector matching it matches on Labels or, if Ignoring is set, on all group labels except Labels.
+type matchNode struct {
+	aggResult
+	Labels   []string
+	Ignoring bool
+}
+
+func (n *matchNode) unwrap() noder { return n.aggResult }
+
+func (n *matchNode) Aggregate(g *aggGroup, tr *db.TimeRange) db.Result {
+	m := aggGroup{
+		Fields: g.Fields,
+		All:    g.All,
+		Empty:  g.Empty,
+	}
+	for i := range g.All {
+		r := &g.All[i]
+		if n.match(g, r.Fields) {
+			m.Results = append(m.Results, *r)
+		}
+	}
+	return n.aggResult.Aggregate(&m, tr)
+}
+
+func (n *matchNode) match(g *aggGroup, fields db.Fields) bool {
+	for _, f := range g.Fields {
+		if (indexOf(n.Labels, f.Label) != -1) == n.Ignoring {
+			continue
+		}
+		v, ok := fields.Get(f.Label)
+		if !ok {
+			v = g.Empty
+		}
+		if v != f.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// walkAggResult calls fn for each node of an aggResult tree, children are skipped if fn returns false
+func walkAggResult(n noder, fn func(n noder) bool) {
+	if !fn(n) {
+		return
+	}
+	switch n := n.(type) {
+	case unwraper:
+		walkAggResult(n.unwrap(), fn)
+	case *aggOp:
+		walkAggResult(n.X, fn)
+		walkAggResult(n.Y, fn)
+	case *zipAggNode:
+		for _, n := range n.Nodes {
+			walkAggResult(n, fn)
+		}
+	case *anomalyNode:
+		walkAggResult(n.aggResult, fn)
+		for _, n := range n.Baselines {
+			walkAggResult(n, fn)
+		}
+	}
+}
+
+func indexOf(values []string, s string) int {
+	for i, v := range values {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
 func nameResults(fset *token.FileSet, block []evalNode) {
 	for _, n := range block {
 		switch n := n.(type) {
@@ -2,6 +2,7 @@ package evql_test
 
 import (
 	"context"
+	"math"
 	"reflect"
 	"testing"
 	"time"
@@ -31,6 +32,34 @@ func TestParser_Reset(t *testing.T) {
 		{`foo{bar: baz|foo}; *BY{foo}; *OFFSET[1:h]`, false},
 		{`!avg{foo{bar: baz}}; *GROUP{foo}`, false},
 		{`!zipavg{foo{bar: baz}, !avg{bar[-1:d]}}; *BY{foo}`, false},
+		{`foo{bar: !not(baz|goo)}`, false},
+		{`foo{bar: !not(!prefix(baz))}`, false},
+		{`foo{bar != baz}`, false},
+		{`foo{bar == baz}`, false},
+		{`foo{bar: !present}; *WHERE{baz: !absent()}`, false},
+		{`*WHERE{bar != baz|goo}; foo`, false},
+		{`!zscore{foo}; *BY{bar}`, false},
+		{`!ewma{foo / bar, alpha: 0.5, k: 3}; *BY{bar}`, false},
+		{`!holtwinters{foo, season: 24, beta: 0}; *BY{bar}`, false},
+		{`!baseline{foo, foo[-1:w], foo[-2:w], k: 2}; *BY{bar}`, false},
+		{`!baseline{foo}; *BY{bar}`, true},
+		{`!zscore{foo, bar}; *BY{bar}`, true},
+		{`!ewma{foo, alpha: 2}; *BY{bar}`, true},
+		{`!holtwinters{foo, season: 1.5}; *BY{bar}`, true},
+		{`!zscore{foo, alpha: 0.5}; *BY{bar}`, true},
+		{`!predict{foo, 7:d}; *BY{bar}`, false},
+		{`!predict{foo/bar, 2:h, season: 24} * 2; *BY{bar}`, false},
+		{`!predict{foo}; *BY{bar}`, true},
+		{`!predict{foo, -1:h}; *BY{bar}`, true},
+		{`!predict{foo, 1:h, alpha: 1}; *BY{bar}`, true},
+		{`foo / bar.on(baz); *BY{baz, goo}`, false},
+		{`foo / bar{a: b}[-1:h].ignoring(goo) * 100; *BY{baz, goo}`, false},
+		{`foo / bar.on(); *BY{baz}`, false},
+		{`foo / bar.on(goo); *BY{baz}`, true},
+		{`foo / bar.by(baz); *BY{baz}`, true},
+		{`foo{bar: !not()}`, true},
+		{`foo{bar: !present(baz)}`, true},
+		{`foo{bar < baz}`, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.query, func(t *testing.T) {
@@ -101,6 +130,11 @@ func TestParser(t *testing.T) {
 		{`foo{color: blue}; *BY{size}`, tr, false, []db.Results{{}}},
 		{`foo{size: s|m}`, tr, false, []db.Results{{all[0], all[1]}}},
 		{`foo{size: s}`, tr, false, []db.Results{{all[0]}}},
+		{`foo{size != s}`, tr, false, []db.Results{{all[1]}}},
+		{`foo{size: !not(s|m)}`, tr, false, []db.Results{{}}},
+		{`baz{brand: !present}`, tr, false, []db.Results{{all[4], all[5]}}},
+		{`foo{brand: !absent}`, tr, false, []db.Results{{all[0], all[1]}}},
+		{`foo{brand: !present}`, tr, false, []db.Results{{}}},
 		{`foo + bar; *BY{size}; *WHERE{color:blue|red}`, tr, false, []db.Results{{
 			{
 				Event:     "foo + bar",
@@ -185,3 +219,189 @@ func TestParser(t *testing.T) {
 	}
 
 }
+
+func TestParser_Anomaly(t *testing.T) {
+	now := time.Now().Truncate(time.Hour)
+	tr := db.TimeRange{
+		Start: now.Add(-7 * time.Hour),
+		End:   now,
+		Step:  time.Hour,
+	}
+	series := func(event string, tr db.TimeRange, values ...float64) db.Result {
+		data := db.BlankData(&tr, 0)
+		for i := range data {
+			data[i].Value = values[i]
+		}
+		return db.Result{
+			Event:     event,
+			Fields:    db.Fields{{Label: "color", Value: "red"}},
+			TimeRange: tr,
+			Data:      data,
+		}
+	}
+	all := db.Results{
+		series("foo", tr, 1, 5, 1, 5, 1, 5, 1, 9),
+		series("bar", db.TimeRange{
+			Start: tr.Start.Add(-2 * time.Hour),
+			End:   tr.End,
+			Step:  tr.Step,
+		}, 1, 5, 1, 5, 1, 5, 1, 5, 1, 5),
+	}
+	ex := evql.NewExecer(db.NewScanner(all))
+	nan := math.NaN()
+	tests := []struct {
+		query string
+		want  []float64
+	}{
+		{`!zscore{foo, k: 1.5}`, []float64{0, 0, 0, 0, 0, 0, 0, 1}},
+		{`!ewma{foo, alpha: 1, k: 1.5}`, []float64{nan, 0, 0, 0, 0, 0, 0, 1}},
+		{`!holtwinters{foo, season: 2}`, []float64{nan, nan, 0, 0, 0, 0, 0, math.Sqrt(6)}},
+		{`!baseline{foo, bar[-2:h]}`, []float64{0, 0, 0, 0, 0, 0, 0, 2 * math.Sqrt(2)}},
+		{`!baseline{foo, bar[-2:h]/0}`, []float64{nan, nan, nan, nan, nan, nan, nan, nan}},
+		{`!zscore{bar}`, []float64{-1, 1, -1, 1, -1, 1, -1, 1}},
+		{`!zscore{bar - bar}`, []float64{0, 0, 0, 0, 0, 0, 0, 0}},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			results, err := ex.Exec(ctx, tr, tt.query+`; *BY{color}`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 1 || len(results[0]) != 1 {
+				t.Fatalf("Invalid results %v", results)
+			}
+			data := results[0][0].Data
+			if len(data) != len(tt.want) {
+				t.Fatalf("Invalid data %v", data)
+			}
+			for i, want := range tt.want {
+				got := data[i].Value
+				if math.IsNaN(want) != math.IsNaN(got) || !math.IsNaN(want) && math.Abs(got-want) > 1e-9 {
+					t.Errorf("Invalid value at step %d %v != %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParser_Predict(t *testing.T) {
+	now := time.Now().Truncate(time.Hour)
+	tr := db.TimeRange{
+		Start: now.Add(-5 * time.Hour),
+		End:   now,
+		Step:  time.Hour,
+	}
+	all := db.Results{{
+		Event:     "foo",
+		Fields:    db.Fields{{Label: "color", Value: "red"}},
+		TimeRange: tr,
+		Data:      db.BlankData(&tr, 0),
+	}}
+	for i, v := range []float64{1, 5, 2, 6, 3, 7} {
+		all[0].Data[i].Value = v
+	}
+	ex := evql.NewExecer(db.NewScanner(all))
+	tests := []struct {
+		query string
+		want  []float64
+	}{
+		{`!predict{foo, 2:h}`, []float64{1, 5, 2, 6, 3, 7, 6.8, 7.6}},
+		{`!predict{foo, 3:h, season: 2}`, []float64{1, 5, 2, 6, 3, 7, 4, 8, 5}},
+		{`!predict{foo, 30:m, season: 2}`, []float64{1, 5, 2, 6, 3, 7}},
+		{`!predict{foo, 1:h, season: 2} + 1`, []float64{2, 6, 3, 7, 4, 8, 5}},
+		{`2 * !predict{foo, 1:h, season: 2}`, []float64{2, 10, 4, 12, 6, 14, 8}},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			results, err := ex.Exec(ctx, tr, tt.query+`; *BY{color}`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 1 || len(results[0]) != 1 {
+				t.Fatalf("Invalid results %v", results)
+			}
+			r := results[0][0]
+			if len(r.Data) != len(tt.want) {
+				t.Fatalf("Invalid data %v", r.Data)
+			}
+			for i, want := range tt.want {
+				if got := r.Data[i].Value; math.Abs(got-want) > 1e-9 {
+					t.Errorf("Invalid value at step %d %v != %v", i, got, want)
+				}
+			}
+			end := tr.End.Add(time.Duration(len(tt.want)-6) * time.Hour)
+			if !r.TimeRange.End.Equal(end) {
+				t.Errorf("Invalid result end %s != %s", r.TimeRange.End, end)
+			}
+		})
+	}
+}
+
+func TestParser_VectorMatching(t *testing.T) {
+	now := time.Now().Truncate(time.Hour)
+	tr := db.TimeRange{
+		Start: now.Add(-1 * time.Hour),
+		End:   now,
+		Step:  time.Hour,
+	}
+	result := func(event string, v float64, fields ...db.Field) db.Result {
+		return db.Result{
+			Event:     event,
+			Fields:    fields,
+			TimeRange: tr,
+			Data:      db.BlankData(&tr, v),
+		}
+	}
+	all := db.Results{
+		result("errors", 2, db.Field{Label: "host", Value: "a"}, db.Field{Label: "code", Value: "500"}),
+		result("errors", 4, db.Field{Label: "host", Value: "a"}, db.Field{Label: "code", Value: "503"}),
+		result("errors", 1, db.Field{Label: "host", Value: "b"}, db.Field{Label: "code", Value: "500"}),
+		result("requests", 10, db.Field{Label: "host", Value: "a"}, db.Field{Label: "path", Value: "/x"}),
+		result("requests", 10, db.Field{Label: "host", Value: "a"}, db.Field{Label: "path", Value: "/y"}),
+		result("requests", 5, db.Field{Label: "host", Value: "b"}, db.Field{Label: "path", Value: "/x"}),
+	}
+	ex := evql.NewExecer(db.NewScanner(all))
+	tests := []struct {
+		query string
+		want  map[string]float64
+	}{
+		{`*BY{host, code}; errors / requests.on(host)`, map[string]float64{
+			"a 500": 0.1,
+			"a 503": 0.2,
+			"b 500": 0.2,
+		}},
+		{`*BY{host, code}; errors / errors.ignoring(code)`, map[string]float64{
+			"a 500": 2.0 / 6,
+			"a 503": 4.0 / 6,
+			"b 500": 1,
+		}},
+		{`*BY{host, code}; errors / errors.on()`, map[string]float64{
+			"a 500": 2.0 / 7,
+			"a 503": 4.0 / 7,
+			"b 500": 1.0 / 7,
+		}},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			results, err := ex.Exec(ctx, tr, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 1 {
+				t.Fatalf("Invalid results %v", results)
+			}
+			got := make(map[string]float64)
+			for _, r := range results[0] {
+				host, _ := r.Fields.Get("host")
+				code, _ := r.Fields.Get("code")
+				got[host+" "+code] = r.Data[0].Value
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Invalid results %v != %v", got, tt.want)
+			}
+		})
+	}
+}
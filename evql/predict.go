@@ -0,0 +1,56 @@
+package evql
+
+import "math"
+
+// forecast fits a linear trend with an additive seasonal component to values and predicts n steps after them.
+// Seasons of 0 or 1 steps fit a plain linear trend.
+// NaN values are ignored, steps of seasons without any values are predicted as NaN.
+func forecast(values []float64, season, n int) []float64 {
+	if season < 1 {
+		season = 1
+	}
+	// Least squares fit of v = trend * i + level[i % season]
+	var (
+		count = make([]float64, season)
+		meanX = make([]float64, season)
+		meanY = make([]float64, season)
+	)
+	for i, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		j := i % season
+		count[j]++
+		meanX[j] += float64(i)
+		meanY[j] += v
+	}
+	for j := range count {
+		meanX[j] /= count[j]
+		meanY[j] /= count[j]
+	}
+	var cov, variance float64
+	for i, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		j := i % season
+		dx := float64(i) - meanX[j]
+		cov += dx * (v - meanY[j])
+		variance += dx * dx
+	}
+	trend := 0.0
+	if variance > 0 {
+		trend = cov / variance
+	}
+	out := make([]float64, n)
+	for k := range out {
+		i := len(values) + k
+		j := i % season
+		if count[j] == 0 {
+			out[k] = math.NaN()
+			continue
+		}
+		out[k] = meanY[j] + trend*(float64(i)-meanX[j])
+	}
+	return out
+}
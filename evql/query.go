@@ -47,7 +47,12 @@ type Query struct {
 	root blockNode
 }
 
-func Parse(query string) (*Query, error) {
+// Parse parses an evql query substituting `$name` placeholders with parameter values
+func Parse(query string, params ...Param) (*Query, error) {
+	query, err := expandParams(query, params)
+	if err != nil {
+		return nil, err
+	}
 	fset := token.NewFileSet()
 	// Wrap query body
 	query = fmt.Sprintf(`func(){%s}`, query)
@@ -0,0 +1,137 @@
+package evql
+
+import (
+	"encoding/json"
+
+	db "github.com/alxarch/evdb"
+	errors "golang.org/x/xerrors"
+)
+
+// SavedQuery is a named query with typed parameters
+type SavedQuery struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+	// Params declare the query placeholders, a non-empty Value is used as default
+	Params []Param `json:"params,omitempty"`
+}
+
+// ErrQueryNotFound is returned by a QueryStore when a named query does not exist
+var ErrQueryNotFound = db.ErrQueryNotFound
+
+// QueryStore persists named queries
+type QueryStore interface {
+	SaveQuery(q *SavedQuery) error
+	LoadQuery(name string) (*SavedQuery, error)
+	DeleteQuery(name string) error
+	SavedQueries() ([]SavedQuery, error)
+}
+
+// FindQueryStore returns a QueryStore for the db.QueryStore of a DB or of the DBs it wraps
+func FindQueryStore(d db.DB) QueryStore {
+	if s := db.FindQueryStore(d); s != nil {
+		return NewQueryStore(s)
+	}
+	return nil
+}
+
+// NewQueryStore stores saved queries as JSON documents in a db.QueryStore.
+// Queries are validated before they are saved.
+func NewQueryStore(s db.QueryStore) QueryStore {
+	return &queryStore{s}
+}
+
+type queryStore struct {
+	store db.QueryStore
+}
+
+func (s *queryStore) SaveQuery(q *SavedQuery) error {
+	if err := q.Validate(); err != nil {
+		return err
+	}
+	doc, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	return s.store.PutQuery(q.Name, doc)
+}
+
+func (s *queryStore) LoadQuery(name string) (*SavedQuery, error) {
+	doc, err := s.store.GetQuery(name)
+	if err != nil {
+		return nil, err
+	}
+	q := new(SavedQuery)
+	if err := json.Unmarshal(doc, q); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (s *queryStore) DeleteQuery(name string) error {
+	return s.store.DeleteQuery(name)
+}
+
+func (s *queryStore) SavedQueries() ([]SavedQuery, error) {
+	docs, err := s.store.AllQueries()
+	if err != nil {
+		return nil, err
+	}
+	queries := make([]SavedQuery, len(docs))
+	for i, doc := range docs {
+		if err := json.Unmarshal(doc, &queries[i]); err != nil {
+			return nil, err
+		}
+	}
+	return queries, nil
+}
+
+// Parse parses a saved query using args for parameter values.
+// Missing args use the parameter's default value, parameters without a default are required.
+// An empty string value must be passed explicitly in args.
+func (s *SavedQuery) Parse(args map[string]string) (*Query, error) {
+	params := make([]Param, len(s.Params))
+	for i, p := range s.Params {
+		if v, ok := args[p.Name]; ok {
+			p.Value = v
+		} else if p.Value == "" {
+			return nil, errors.Errorf("Missing value for $%s", p.Name)
+		}
+		params[i] = p
+	}
+	return Parse(s.Query, params...)
+}
+
+// Validate checks the name, the parameters and the syntax of a saved query
+func (s *SavedQuery) Validate() error {
+	if !validQueryName(s.Name) {
+		return errors.Errorf("Invalid query name %q", s.Name)
+	}
+	params := make([]Param, len(s.Params))
+	for i := range s.Params {
+		p := &s.Params[i]
+		if !isIdentifier(p.Name) {
+			return errors.Errorf("Invalid parameter name %q", p.Name)
+		}
+		if findParam(s.Params[:i], p.Name) != nil {
+			return errors.Errorf("Duplicate parameter $%s", p.Name)
+		}
+		params[i] = p.placeholder()
+		if _, err := params[i].literal(); err != nil {
+			return err
+		}
+	}
+	_, err := Parse(s.Query, params...)
+	return err
+}
+
+func validQueryName(name string) bool {
+	for _, c := range name {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '_', c == '-', c == '.':
+		default:
+			return false
+		}
+	}
+	return name != "" && name[0] != '.'
+}
@@ -0,0 +1,110 @@
+package evql_test
+
+import (
+	"testing"
+	"time"
+
+	db "github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/evql"
+	"github.com/alxarch/evdb/internal/assert"
+)
+
+func TestParse_Params(t *testing.T) {
+	tests := []struct {
+		query   string
+		params  []evql.Param
+		want    string
+		wantErr bool
+	}{
+		{`foo{host: $host}`, []evql.Param{{Name: "host", Value: "www"}}, `foo{host: "www"}`, false},
+		{`foo{host: "$host"}`, nil, `foo{host: "$host"}`, false},
+		{`$event{host: foo}`, []evql.Param{{Name: "event", Type: evql.ParamIdent, Value: "bar"}}, `bar{host: foo}`, false},
+		{`foo[-$window]`, []evql.Param{{Name: "window", Type: evql.ParamDuration, Value: "2h"}}, `foo[-2:h]`, false},
+		{`foo[-$window]`, []evql.Param{{Name: "window", Type: evql.ParamDuration, Value: "90s"}}, `foo[-90:s]`, false},
+		{`foo[-$window]`, []evql.Param{{Name: "window", Type: evql.ParamDuration, Value: "7d"}}, `foo[-1:w]`, false},
+		{`*GROUP{host}; foo * $n`, []evql.Param{{Name: "n", Type: evql.ParamNumber, Value: "1.5"}}, `*GROUP{host}; foo * 1.5`, false},
+		{`foo * $n`, []evql.Param{{Name: "n", Type: evql.ParamNumber, Value: "foo"}}, ``, true},
+		{`foo * $n`, nil, ``, true},
+		{`foo * $ n`, []evql.Param{{Name: "n", Type: evql.ParamNumber, Value: "1"}}, ``, true},
+		{`$event`, []evql.Param{{Name: "event", Type: evql.ParamIdent, Value: "foo-bar"}}, ``, true},
+		{`$event`, []evql.Param{{Name: "event", Type: "invalid", Value: "foo"}}, ``, true},
+	}
+	now := time.Now().Truncate(time.Hour)
+	tr := db.TimeRange{
+		Start: now.Add(-time.Hour),
+		End:   now,
+		Step:  time.Hour,
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := evql.Parse(tt.query, tt.params...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			want, err := evql.Parse(tt.want)
+			assert.NoError(t, err)
+			assert.Equal(t, q.Queries(tr), want.Queries(tr))
+		})
+	}
+}
+
+func TestSavedQuery(t *testing.T) {
+	s := evql.SavedQuery{
+		Name:  "errors",
+		Query: `requests{host: $host, status: !prefix("5")}[-$window]`,
+		Params: []evql.Param{
+			{Name: "host"},
+			{Name: "window", Type: evql.ParamDuration, Value: "1h"},
+		},
+	}
+	assert.NoError(t, s.Validate())
+	q, err := s.Parse(map[string]string{"host": "www", "window": "1d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Truncate(time.Hour)
+	tr := db.TimeRange{
+		Start: now.Add(-time.Hour),
+		End:   now,
+		Step:  time.Hour,
+	}
+	queries := q.Queries(tr)
+	assert.Equal(t, len(queries), 1)
+	assert.Equal(t, queries[0].Start, tr.Start.Add(-24*time.Hour))
+	assert.Equal(t, queries[0].Fields, db.MatchFields{
+		"host":   db.MatchString("www"),
+		"status": db.MatchPrefix("5"),
+	})
+	// Defaults
+	q, err = s.Parse(map[string]string{"host": "www"})
+	assert.NoError(t, err)
+	assert.Equal(t, q.Queries(tr)[0].Start, tr.Start.Add(-time.Hour))
+	// Empty strings are explicit
+	q, err = s.Parse(map[string]string{"host": ""})
+	assert.NoError(t, err)
+	assert.Equal(t, q.Queries(tr)[0].Fields["host"], db.MatchString(""))
+	if _, err := s.Parse(nil); err == nil {
+		t.Error("SavedQuery.Parse() missing string value no error")
+	}
+
+	for _, invalid := range []evql.SavedQuery{
+		{Name: "", Query: `foo`},
+		{Name: "foo/bar", Query: `foo`},
+		{Name: "..", Query: `foo`},
+		{Name: "foo", Query: `foo{bar: $bar}`},
+		{Name: "foo", Query: `foo`, Params: []evql.Param{{Name: "bar"}, {Name: "bar"}}},
+		{Name: "foo", Query: `foo`, Params: []evql.Param{{Name: "1bar"}}},
+		{Name: "foo", Query: `foo`, Params: []evql.Param{{Name: "bar", Type: evql.ParamNumber, Value: "bar"}}},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("SavedQuery.Validate() %v no error", invalid)
+		}
+	}
+	s.Params[1].Value = ""
+	if _, err := s.Parse(map[string]string{"host": "www"}); err == nil {
+		t.Error("SavedQuery.Parse() missing value no error")
+	}
+}
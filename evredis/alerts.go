@@ -0,0 +1,56 @@
+package evredis
+
+import (
+	"encoding/json"
+
+	"github.com/alxarch/evdb/evalert"
+	redis "github.com/alxarch/fastredis"
+	"github.com/alxarch/fastredis/resp"
+)
+
+var _ evalert.StateStore = (*DB)(nil)
+
+// alertsKey is the key holding alert state as JSON
+func (db *DB) alertsKey() string {
+	const key = "alerts"
+	if db.keyPrefix != "" {
+		return db.keyPrefix + string(labelSeparator) + key
+	}
+	return key
+}
+
+// SaveAlertState implements evalert.StateStore interface
+func (db *DB) SaveAlertState(s *evalert.State) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	p := db.redis.Pipeline()
+	defer redis.ReleasePipeline(p)
+	p.Set(db.alertsKey(), resp.Raw(data), 0)
+	return db.redis.Do(p, nil)
+}
+
+// LoadAlertState implements evalert.StateStore interface
+func (db *DB) LoadAlertState() (*evalert.State, error) {
+	p := db.redis.Pipeline()
+	defer redis.ReleasePipeline(p)
+	p.Get(db.alertsKey())
+	reply := redis.BlankReply()
+	defer redis.ReleaseReply(reply)
+	if err := db.redis.Do(p, reply); err != nil {
+		return nil, err
+	}
+	v := reply.Value().Get(0)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	s := new(evalert.State)
+	if v.IsNull() {
+		return s, nil
+	}
+	if err := json.Unmarshal(v.Bytes(), s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -47,10 +47,40 @@ func Open(options Config) (*DB, error) {
 		keyPrefix:   options.KeyPrefix,
 		resolutions: byDuration,
 	}
-	db.Scanner = evdb.NewScanner(&db)
+	// DB embeds Scanner so NewScanner would return DB itself
+	db.Scanner = evdb.NewScanner(evdb.QuerierFunc(db.Query))
 	return &db, nil
 }
 
+// MinStep returns the step of the finest resolution
+func (db *DB) MinStep() time.Duration {
+	var step time.Duration
+	for d := range db.resolutions {
+		if step == 0 || d < step {
+			step = d
+		}
+	}
+	return step
+}
+
+// Health implements evdb.HealthChecker interface.
+// The redis client has no context support so Health stops waiting for the ping once ctx is done.
+func (db *DB) Health(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- db.Ping()
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // Ping pings redis
 func (db *DB) Ping() error {
 	p := db.redis.Pipeline()
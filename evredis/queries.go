@@ -0,0 +1,87 @@
+package evredis
+
+import (
+	"github.com/alxarch/evdb"
+	redis "github.com/alxarch/fastredis"
+	"github.com/alxarch/fastredis/resp"
+)
+
+var _ evdb.QueryStore = (*DB)(nil)
+
+// queriesKey is the hash holding saved queries as JSON values
+func (db *DB) queriesKey() string {
+	const key = "queries"
+	if db.keyPrefix != "" {
+		return db.keyPrefix + string(labelSeparator) + key
+	}
+	return key
+}
+
+// PutQuery implements evdb.QueryStore interface
+func (db *DB) PutQuery(name string, doc []byte) error {
+	p := db.redis.Pipeline()
+	defer redis.ReleasePipeline(p)
+	p.HSet(db.queriesKey(), name, resp.Raw(doc))
+	return db.redis.Do(p, nil)
+}
+
+// GetQuery implements evdb.QueryStore interface
+func (db *DB) GetQuery(name string) ([]byte, error) {
+	p := db.redis.Pipeline()
+	defer redis.ReleasePipeline(p)
+	p.HGet(db.queriesKey(), name)
+	reply := redis.BlankReply()
+	defer redis.ReleaseReply(reply)
+	if err := db.redis.Do(p, reply); err != nil {
+		return nil, err
+	}
+	v := reply.Value().Get(0)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	if v.IsNull() {
+		return nil, evdb.ErrQueryNotFound
+	}
+	return append([]byte(nil), v.Bytes()...), nil
+}
+
+// DeleteQuery implements evdb.QueryStore interface
+func (db *DB) DeleteQuery(name string) error {
+	p := db.redis.Pipeline()
+	defer redis.ReleasePipeline(p)
+	p.HDel(db.queriesKey(), name)
+	reply := redis.BlankReply()
+	defer redis.ReleaseReply(reply)
+	if err := db.redis.Do(p, reply); err != nil {
+		return err
+	}
+	v := reply.Value().Get(0)
+	if err := v.Err(); err != nil {
+		return err
+	}
+	if n, _ := v.Int(); n == 0 {
+		return evdb.ErrQueryNotFound
+	}
+	return nil
+}
+
+// AllQueries implements evdb.QueryStore interface
+func (db *DB) AllQueries() ([][]byte, error) {
+	p := db.redis.Pipeline()
+	defer redis.ReleasePipeline(p)
+	p.HVals(db.queriesKey())
+	reply := redis.BlankReply()
+	defer redis.ReleaseReply(reply)
+	if err := db.redis.Do(p, reply); err != nil {
+		return nil, err
+	}
+	v := reply.Value().Get(0)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	var docs [][]byte
+	v.ForEach(func(v resp.Value) {
+		docs = append(docs, append([]byte(nil), v.Bytes()...))
+	})
+	return docs, nil
+}
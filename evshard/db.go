@@ -0,0 +1,279 @@
+package evshard
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/events"
+	errors "golang.org/x/xerrors"
+)
+
+// Shard is a named DB partition, names place shards on the hash ring
+type Shard struct {
+	Name string
+	DB   evdb.DB
+}
+
+// DB partitions events across multiple DBs using consistent hashing
+type DB struct {
+	shards []Shard
+	ring   *ring
+	label  string
+}
+
+var _ evdb.DB = (*DB)(nil)
+
+// Open creates a sharded DB
+func Open(config *Config, shards ...Shard) *DB {
+	names := make([]string, len(shards))
+	for i := range shards {
+		names[i] = shards[i].Name
+	}
+	return &DB{
+		shards: shards,
+		ring:   newRing(names, config.Replicas),
+		label:  config.Label,
+	}
+}
+
+// Shards returns the DB shards
+func (db *DB) Shards() []Shard {
+	return db.shards
+}
+
+// shardKey returns the ring key of an event and a value of the partition label
+func shardKey(event, value string) string {
+	return event + "\x00" + value
+}
+
+// Shard returns the index of the shard storing event counters with a partition label value.
+// The value is ignored if the DB is not partitioned by label.
+func (db *DB) Shard(event, value string) int {
+	if db.label == "" {
+		return db.ring.shard(event)
+	}
+	return db.ring.shard(shardKey(event, value))
+}
+
+// Storer implements evdb.Store interface
+func (db *DB) Storer(event string) (evdb.Storer, error) {
+	if len(db.shards) == 0 {
+		return nil, errors.New("No shards")
+	}
+	if db.label == "" {
+		return db.shards[db.Shard(event, "")].DB.Storer(event)
+	}
+	// Events are registered on all shards so scans of any shard do not fail
+	s := labelStorer{
+		db:      db,
+		event:   event,
+		storers: make([]evdb.Storer, len(db.shards)),
+	}
+	for i := range db.shards {
+		w, err := db.shards[i].DB.Storer(event)
+		if err != nil {
+			return nil, err
+		}
+		s.storers[i] = w
+	}
+	return &s, nil
+}
+
+// labelStorer splits snapshots by shard
+type labelStorer struct {
+	db      *DB
+	event   string
+	storers []evdb.Storer
+}
+
+func (s *labelStorer) Store(snap *evdb.Snapshot) error {
+	pos := -1
+	for i, label := range snap.Labels {
+		if label == s.db.label {
+			pos = i
+			break
+		}
+	}
+	counters := make(map[int][]events.Counter)
+	for _, c := range snap.Counters {
+		value := ""
+		if 0 <= pos && pos < len(c.Values) {
+			value = c.Values[pos]
+		}
+		i := s.db.Shard(s.event, value)
+		counters[i] = append(counters[i], c)
+	}
+	// Parts are stored to all shards even if some fail,
+	// parts stored to healthy shards are kept and the failed shards are reported in the error.
+	var (
+		failed   []string
+		firstErr error
+	)
+	for i := range s.storers {
+		cs, ok := counters[i]
+		if !ok {
+			continue
+		}
+		part := evdb.Snapshot{
+			Time:     snap.Time,
+			Labels:   snap.Labels,
+			Counters: cs,
+		}
+		if err := s.storers[i].Store(&part); err != nil {
+			failed = append(failed, s.db.shards[i].Name)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("Failed to store to shards %s: %w", strings.Join(failed, ", "), firstErr)
+	}
+	return nil
+}
+
+// queryShards returns the indexes of shards a query needs to scan
+func (db *DB) queryShards(q *evdb.Query) []int {
+	if db.label == "" {
+		return []int{db.Shard(q.Event, "")}
+	}
+	var values []string
+	switch m := q.Fields[db.label].(type) {
+	case evdb.MatchString:
+		values = []string{string(m)}
+	case evdb.MatchValues:
+		values = m
+	default:
+		all := make([]int, len(db.shards))
+		for i := range all {
+			all[i] = i
+		}
+		return all
+	}
+	var shards []int
+	seen := make(map[int]bool, len(values))
+	for _, v := range values {
+		i := db.Shard(q.Event, v)
+		if !seen[i] {
+			seen[i] = true
+			shards = append(shards, i)
+		}
+	}
+	return shards
+}
+
+// Scan implements evdb.Scanner interface.
+// Queries are sent only to the shards storing matching counters and
+// the results of each query from different shards are merged.
+func (db *DB) Scan(ctx context.Context, queries ...evdb.Query) (evdb.Results, error) {
+	if len(db.shards) == 0 {
+		return nil, errors.New("No shards")
+	}
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		out  evdb.Results
+		seen = make(map[string]int)
+		errc = make(chan error, len(queries)*len(db.shards))
+	)
+	for i := range queries {
+		q := &queries[i]
+		for _, s := range db.queryShards(q) {
+			// Each query is scanned separately so that results of different queries are never merged
+			n, shard := i, &db.shards[s]
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results, err := shard.DB.Scan(ctx, *q)
+				if err != nil {
+					errc <- errors.Errorf("Failed to scan shard %s: %w", shard.Name, err)
+					return
+				}
+				mu.Lock()
+				out = mergeResults(out, results, n, seen)
+				mu.Unlock()
+			}()
+		}
+	}
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// EstimateBackends implements evdb.BackendEstimator interface.
+// Only the shards the query is sent to are estimated.
+func (db *DB) EstimateBackends(ctx context.Context, q *evdb.Query) ([]evdb.BackendEstimate, error) {
+	var estimates []evdb.BackendEstimate
+	for _, i := range db.queryShards(q) {
+		shard := &db.shards[i]
+		e, err := evdb.EstimateBackends(ctx, shard.DB, q)
+		if err != nil {
+			return nil, errors.Errorf("Failed to estimate shard %s: %w", shard.Name, err)
+		}
+		estimates = append(estimates, evdb.PrefixBackends(shard.Name, e)...)
+	}
+	return estimates, nil
+}
+
+// mergeResults appends the results of query n to dst, adding the data of results of the same query with the same event and fields.
+// Counters are stored in a single shard unless shards were added so merging is rare.
+func mergeResults(dst, results evdb.Results, n int, seen map[string]int) evdb.Results {
+	var key []byte
+	for i := range results {
+		r := &results[i]
+		key = strconv.AppendInt(key[:0], int64(n), 10)
+		key = append(key, 0)
+		key = append(key, r.Event...)
+		key = append(key, 0)
+		key, _ = r.Fields.AppendBlob(key)
+		j, ok := seen[string(key)]
+		if !ok {
+			seen[string(key)] = len(dst)
+			dst = append(dst, *r)
+			continue
+		}
+		m := &dst[j]
+		for _, p := range r.Data {
+			m.Data = m.Data.Add(p.Timestamp, p.Value)
+		}
+	}
+	return dst
+}
+
+// Health implements evdb.HealthChecker interface, a DB is healthy if all shards are healthy
+func (db *DB) Health(ctx context.Context) error {
+	for _, s := range db.shards {
+		if err := evdb.Health(ctx, s.DB); err != nil {
+			return errors.Errorf("Shard %s is unhealthy: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// ReportStats implements evdb.StatsReporter interface
+func (db *DB) ReportStats(stats map[string]interface{}) {
+	shards := make(map[string]interface{}, len(db.shards))
+	for _, s := range db.shards {
+		shards[s.Name] = evdb.Stats(s.DB)
+	}
+	stats["shards"] = shards
+}
+
+// Close implements evdb.DB interface
+func (db *DB) Close() error {
+	var firstErr error
+	for _, s := range db.shards {
+		if err := s.DB.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,87 @@
+// Package evshard provides an evdb backend partitioning events across multiple DBs
+package evshard
+
+import (
+	"log"
+	"net/url"
+	"strconv"
+
+	"github.com/alxarch/evdb"
+	errors "golang.org/x/xerrors"
+)
+
+type opener struct{}
+
+var _ evdb.Opener = opener{}
+
+// Open implements evdb.Opener interface
+func (opener) Open(configURL string) (evdb.DB, error) {
+	config, err := ParseURL(configURL)
+	if err != nil {
+		return nil, err
+	}
+	shards := make([]Shard, 0, len(config.URLs))
+	for _, u := range config.URLs {
+		db, err := evdb.Open(u)
+		if err != nil {
+			for _, s := range shards {
+				s.DB.Close()
+			}
+			return nil, errors.Errorf("Failed to open %s: %w", u, err)
+		}
+		shards = append(shards, Shard{Name: u, DB: db})
+	}
+	return Open(config, shards...), nil
+}
+
+const urlScheme = "shard"
+
+func init() {
+	o := opener{}
+	if err := evdb.Register(urlScheme, o); err != nil {
+		log.Fatal("Failed to register db opener", err)
+	}
+}
+
+// Config is the configuration of a sharded DB
+type Config struct {
+	URLs []string
+	// Label partitions events by the value of a label, if empty events are partitioned by name
+	Label string
+	// Replicas is the number of points per shard on the hash ring
+	Replicas int
+}
+
+// ParseURL parses a sharded DB configuration URL.
+//
+// The URL has a `db` query param for each shard, ie `shard://?db=badger:///a&db=badger:///b&label=host`.
+// Param values containing '&' must be escaped.
+// The `label` param partitions events by event name and label value.
+// The `replicas` param sets the number of points per shard on the hash ring, defaults to 128.
+// Changing the order of `db` params does not move events across shards, changing their URLs does.
+func ParseURL(configURL string) (*Config, error) {
+	u, err := url.Parse(configURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != urlScheme {
+		return nil, errors.Errorf(`Invalid scheme %q != %q`, u.Scheme, urlScheme)
+	}
+	q := u.Query()
+	config := Config{
+		URLs:     q["db"],
+		Label:    q.Get("label"),
+		Replicas: defaultReplicas,
+	}
+	if len(config.URLs) == 0 {
+		return nil, errors.Errorf("No db params in %q", configURL)
+	}
+	if v := q.Get("replicas"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, errors.Errorf("Invalid replicas %q", v)
+		}
+		config.Replicas = n
+	}
+	return &config, nil
+}
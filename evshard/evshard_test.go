@@ -0,0 +1,208 @@
+package evshard_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/events"
+	"github.com/alxarch/evdb/evshard"
+	"github.com/alxarch/evdb/evutil"
+	"github.com/alxarch/evdb/internal/assert"
+)
+
+type testDB struct {
+	evutil.MemoryStore
+	scans int
+	fail  bool
+}
+
+func (db *testDB) Storer(event string) (evdb.Storer, error) {
+	w, err := db.MemoryStore.Storer(event)
+	if err != nil {
+		return nil, err
+	}
+	return failStorer{w, db}, nil
+}
+
+type failStorer struct {
+	evdb.Storer
+	db *testDB
+}
+
+func (w failStorer) Store(s *evdb.Snapshot) error {
+	if w.db.fail {
+		return errors.New("Store failed")
+	}
+	return w.Storer.Store(s)
+}
+
+func (db *testDB) Scan(ctx context.Context, queries ...evdb.Query) (evdb.Results, error) {
+	db.scans++
+	return db.MemoryStore.Scan(ctx, queries...)
+}
+
+func (db *testDB) Estimate(_ context.Context, q *evdb.Query) (int64, error) {
+	return int64(db.MemoryStore[q.Event].Len()), nil
+}
+
+func (db *testDB) Close() error {
+	return nil
+}
+
+func openTestDB(label string, n int, events ...string) (*evshard.DB, []*testDB) {
+	var (
+		shards []evshard.Shard
+		dbs    []*testDB
+	)
+	for i := 0; i < n; i++ {
+		db := &testDB{MemoryStore: evutil.NewMemoryStore(events...)}
+		dbs = append(dbs, db)
+		shards = append(shards, evshard.Shard{
+			Name: fmt.Sprintf("shard-%d", i),
+			DB:   db,
+		})
+	}
+	config := evshard.Config{Label: label}
+	return evshard.Open(&config, shards...), dbs
+}
+
+func TestShard(t *testing.T) {
+	db3, _ := openTestDB("", 3)
+	db4, _ := openTestDB("", 4)
+	moved := 0
+	counts := make([]int, 3)
+	const numEvents = 1000
+	for i := 0; i < numEvents; i++ {
+		event := fmt.Sprintf("event-%d", i)
+		s3, s4 := db3.Shard(event, ""), db4.Shard(event, "")
+		counts[s3]++
+		if s3 != s4 {
+			assert.Equal(t, s4, 3)
+			moved++
+		}
+	}
+	for _, n := range counts {
+		assert.OK(t, n > numEvents/5, "Uneven shard sizes %v", counts)
+	}
+	assert.OK(t, moved < numEvents/2, "Adding a shard moved %d of %d events", moved, numEvents)
+}
+
+func TestDB(t *testing.T) {
+	db, shards := openTestDB("host", 3, "foo")
+	now := time.Now()
+	w, err := db.Storer("foo")
+	assert.NoError(t, err)
+	snap := evdb.Snapshot{
+		Time:   now,
+		Labels: []string{"host", "method"},
+	}
+	for i := 0; i < 10; i++ {
+		snap.Counters = append(snap.Counters, events.Counter{
+			Values: []string{fmt.Sprintf("host-%d", i), "GET"},
+			Count:  int64(i + 1),
+		})
+	}
+	assert.NoError(t, w.Store(&snap))
+	for _, s := range shards {
+		assert.OK(t, s.MemoryStore["foo"].Len() == 1, "Snapshot split to all shards")
+	}
+
+	ctx := context.Background()
+	q := evdb.Query{
+		Event: "foo",
+		TimeRange: evdb.TimeRange{
+			Start: now.Add(-time.Minute),
+			End:   now.Add(time.Minute),
+			Step:  time.Minute,
+		},
+	}
+	results, err := db.Scan(ctx, q)
+	assert.NoError(t, err)
+	assert.Equal(t, len(results), 10)
+	var sum float64
+	for _, r := range results {
+		sum += r.Data.Sum()
+	}
+	assert.Equal(t, sum, 55.0)
+
+	q.Fields = evdb.MatchFields{"host": evdb.MatchString("host-3")}
+	results, err = db.Scan(ctx, q)
+	assert.NoError(t, err)
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, results[0].Data.Sum(), 4.0)
+	scans := 0
+	for _, s := range shards {
+		scans += s.scans
+	}
+	assert.Equal(t, scans, len(shards)+1)
+
+	// Only the shards a query is sent to are estimated
+	estimates, err := evdb.EstimateBackends(ctx, db, &q)
+	assert.NoError(t, err)
+	assert.Equal(t, estimates, []evdb.BackendEstimate{
+		{Backend: fmt.Sprintf("shard-%d", db.Shard("foo", "host-3")), Rows: 1},
+	})
+	q.Fields = nil
+	estimates, err = evdb.EstimateBackends(ctx, db, &q)
+	assert.NoError(t, err)
+	assert.Equal(t, len(estimates), len(shards))
+}
+
+func TestDB_OffsetQueries(t *testing.T) {
+	db, shards := openTestDB("host", 3, "foo")
+	now := time.Now().Truncate(time.Minute)
+	w, err := db.Storer("foo")
+	assert.NoError(t, err)
+	for i, tm := range []time.Time{now.Add(-24 * time.Hour), now} {
+		assert.NoError(t, w.Store(&evdb.Snapshot{
+			Time:   tm,
+			Labels: []string{"host"},
+			Counters: []events.Counter{
+				{Values: []string{"a"}, Count: int64(i + 1)},
+				{Values: []string{"b"}, Count: int64(10 * (i + 1))},
+			},
+		}))
+	}
+	tr := evdb.TimeRange{
+		Start: now.Add(-time.Minute),
+		End:   now.Add(time.Minute),
+		Step:  time.Minute,
+	}
+	queries := []evdb.Query{
+		{Event: "foo", TimeRange: tr},
+		{Event: "foo", TimeRange: tr.Offset(-24 * time.Hour)},
+		{Event: "foo", TimeRange: tr, Fields: evdb.MatchFields{"host": evdb.MatchString("a")}},
+	}
+	results, err := db.Scan(context.Background(), queries...)
+	assert.NoError(t, err)
+	assert.Equal(t, len(results), 5)
+	sums := make(map[string]float64)
+	for _, r := range results {
+		host, _ := r.Fields.Get("host")
+		sums[r.TimeRange.Start.Sub(tr.Start).String()+" "+host] += r.Data.Sum()
+	}
+	assert.Equal(t, sums, map[string]float64{
+		"0s a":       4,
+		"0s b":       20,
+		"-24h0m0s a": 1,
+		"-24h0m0s b": 10,
+	})
+
+	// Parts stored to healthy shards are kept
+	failed := db.Shard("foo", "a")
+	shards[failed].fail = true
+	err = w.Store(&evdb.Snapshot{
+		Time:   now,
+		Labels: []string{"host"},
+		Counters: []events.Counter{
+			{Values: []string{"a"}, Count: 1},
+			{Values: []string{"b"}, Count: 1},
+		},
+	})
+	assert.OK(t, err != nil && strings.Contains(err.Error(), fmt.Sprintf("shard-%d", failed)), "Failed shard in error %v", err)
+}
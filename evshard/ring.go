@@ -0,0 +1,69 @@
+package evshard
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// defaultReplicas is the default number of points each shard has on the hash ring
+const defaultReplicas = 128
+
+// ring is a consistent hash ring.
+// Points are derived from shard names so adding or removing a shard only moves the keys of that shard.
+type ring struct {
+	points []uint32
+	shards []int
+}
+
+func newRing(names []string, replicas int) *ring {
+	if replicas < 1 {
+		replicas = defaultReplicas
+	}
+	r := ring{
+		points: make([]uint32, 0, len(names)*replicas),
+		shards: make([]int, 0, len(names)*replicas),
+	}
+	for i, name := range names {
+		for j := 0; j < replicas; j++ {
+			r.points = append(r.points, hashString(strconv.Itoa(j)+"-"+name))
+			r.shards = append(r.shards, i)
+		}
+	}
+	sort.Sort(&r)
+	return &r
+}
+
+func (r *ring) Len() int {
+	return len(r.points)
+}
+
+func (r *ring) Less(i, j int) bool {
+	return r.points[i] < r.points[j]
+}
+
+func (r *ring) Swap(i, j int) {
+	r.points[i], r.points[j] = r.points[j], r.points[i]
+	r.shards[i], r.shards[j] = r.shards[j], r.shards[i]
+}
+
+// shard returns the index of the shard owning key
+func (r *ring) shard(key string) int {
+	if len(r.points) == 0 {
+		return -1
+	}
+	h := hashString(key)
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i] >= h
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.shards[i]
+}
+
+func hashString(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
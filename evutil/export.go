@@ -0,0 +1,330 @@
+package evutil
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	db "github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/events"
+	errors "golang.org/x/xerrors"
+)
+
+// Record is a single exported event counter
+type Record struct {
+	Time   time.Time
+	Event  string
+	Fields db.Fields
+	Count  int64
+}
+
+// Export formats
+const (
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+)
+
+// csvColumns are the leading columns of CSV exports, the rest are labels
+var csvColumns = []string{"time", "event", "count"}
+
+// AppendRecords appends records for all data points in results, sorted by time, event and fields
+func AppendRecords(dst []Record, results db.Results) []Record {
+	offset := len(dst)
+	for i := range results {
+		r := &results[i]
+		for _, p := range r.Data {
+			dst = append(dst, Record{
+				Time:   time.Unix(p.Timestamp, 0).UTC(),
+				Event:  r.Event,
+				Fields: r.Fields,
+				Count:  int64(p.Value),
+			})
+		}
+	}
+	records := dst[offset:]
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := &records[i], &records[j]
+		if !a.Time.Equal(b.Time) {
+			return a.Time.Before(b.Time)
+		}
+		if a.Event != b.Event {
+			return a.Event < b.Event
+		}
+		return fieldsLess(a.Fields, b.Fields)
+	})
+	return dst
+}
+
+func fieldsLess(a, b db.Fields) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].Label != b[i].Label {
+			return a[i].Label < b[i].Label
+		}
+		if a[i].Value != b[i].Value {
+			return a[i].Value < b[i].Value
+		}
+	}
+	return len(a) < len(b)
+}
+
+type jsonRecord struct {
+	Time   time.Time `json:"time"`
+	Event  string    `json:"event"`
+	Fields db.Fields `json:"fields"`
+	Count  int64     `json:"count"`
+}
+
+// WriteRecords writes records in NDJSON or CSV format.
+// CSV output has a `time,event,count` header followed by the labels of all records.
+func WriteRecords(w io.Writer, format string, records []Record) error {
+	var labels []string
+	if format == FormatCSV {
+		labels = RecordLabels(nil, records)
+	}
+	rw, err := NewRecordWriter(w, format, labels...)
+	if err != nil {
+		return err
+	}
+	return rw.Write(records)
+}
+
+// RecordLabels appends the distinct labels of records to labels and sorts them
+func RecordLabels(labels []string, records []Record) []string {
+	for i := range records {
+		for _, f := range records[i].Fields {
+			labels = append(labels, f.Label)
+		}
+	}
+	sort.Strings(labels)
+	return distinctSorted(labels)
+}
+
+// RecordWriter writes records in NDJSON or CSV format as they arrive.
+// CSV columns are fixed by the labels the writer is created with.
+type RecordWriter struct {
+	format string
+	labels []string
+	header bool
+	buf    *bufio.Writer
+	enc    *json.Encoder
+	csv    *csv.Writer
+	row    []string
+}
+
+// NewRecordWriter creates a RecordWriter, labels are the label columns of CSV output
+func NewRecordWriter(w io.Writer, format string, labels ...string) (*RecordWriter, error) {
+	rw := RecordWriter{format: format}
+	switch format {
+	case FormatNDJSON, "":
+		rw.buf = bufio.NewWriter(w)
+		rw.enc = json.NewEncoder(rw.buf)
+	case FormatCSV:
+		rw.labels = labels
+		rw.csv = csv.NewWriter(w)
+	default:
+		return nil, errors.Errorf("Invalid export format %q", format)
+	}
+	return &rw, nil
+}
+
+// Write writes and flushes records.
+// Records with labels that are not CSV columns are rejected.
+func (rw *RecordWriter) Write(records []Record) error {
+	if rw.csv == nil {
+		for i := range records {
+			r := &records[i]
+			if err := rw.enc.Encode(jsonRecord(*r)); err != nil {
+				return err
+			}
+		}
+		return rw.buf.Flush()
+	}
+	if !rw.header {
+		// The header is written even if there are no records
+		rw.row = append(append(rw.row[:0], csvColumns...), rw.labels...)
+		if err := rw.csv.Write(rw.row); err != nil {
+			return err
+		}
+		rw.header = true
+	}
+	for i := range records {
+		r := &records[i]
+		for _, f := range r.Fields {
+			if !hasString(rw.labels, f.Label) {
+				return errors.Errorf("Label %q of event %q is not a CSV column", f.Label, r.Event)
+			}
+		}
+		rw.row = append(rw.row[:0], r.Time.Format(time.RFC3339), r.Event, strconv.FormatInt(r.Count, 10))
+		rw.row = r.Fields.AppendValues(rw.row, "", rw.labels...)
+		if err := rw.csv.Write(rw.row); err != nil {
+			return err
+		}
+	}
+	rw.csv.Flush()
+	return rw.csv.Error()
+}
+
+// ReadRecords reads records in NDJSON or CSV format calling fn for each record
+func ReadRecords(r io.Reader, format string, fn func(r *Record) error) error {
+	switch format {
+	case FormatNDJSON, "":
+		dec := json.NewDecoder(r)
+		for {
+			var tmp jsonRecord
+			if err := dec.Decode(&tmp); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+			rec := Record(tmp)
+			if err := fn(&rec); err != nil {
+				return err
+			}
+		}
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		header, err := cr.Read()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if len(header) < len(csvColumns) || !stringsEqual(header[:len(csvColumns)], csvColumns) {
+			return errors.Errorf("Invalid CSV header %q", header)
+		}
+		labels := header[len(csvColumns):]
+		for {
+			row, err := cr.Read()
+			if err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+			var rec Record
+			if rec.Time, err = time.Parse(time.RFC3339, row[0]); err != nil {
+				return err
+			}
+			rec.Event = row[1]
+			if rec.Count, err = strconv.ParseInt(row[2], 10, 64); err != nil {
+				return err
+			}
+			for i, label := range labels {
+				if v := row[len(csvColumns)+i]; v != "" {
+					rec.Fields = append(rec.Fields, db.Field{Label: label, Value: v})
+				}
+			}
+			if err := fn(&rec); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.Errorf("Invalid export format %q", format)
+	}
+}
+
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Importer replays records through a Store.
+// Consecutive records of an event with the same time are stored as a single snapshot.
+type Importer struct {
+	Store db.Store
+
+	// Snapshots is the number of stored snapshots
+	Snapshots int
+	// Records is the number of imported records
+	Records int
+
+	storers map[string]db.Storer
+	pending map[string][]Record
+}
+
+// Import adds a record, storing pending records of the event if the time changed
+func (im *Importer) Import(r *Record) error {
+	if im.pending == nil {
+		im.pending = make(map[string][]Record)
+	}
+	pending := im.pending[r.Event]
+	if len(pending) > 0 && !pending[0].Time.Equal(r.Time) {
+		if err := im.store(r.Event, pending); err != nil {
+			return err
+		}
+		pending = pending[:0]
+	}
+	im.pending[r.Event] = append(pending, *r)
+	im.Records++
+	return nil
+}
+
+// Flush stores all pending records
+func (im *Importer) Flush() error {
+	names := make([]string, 0, len(im.pending))
+	for event := range im.pending {
+		names = append(names, event)
+	}
+	sort.Strings(names)
+	for _, event := range names {
+		if err := im.store(event, im.pending[event]); err != nil {
+			return err
+		}
+		delete(im.pending, event)
+	}
+	return nil
+}
+
+func (im *Importer) store(event string, records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	s, ok := im.storers[event]
+	if !ok {
+		var err error
+		if s, err = im.Store.Storer(event); err != nil {
+			return err
+		}
+		if im.storers == nil {
+			im.storers = make(map[string]db.Storer)
+		}
+		im.storers[event] = s
+	}
+	var labels []string
+	for i := range records {
+		for _, f := range records[i].Fields {
+			labels = append(labels, f.Label)
+		}
+	}
+	sort.Strings(labels)
+	snap := db.Snapshot{
+		Time:     records[0].Time,
+		Labels:   distinctSorted(labels),
+		Counters: make([]events.Counter, len(records)),
+	}
+	for i := range records {
+		r := &records[i]
+		snap.Counters[i] = events.Counter{
+			Values: r.Fields.AppendValues(nil, "", snap.Labels...),
+			Count:  r.Count,
+		}
+	}
+	if err := s.Store(&snap); err != nil {
+		return errors.Errorf("Failed to store %q snapshot at %s: %w", event, snap.Time, err)
+	}
+	im.Snapshots++
+	return nil
+}
@@ -0,0 +1,86 @@
+package evutil_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	meter "github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/evutil"
+	"github.com/alxarch/evdb/internal/assert"
+)
+
+func TestExportImport(t *testing.T) {
+	tm := time.Date(2019, time.May, 15, 13, 14, 0, 0, time.UTC)
+	results := meter.Results{
+		{
+			Event:  "foo",
+			Fields: meter.Fields{{Label: "color", Value: "blue"}, {Label: "taste", Value: "sour"}},
+			Data:   meter.DataPoints{{Timestamp: tm.Unix(), Value: 3}, {Timestamp: tm.Unix() + 1, Value: 4}},
+		},
+		{
+			Event:  "foo",
+			Fields: meter.Fields{{Label: "color", Value: "green"}},
+			Data:   meter.DataPoints{{Timestamp: tm.Unix(), Value: 12}},
+		},
+		{
+			Event:  "bar",
+			Fields: meter.Fields{{Label: "size", Value: "XL, wide"}},
+			Data:   meter.DataPoints{{Timestamp: tm.Unix(), Value: 1}},
+		},
+	}
+	records := evutil.AppendRecords(nil, results)
+	assert.Equal(t, len(records), 4)
+	assert.Equal(t, records[0].Event, "bar")
+	assert.Equal(t, records[3].Time, tm.Add(time.Second))
+
+	for _, format := range []string{evutil.FormatNDJSON, evutil.FormatCSV} {
+		var buf bytes.Buffer
+		assert.NoError(t, evutil.WriteRecords(&buf, format, records))
+		var read []evutil.Record
+		store := evutil.NewMemoryStore("foo", "bar")
+		im := evutil.Importer{Store: store}
+		assert.NoError(t, evutil.ReadRecords(&buf, format, func(r *evutil.Record) error {
+			read = append(read, *r)
+			return im.Import(r)
+		}))
+		assert.NoError(t, im.Flush())
+		for i := range read {
+			read[i].Time = read[i].Time.UTC()
+		}
+		assert.Equal(t, read, records)
+		assert.Equal(t, im.Records, 4)
+		assert.Equal(t, im.Snapshots, 3)
+		assert.Equal(t, store["foo"].Len(), 2)
+		last := store["foo"].Last()
+		assert.Equal(t, last.Labels, []string{"color", "taste"})
+		assert.Equal(t, last.Counters[0].Values, []string{"blue", "sour"})
+		assert.Equal(t, last.Counters[0].Count, int64(4))
+	}
+	if err := evutil.WriteRecords(new(bytes.Buffer), "xml", records); err == nil {
+		t.Error("WriteRecords() invalid format no error")
+	}
+}
+
+func TestRecordWriter(t *testing.T) {
+	tm := time.Date(2019, time.May, 15, 13, 14, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	rw, err := evutil.NewRecordWriter(&buf, evutil.FormatCSV, "color", "size")
+	assert.NoError(t, err)
+	// Each chunk is written as it arrives
+	assert.NoError(t, rw.Write([]evutil.Record{
+		{Time: tm, Event: "foo", Fields: meter.Fields{{Label: "color", Value: "blue"}}, Count: 1},
+	}))
+	assert.Equal(t, buf.String(), "time,event,count,color,size\n2019-05-15T13:14:00Z,foo,1,blue,\n")
+	assert.NoError(t, rw.Write([]evutil.Record{
+		{Time: tm, Event: "bar", Fields: meter.Fields{{Label: "size", Value: "XL"}}, Count: 2},
+	}))
+	assert.Equal(t, buf.String(), "time,event,count,color,size\n2019-05-15T13:14:00Z,foo,1,blue,\n2019-05-15T13:14:00Z,bar,2,,XL\n")
+	err = rw.Write([]evutil.Record{
+		{Time: tm, Event: "bar", Fields: meter.Fields{{Label: "taste", Value: "sour"}}, Count: 2},
+	})
+	assert.OK(t, err != nil, "Labels missing from the CSV header are rejected")
+
+	_, err = evutil.NewRecordWriter(&buf, "xml")
+	assert.OK(t, err != nil, "Invalid format")
+}
@@ -0,0 +1,137 @@
+package evutil
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	db "github.com/alxarch/evdb"
+)
+
+// Hub is a Store that publishes stored snapshots to subscribers
+type Hub struct {
+	store db.Store
+
+	mu   sync.RWMutex
+	subs map[string]map[*Subscription]struct{}
+}
+
+var _ db.Store = (*Hub)(nil)
+
+// NewHub creates a Hub that stores snapshots to store
+func NewHub(store db.Store) *Hub {
+	return &Hub{
+		store: store,
+		subs:  make(map[string]map[*Subscription]struct{}),
+	}
+}
+
+// Storer implements Store interface
+func (h *Hub) Storer(event string) (db.Storer, error) {
+	s, err := h.store.Storer(event)
+	if err != nil || s == nil {
+		return s, err
+	}
+	return &hubStorer{Storer: s, hub: h, event: event}, nil
+}
+
+type hubStorer struct {
+	db.Storer
+	hub   *Hub
+	event string
+}
+
+func (s *hubStorer) Store(snapshot *db.Snapshot) error {
+	if err := s.Storer.Store(snapshot); err != nil {
+		return err
+	}
+	s.hub.publish(s.event, snapshot)
+	return nil
+}
+
+// publish sends a copy of a snapshot to all subscribers of event that are not lagging behind
+func (h *Hub) publish(event string, s *db.Snapshot) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	subs := h.subs[event]
+	if len(subs) == 0 {
+		return
+	}
+	s = s.Copy()
+	for sub := range subs {
+		select {
+		case sub.c <- s:
+		default:
+			atomic.AddInt64(&sub.dropped, 1)
+		}
+	}
+}
+
+// Subscription receives snapshots stored for an event
+type Subscription struct {
+	Event string
+	// C receives stored snapshots, they are shared with other subscribers and must not be modified
+	C <-chan *db.Snapshot
+
+	c       chan *db.Snapshot
+	hub     *Hub
+	dropped int64
+	once    sync.Once
+}
+
+// Subscribe subscribes to snapshots of an event.
+// Snapshots are dropped if more than size snapshots are pending.
+func (h *Hub) Subscribe(event string, size int) *Subscription {
+	c := make(chan *db.Snapshot, size)
+	sub := Subscription{
+		Event: event,
+		C:     c,
+		c:     c,
+		hub:   h,
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subs := h.subs[event]
+	if subs == nil {
+		subs = make(map[*Subscription]struct{})
+		h.subs[event] = subs
+	}
+	subs[&sub] = struct{}{}
+	return &sub
+}
+
+// Close unsubscribes and closes C
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		h := s.hub
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subs[s.Event], s)
+		if len(h.subs[s.Event]) == 0 {
+			delete(h.subs, s.Event)
+		}
+		close(s.c)
+	})
+}
+
+// Dropped returns the number of snapshots dropped because the subscriber was lagging behind
+func (s *Subscription) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// SnapshotResults converts the counters of a snapshot matching a query to results
+func SnapshotResults(results db.Results, q *db.Query, s *db.Snapshot) db.Results {
+	step := int64(q.Step / time.Second)
+	if step < 1 {
+		step = 1
+	}
+	tm := stepTS(s.Time.Unix(), step)
+	for i := range s.Counters {
+		c := &s.Counters[i]
+		fields := ZipFields(s.Labels, c.Values)
+		if q.Fields.Match(fields) {
+			results = results.Add(q.Event, fields, tm, float64(c.Count))
+		}
+	}
+	return results
+}
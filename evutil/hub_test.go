@@ -0,0 +1,50 @@
+package evutil_test
+
+import (
+	"testing"
+	"time"
+
+	meter "github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/events"
+	"github.com/alxarch/evdb/evutil"
+	"github.com/alxarch/evdb/internal/assert"
+)
+
+func TestHub(t *testing.T) {
+	hub := evutil.NewHub(evutil.NewMemoryStore("foo", "bar"))
+	foo := hub.Subscribe("foo", 1)
+	bar := hub.Subscribe("bar", 1)
+	defer bar.Close()
+	w, err := hub.Storer("foo")
+	assert.NoError(t, err)
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		err := w.Store(&meter.Snapshot{
+			Time:   now.Add(time.Duration(i) * time.Second),
+			Labels: []string{"color"},
+			Counters: []events.Counter{
+				{Count: 1, Values: []string{"blue"}},
+				{Count: 2, Values: []string{"red"}},
+			},
+		})
+		assert.NoError(t, err)
+	}
+	s := <-foo.C
+	assert.Equal(t, s.Time, now)
+	assert.Equal(t, foo.Dropped(), int64(1))
+	assert.Equal(t, len(bar.C), 0)
+
+	q := meter.Query{
+		Event:     "foo",
+		Fields:    meter.MatchFields{"color": meter.MatchString("red")},
+		TimeRange: meter.TimeRange{Step: time.Minute},
+	}
+	results := evutil.SnapshotResults(nil, &q, s)
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, results[0].Data, meter.DataPoints{{Timestamp: now.Unix() - now.Unix()%60, Value: 2}})
+
+	foo.Close()
+	_, ok := <-foo.C
+	assert.OK(t, !ok, "Subscription is closed")
+	foo.Close()
+}
@@ -0,0 +1,410 @@
+package evutil
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	db "github.com/alxarch/evdb"
+	errors "golang.org/x/xerrors"
+)
+
+// Report formats
+const (
+	FormatTSV   = "tsv"
+	FormatExcel = "excel"
+)
+
+// Report layouts
+const (
+	LayoutLong = "long"
+	LayoutWide = "wide"
+)
+
+// Pivot dimensions besides labels
+const (
+	PivotTime  = "time"
+	PivotEvent = "event"
+)
+
+// Report writes results as CSV, TSV or Excel friendly CSV.
+//
+// The long layout has a `time,event,value` row for each data point with a column for each label.
+// The wide layout pivots the values of the Pivot dimensions to columns.
+// Pivoting by `time` has a row for each result and a column for each step,
+// pivoting by labels or `event` has a row for each step and a column for each distinct value of the pivot dimensions.
+type Report struct {
+	Format string
+	Layout string
+	Pivot  []string
+}
+
+// IsReportFormat checks if format is a Report format
+func IsReportFormat(format string) bool {
+	switch strings.ToLower(format) {
+	case FormatCSV, FormatTSV, FormatExcel:
+		return true
+	default:
+		return false
+	}
+}
+
+// ReportFormatFromMIME returns the Report format for a MIME type
+func ReportFormatFromMIME(m string) string {
+	switch strings.ToLower(m) {
+	case "text/csv":
+		return FormatCSV
+	case "text/tab-separated-values":
+		return FormatTSV
+	case "application/vnd.ms-excel":
+		return FormatExcel
+	default:
+		return ""
+	}
+}
+
+// ContentType returns the MIME type of a report.
+// Excel reports are CSV files so their MIME type is `text/csv`.
+func (r *Report) ContentType() string {
+	switch strings.ToLower(r.Format) {
+	case FormatTSV:
+		return "text/tab-separated-values; charset=utf-8"
+	default:
+		return "text/csv; charset=utf-8"
+	}
+}
+
+// FileName returns the file name of a report with the extension of its MIME type
+func (r *Report) FileName(name string) string {
+	switch strings.ToLower(r.Format) {
+	case FormatTSV:
+		return name + ".tsv"
+	default:
+		return name + ".csv"
+	}
+}
+
+// Validate checks a report for errors
+func (r *Report) Validate() error {
+	if !IsReportFormat(r.Format) {
+		return errors.Errorf("Invalid report format %q", r.Format)
+	}
+	switch strings.ToLower(r.Layout) {
+	case "":
+	case LayoutLong:
+		if len(r.Pivot) > 0 {
+			return errors.New("Invalid pivot for long report layout")
+		}
+	case LayoutWide:
+	default:
+		return errors.Errorf("Invalid report layout %q", r.Layout)
+	}
+	for _, p := range r.Pivot {
+		if p == "" {
+			return errors.New("Empty report pivot")
+		}
+		if p == PivotTime && len(r.Pivot) > 1 {
+			return errors.New("Invalid report pivot, time cannot be combined with other pivots")
+		}
+	}
+	return nil
+}
+
+// pivot returns the pivot dimensions, nil for the long layout
+func (r *Report) pivot() []string {
+	if len(r.Pivot) > 0 {
+		return r.Pivot
+	}
+	if strings.ToLower(r.Layout) == LayoutWide {
+		return []string{PivotTime}
+	}
+	return nil
+}
+
+// Write writes results to w
+func (r *Report) Write(w io.Writer, results db.Results) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	excel := false
+	cw := csv.NewWriter(w)
+	switch strings.ToLower(r.Format) {
+	case FormatTSV:
+		cw.Comma = '\t'
+	case FormatExcel:
+		excel = true
+		cw.UseCRLF = true
+		// Excel detects UTF-8 by the byte order mark
+		if _, err := io.WriteString(w, "\ufeff"); err != nil {
+			return err
+		}
+	}
+	if err := cw.WriteAll(r.Rows(results, excel)); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// Rows returns the rows of the report including the header.
+// Text cells that a spreadsheet would evaluate as formulas are escaped in all formats.
+// If excel is set times are formatted so that Excel parses them.
+func (r *Report) Rows(results db.Results, excel bool) [][]string {
+	rows := newReportRows(results, excel)
+	switch pivot := r.pivot(); {
+	case len(pivot) == 0:
+		return rows.long()
+	case pivot[0] == PivotTime:
+		return rows.wideByTime()
+	default:
+		return rows.wideByLabels(pivot)
+	}
+}
+
+type reportRows struct {
+	results db.Results
+	labels  []string
+	excel   bool
+}
+
+func newReportRows(results db.Results, excel bool) *reportRows {
+	results = append(db.Results(nil), results...)
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := &results[i], &results[j]
+		if a.Event != b.Event {
+			return a.Event < b.Event
+		}
+		return fieldsLess(a.Fields, b.Fields)
+	})
+	var labels []string
+	for i := range results {
+		for _, f := range results[i].Fields {
+			labels = append(labels, f.Label)
+		}
+	}
+	sort.Strings(labels)
+	return &reportRows{
+		results: results,
+		labels:  distinctSorted(labels),
+		excel:   excel,
+	}
+}
+
+// text escapes values that spreadsheets would evaluate as formulas
+func (rr *reportRows) text(s string) string {
+	if len(s) > 0 {
+		switch s[0] {
+		case '=', '+', '-', '@', '\t', '\r':
+			return "'" + s
+		}
+	}
+	return s
+}
+
+func (rr *reportRows) time(ts int64) string {
+	tm := time.Unix(ts, 0).UTC()
+	if rr.excel {
+		return tm.Format("2006-01-02 15:04:05")
+	}
+	return tm.Format(time.RFC3339)
+}
+
+func (rr *reportRows) header(cols ...string) []string {
+	row := make([]string, len(cols))
+	for i, col := range cols {
+		row[i] = rr.text(col)
+	}
+	return row
+}
+
+func (rr *reportRows) values(row []string, fields db.Fields, labels []string) []string {
+	for _, v := range fields.AppendValues(nil, "", labels...) {
+		row = append(row, rr.text(v))
+	}
+	return row
+}
+
+func formatValue(v float64) string {
+	if math.IsNaN(v) {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func (rr *reportRows) long() [][]string {
+	var points []reportPoint
+	for i := range rr.results {
+		r := &rr.results[i]
+		for _, p := range r.Data {
+			points = append(points, reportPoint{r, p})
+		}
+	}
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].Timestamp < points[j].Timestamp
+	})
+	header := rr.header(append([]string{"time", "event"}, rr.labels...)...)
+	rows := [][]string{append(header, "value")}
+	for _, p := range points {
+		row := []string{rr.time(p.Timestamp), rr.text(p.Event)}
+		row = rr.values(row, p.Fields, rr.labels)
+		rows = append(rows, append(row, formatValue(p.Value)))
+	}
+	return rows
+}
+
+type reportPoint struct {
+	*db.Result
+	db.DataPoint
+}
+
+func (rr *reportRows) wideByTime() [][]string {
+	var times []int64
+	for i := range rr.results {
+		for _, p := range rr.results[i].Data {
+			times = append(times, p.Timestamp)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	times = distinctTimes(times)
+	header := rr.header(append([]string{"event"}, rr.labels...)...)
+	for _, ts := range times {
+		header = append(header, rr.time(ts))
+	}
+	rows := [][]string{header}
+	for i := range rr.results {
+		r := &rr.results[i]
+		row := rr.values([]string{rr.text(r.Event)}, r.Fields, rr.labels)
+		cells := make([]string, len(times))
+		for _, p := range r.Data {
+			j := sort.Search(len(times), func(j int) bool { return times[j] >= p.Timestamp })
+			cells[j] = formatValue(p.Value)
+		}
+		rows = append(rows, append(row, cells...))
+	}
+	return rows
+}
+
+func distinctTimes(times []int64) []int64 {
+	var i int
+	for _, ts := range times {
+		if i == 0 || ts != times[i-1] {
+			times[i] = ts
+			i++
+		}
+	}
+	return times[:i]
+}
+
+func (rr *reportRows) wideByLabels(pivot []string) [][]string {
+	// Row dimensions are the event unless pivoted and all labels that are not pivoted
+	var labels []string
+	for _, label := range rr.labels {
+		if !hasString(pivot, label) {
+			labels = append(labels, label)
+		}
+	}
+	byEvent := !hasString(pivot, PivotEvent)
+	type wideRow struct {
+		Timestamp int64
+		Cells     []string
+		Values    map[string]float64
+	}
+	var (
+		rows    []*wideRow
+		rowKeys = make(map[string]*wideRow)
+		columns []string
+	)
+	for i := range rr.results {
+		r := &rr.results[i]
+		col := pivotColumn(r, pivot)
+		columns = append(columns, col)
+		for _, p := range r.Data {
+			cells := []string{rr.time(p.Timestamp)}
+			if byEvent {
+				cells = append(cells, rr.text(r.Event))
+			}
+			cells = rr.values(cells, r.Fields, labels)
+			key := strings.Join(cells, "\x00")
+			row := rowKeys[key]
+			if row == nil {
+				row = &wideRow{
+					Timestamp: p.Timestamp,
+					Cells:     cells,
+					Values:    make(map[string]float64),
+				}
+				rowKeys[key] = row
+				rows = append(rows, row)
+			}
+			// Values of results with the same row and column are added
+			if v, ok := row.Values[col]; ok && !math.IsNaN(v) {
+				if !math.IsNaN(p.Value) {
+					row.Values[col] = v + p.Value
+				}
+				continue
+			}
+			row.Values[col] = p.Value
+		}
+	}
+	sort.Strings(columns)
+	columns = distinctSorted(columns)
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Timestamp < rows[j].Timestamp
+	})
+	header := []string{"time"}
+	if byEvent {
+		header = append(header, "event")
+	}
+	header = append(header, labels...)
+	out := [][]string{rr.header(append(header, columns...)...)}
+	for _, row := range rows {
+		cells := row.Cells
+		for _, col := range columns {
+			v, ok := row.Values[col]
+			if !ok {
+				v = math.NaN()
+			}
+			cells = append(cells, formatValue(v))
+		}
+		out = append(out, cells)
+	}
+	return out
+}
+
+// pivotColumn returns the column name of a result for the pivot dimensions.
+// Columns of multiple dimensions are named `dim=value` separated by commas.
+func pivotColumn(r *db.Result, pivot []string) string {
+	values := make([]string, len(pivot))
+	for i, p := range pivot {
+		v, _ := r.Fields.Get(p)
+		if p == PivotEvent {
+			v = r.Event
+		}
+		values[i] = v
+	}
+	if len(values) == 1 {
+		return values[0]
+	}
+	var buf bytes.Buffer
+	for i, p := range pivot {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(p)
+		buf.WriteByte('=')
+		buf.WriteString(values[i])
+	}
+	return buf.String()
+}
+
+func hasString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
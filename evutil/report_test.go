@@ -0,0 +1,132 @@
+package evutil_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"math"
+	"testing"
+	"time"
+
+	db "github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/evutil"
+	"github.com/alxarch/evdb/internal/assert"
+)
+
+func TestReport(t *testing.T) {
+	tm := time.Date(2019, 1, 2, 10, 0, 0, 0, time.UTC)
+	tr := db.TimeRange{
+		Start: tm,
+		End:   tm.Add(time.Hour),
+		Step:  time.Hour,
+	}
+	result := func(event string, values []float64, fields ...db.Field) db.Result {
+		data := db.BlankData(&tr, 0)
+		for i := range data {
+			data[i].Value = values[i]
+		}
+		return db.Result{
+			Event:     event,
+			Fields:    fields,
+			TimeRange: tr,
+			Data:      data,
+		}
+	}
+	results := db.Results{
+		result("foo", []float64{1, 2}, db.Field{Label: "host", Value: "a"}, db.Field{Label: "code", Value: "500"}),
+		result("foo", []float64{3, math.NaN()}, db.Field{Label: "host", Value: "b"}, db.Field{Label: "code", Value: "500"}),
+		result("bar", []float64{5, 6}, db.Field{Label: "host", Value: "=a"}),
+	}
+	for _, tc := range []struct {
+		Name   string
+		Report evutil.Report
+		Want   string
+	}{
+		{"long", evutil.Report{Format: "csv"}, "" +
+			"time,event,code,host,value\n" +
+			"2019-01-02T10:00:00Z,bar,,'=a,5\n" +
+			"2019-01-02T10:00:00Z,foo,500,a,1\n" +
+			"2019-01-02T10:00:00Z,foo,500,b,3\n" +
+			"2019-01-02T11:00:00Z,bar,,'=a,6\n" +
+			"2019-01-02T11:00:00Z,foo,500,a,2\n" +
+			"2019-01-02T11:00:00Z,foo,500,b,\n"},
+		{"wide by time", evutil.Report{Format: "tsv", Layout: "wide"}, "" +
+			"event\tcode\thost\t2019-01-02T10:00:00Z\t2019-01-02T11:00:00Z\n" +
+			"bar\t\t'=a\t5\t6\n" +
+			"foo\t500\ta\t1\t2\n" +
+			"foo\t500\tb\t3\t\n"},
+		{"wide by labels", evutil.Report{Format: "csv", Pivot: []string{"event", "host"}}, "" +
+			"time,code,\"event=bar,host==a\",\"event=foo,host=a\",\"event=foo,host=b\"\n" +
+			"2019-01-02T10:00:00Z,,5,,\n" +
+			"2019-01-02T10:00:00Z,500,,1,3\n" +
+			"2019-01-02T11:00:00Z,,6,,\n" +
+			"2019-01-02T11:00:00Z,500,,2,\n"},
+		{"excel", evutil.Report{Format: "excel", Pivot: []string{"code"}}, "\ufeff" +
+			"time,event,host,,500\r\n" +
+			"2019-01-02 10:00:00,bar,'=a,5,\r\n" +
+			"2019-01-02 10:00:00,foo,a,,1\r\n" +
+			"2019-01-02 10:00:00,foo,b,,3\r\n" +
+			"2019-01-02 11:00:00,bar,'=a,6,\r\n" +
+			"2019-01-02 11:00:00,foo,a,,2\r\n" +
+			"2019-01-02 11:00:00,foo,b,,\r\n"},
+	} {
+		var buf bytes.Buffer
+		assert.NoError(t, tc.Report.Write(&buf, results))
+		assert.OK(t, buf.String() == tc.Want, "%s: invalid report\n%q\n%q", tc.Name, buf.String(), tc.Want)
+	}
+
+	for _, tc := range []struct {
+		Format      string
+		ContentType string
+		FileName    string
+	}{
+		{"csv", "text/csv; charset=utf-8", "results.csv"},
+		{"tsv", "text/tab-separated-values; charset=utf-8", "results.tsv"},
+		{"excel", "text/csv; charset=utf-8", "results.csv"},
+	} {
+		r := evutil.Report{Format: tc.Format}
+		assert.Equal(t, r.ContentType(), tc.ContentType)
+		assert.Equal(t, r.FileName("results"), tc.FileName)
+	}
+
+	for _, r := range []evutil.Report{
+		{Format: "xml"},
+		{Format: "csv", Layout: "diagonal"},
+		{Format: "csv", Layout: "long", Pivot: []string{"host"}},
+		{Format: "csv", Pivot: []string{"time", "host"}},
+	} {
+		assert.OK(t, r.Validate() != nil, "Invalid report %v", r)
+	}
+}
+
+func TestReport_FormulaInjection(t *testing.T) {
+	tr := db.TimeRange{
+		Start: time.Date(2019, 1, 2, 10, 0, 0, 0, time.UTC),
+		End:   time.Date(2019, 1, 2, 11, 0, 0, 0, time.UTC),
+		Step:  time.Hour,
+	}
+	for _, tc := range []struct {
+		Value string
+		Want  string
+	}{
+		{"=1+1", "'=1+1"},
+		{"+1", "'+1"},
+		{"-1", "'-1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1+1", "'\t=1+1"},
+		{"\r=1+1", "'\r=1+1"},
+		{"a=1", "a=1"},
+	} {
+		results := db.Results{{
+			Event:     "foo",
+			Fields:    db.Fields{{Label: "host", Value: tc.Value}},
+			TimeRange: tr,
+			Data:      db.DataPoints{{Timestamp: tr.Start.Unix(), Value: 1}},
+		}}
+		var buf bytes.Buffer
+		r := evutil.Report{Format: "csv"}
+		assert.NoError(t, r.Write(&buf, results))
+		rows, err := csv.NewReader(&buf).ReadAll()
+		assert.NoError(t, err)
+		assert.Equal(t, rows[1][2], tc.Want)
+	}
+}
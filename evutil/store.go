@@ -78,24 +78,12 @@ func (m MemoryStore) Scan(ctx context.Context, queries ...db.Query) (db.Results,
 		if !ok {
 			continue
 		}
-		step := int64(q.Step / time.Second)
-		if step < 1 {
-			step = 1
-		}
 		for i := range store.data {
 			d := &store.data[i]
-			if d.Time.Before(q.Start) {
+			if d.Time.Before(q.Start) || d.Time.Truncate(q.Step).After(q.End) {
 				continue
 			}
-			for j := range d.Counters {
-				c := &d.Counters[j]
-				fields := ZipFields(d.Labels, c.Values)
-				ok := q.Fields.Match(fields)
-				if ok {
-					tm := stepTS(d.Time.Unix(), step)
-					results = results.Add(q.Event, fields, tm, float64(c.Count))
-				}
-			}
+			results = SnapshotResults(results, &q, d)
 		}
 		for i := range results {
 			r := &results[i]
@@ -132,12 +120,15 @@ func (tee teeStorer) Add(s db.Storer) teeStorer {
 }
 
 func (tee teeStorer) Store(s *db.Snapshot) error {
-	if len(tee) == 0 {
-		return nil
-	}
 	if len(tee) == 1 {
 		return tee[0].Store(s)
 	}
+	_, err := tee.storeAll(s)
+	return err
+}
+
+// storeAll stores to all stores concurrently and returns the number of successful stores and the first error
+func (tee teeStorer) storeAll(s *db.Snapshot) (int, error) {
 	errc := make(chan error, len(tee))
 	wg := new(sync.WaitGroup)
 	for i := range tee {
@@ -150,11 +141,42 @@ func (tee teeStorer) Store(s *db.Snapshot) error {
 	}
 	wg.Wait()
 	close(errc)
+	var (
+		n        int
+		firstErr error
+	)
 	for err := range errc {
-		if err != nil {
-			return err
+		if err == nil {
+			n++
+		} else if firstErr == nil {
+			firstErr = err
 		}
 	}
+	return n, firstErr
+}
+
+// QuorumStore stores to multiple stores and fails only if less than quorum stores succeed.
+// A quorum less than 1 or greater than the number of stores requires all stores to succeed.
+func QuorumStore(quorum int, stores ...db.Storer) db.Storer {
+	if quorum < 1 || quorum > len(stores) {
+		quorum = len(stores)
+	}
+	return &quorumStorer{
+		stores: stores,
+		quorum: quorum,
+	}
+}
+
+type quorumStorer struct {
+	stores teeStorer
+	quorum int
+}
+
+func (q *quorumStorer) Store(s *db.Snapshot) error {
+	n, err := q.stores.storeAll(s)
+	if n < q.quorum {
+		return errors.Errorf("Stored to %d of %d stores, quorum is %d: %w", n, len(q.stores), q.quorum, err)
+	}
 	return nil
 }
 
@@ -209,6 +231,9 @@ func (c *cacheStore) Storer(event string) (db.Storer, error) {
 	if w := c.storers[event]; w != nil {
 		return w, nil
 	}
+	if c.storers == nil {
+		c.storers = make(map[string]db.Storer)
+	}
 	c.storers[event] = w
 	return w, nil
 }
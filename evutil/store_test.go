@@ -9,6 +9,7 @@ import (
 	"github.com/alxarch/evdb/events"
 	"github.com/alxarch/evdb/evutil"
 	"github.com/alxarch/evdb/internal/assert"
+	errors "golang.org/x/xerrors"
 )
 
 func Test_MemoryStore(t *testing.T) {
@@ -79,3 +80,35 @@ func Test_MemoryStore(t *testing.T) {
 	assert.Equal(t, s2.Len(), 1)
 
 }
+
+func TestQuorumStore(t *testing.T) {
+	failed := evutil.StorerFunc(func(*meter.Snapshot) error {
+		return errors.New("Store failed")
+	})
+	for _, tc := range []struct {
+		Name   string
+		Quorum int
+		Failed int
+		OK     bool
+	}{
+		{"all", 0, 0, true},
+		{"all failed", 0, 1, false},
+		{"quorum", 2, 1, true},
+		{"no quorum", 2, 2, false},
+		{"over quorum", 4, 1, false},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			var stores []meter.Storer
+			for i := 0; i < 3; i++ {
+				if i < tc.Failed {
+					stores = append(stores, failed)
+				} else {
+					stores = append(stores, new(evutil.MemoryStorer))
+				}
+			}
+			s := evutil.QuorumStore(tc.Quorum, stores...)
+			err := s.Store(&meter.Snapshot{Time: time.Now()})
+			assert.Equal(t, err == nil, tc.OK)
+		})
+	}
+}
@@ -35,15 +35,22 @@ func (fields Fields) Get(label string) (string, bool) {
 	return "", false
 }
 
-// UnmarshalJSON implements json.Unmarshaler interface
+// UnmarshalJSON implements json.Unmarshaler interface.
+// Fields are sorted by label since JSON objects have no order.
 func (fields *Fields) UnmarshalJSON(data []byte) error {
 	var m map[string]string
 	if err := json.Unmarshal(data, &m); err != nil {
 		return err
 	}
+	labels := make([]string, 0, len(m))
+	for label := range m {
+		labels = append(labels, label)
+	}
+	// Keep label order stable across round trips
+	sort.Strings(labels)
 	f := (*fields)[:0]
-	for label, value := range m {
-		f = f.Set(label, value)
+	for _, label := range labels {
+		f = f.Set(label, m[label])
 	}
 	*fields = f
 	return nil
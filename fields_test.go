@@ -138,6 +138,12 @@ func TestFieldsJSON(t *testing.T) {
 			assert.OK(t, fields.Sorted().Equal(tt.fields), "%s Fields.UnmarshalJSON invalid fields %v != %v", tt.name, fields, tt.fields)
 		})
 	}
+	// Labels are unmarshaled in sorted order
+	for i := 0; i < 10; i++ {
+		var fields evdb.Fields
+		assert.NoError(t, fields.UnmarshalJSON([]byte(`{"foo":"bar","a":"b","c":"d"}`)))
+		assert.Equal(t, fields, evdb.Fields{{Label: "a", Value: "b"}, {Label: "c", Value: "d"}, {Label: "foo", Value: "bar"}})
+	}
 }
 
 // func TestFields_MatchSorted(t *testing.T) {
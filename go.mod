@@ -1,6 +1,6 @@
 module github.com/alxarch/evdb
 
-go 1.12
+go 1.24
 
 require (
 	github.com/alxarch/fastredis v0.1.8-alpha
@@ -9,3 +9,13 @@ require (
 	github.com/gorilla/handlers v1.4.2
 	golang.org/x/xerrors v0.0.0-20190717185122-a985d3407aa7
 )
+
+require (
+	github.com/AndreasBriese/bbloom v0.0.0-20180913140656-343706a395b7 // indirect
+	github.com/dgryski/go-farm v0.0.0-20180109070241-2de33835d102 // indirect
+	github.com/dustin/go-humanize v1.0.0 // indirect
+	github.com/golang/protobuf v1.2.0 // indirect
+	github.com/pkg/errors v0.8.0 // indirect
+	golang.org/x/net v0.0.0-20181217023233-e147a9138326 // indirect
+	golang.org/x/sys v0.0.0-20181218192612-074acd46bca6 // indirect
+)
@@ -0,0 +1,155 @@
+package evdb
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HealthChecker is implemented by DBs that can check their health
+type HealthChecker interface {
+	Health(ctx context.Context) error
+}
+
+// Health checks the health of a DB.
+// Wrapped DBs are unwrapped until a HealthChecker is found, DBs without health checks are healthy.
+func Health(ctx context.Context, db DB) error {
+	for ; db != nil; db = Unwrap(db) {
+		if h, ok := db.(HealthChecker); ok {
+			return h.Health(ctx)
+		}
+	}
+	return nil
+}
+
+// StatsReporter is implemented by DBs reporting runtime statistics
+type StatsReporter interface {
+	// ReportStats adds JSON encodable statistics to stats
+	ReportStats(stats map[string]interface{})
+}
+
+// Stats collects the statistics of a DB and all DBs it wraps
+func Stats(db DB) map[string]interface{} {
+	stats := make(map[string]interface{})
+	for ; db != nil; db = Unwrap(db) {
+		if r, ok := db.(StatsReporter); ok {
+			r.ReportStats(stats)
+		}
+	}
+	return stats
+}
+
+// WriteStats are the write counters of an event
+type WriteStats struct {
+	Snapshots int64 `json:"snapshots"`
+	Counters  int64 `json:"counters"`
+	Errors    int64 `json:"errors"`
+}
+
+// ScanStats are scan counters and latencies
+type ScanStats struct {
+	Scans     int64   `json:"scans"`
+	Queries   int64   `json:"queries"`
+	Errors    int64   `json:"errors"`
+	AvgMillis float64 `json:"avgMillis"`
+	MaxMillis float64 `json:"maxMillis"`
+}
+
+// CollectStats counts writes per event and measures scan latencies.
+// Stats are reported under the "writes" and "scans" keys.
+func CollectStats() Option {
+	return fnOption(func(db DB) (DB, error) {
+		s := statsDB{
+			DB:     db,
+			writes: make(map[string]*WriteStats),
+		}
+		return &s, nil
+	})
+}
+
+type statsDB struct {
+	DB
+	mu        sync.Mutex
+	writes    map[string]*WriteStats
+	scans     ScanStats
+	totalTime time.Duration
+	maxTime   time.Duration
+}
+
+func (s *statsDB) Unwrap() DB {
+	return s.DB
+}
+
+func (s *statsDB) Storer(event string) (Storer, error) {
+	w, err := s.DB.Storer(event)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	stats := s.writes[event]
+	if stats == nil {
+		stats = new(WriteStats)
+		s.writes[event] = stats
+	}
+	s.mu.Unlock()
+	return &statsStorer{w, stats}, nil
+}
+
+func (s *statsDB) Scan(ctx context.Context, queries ...Query) (Results, error) {
+	start := time.Now()
+	results, err := s.DB.Scan(ctx, queries...)
+	d := time.Since(start)
+	s.mu.Lock()
+	s.scans.Scans++
+	s.scans.Queries += int64(len(queries))
+	if err != nil {
+		s.scans.Errors++
+	}
+	s.totalTime += d
+	if d > s.maxTime {
+		s.maxTime = d
+	}
+	s.mu.Unlock()
+	return results, err
+}
+
+// ReportStats implements StatsReporter interface
+func (s *statsDB) ReportStats(stats map[string]interface{}) {
+	s.mu.Lock()
+	scans := s.scans
+	if scans.Scans > 0 {
+		scans.AvgMillis = millis(s.totalTime / time.Duration(scans.Scans))
+	}
+	scans.MaxMillis = millis(s.maxTime)
+	writes := make(map[string]WriteStats, len(s.writes))
+	for event, w := range s.writes {
+		writes[event] = WriteStats{
+			Snapshots: atomic.LoadInt64(&w.Snapshots),
+			Counters:  atomic.LoadInt64(&w.Counters),
+			Errors:    atomic.LoadInt64(&w.Errors),
+		}
+	}
+	s.mu.Unlock()
+	stats["scans"] = scans
+	stats["writes"] = writes
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+type statsStorer struct {
+	Storer
+	stats *WriteStats
+}
+
+func (s *statsStorer) Store(snap *Snapshot) error {
+	if err := s.Storer.Store(snap); err != nil {
+		atomic.AddInt64(&s.stats.Errors, 1)
+		return err
+	}
+	atomic.AddInt64(&s.stats.Snapshots, 1)
+	atomic.AddInt64(&s.stats.Counters, int64(len(snap.Counters)))
+	return nil
+}
@@ -0,0 +1,82 @@
+package evdb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/events"
+	"github.com/alxarch/evdb/internal/assert"
+	errors "golang.org/x/xerrors"
+)
+
+type healthDB struct {
+	scanLog
+	err error
+}
+
+func (db *healthDB) Health(context.Context) error {
+	return db.err
+}
+
+type dbOpener struct {
+	db evdb.DB
+}
+
+func (o *dbOpener) Open(string) (evdb.DB, error) {
+	return o.db, nil
+}
+
+func TestHealth(t *testing.T) {
+	mem := new(healthDB)
+	if err := evdb.Register("healthtest", &dbOpener{mem}); err != nil {
+		t.Fatal(err)
+	}
+	db, err := evdb.Open("healthtest://", evdb.CollectStats())
+	assert.NoError(t, err)
+	ctx := context.Background()
+	assert.NoError(t, evdb.Health(ctx, db))
+	mem.err = errors.New("Unhealthy")
+	assert.Equal(t, evdb.Health(ctx, db), mem.err)
+	assert.NoError(t, evdb.Health(ctx, new(scanLog)))
+}
+
+func TestCollectStats(t *testing.T) {
+	if err := evdb.Register("statstest", &scanLogOpener{new(scanLog)}); err != nil {
+		t.Fatal(err)
+	}
+	db, err := evdb.Open("statstest://", evdb.CollectStats())
+	assert.NoError(t, err)
+	foo, err := db.Storer("foo")
+	assert.NoError(t, err)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		err := foo.Store(&evdb.Snapshot{
+			Time:   now,
+			Labels: []string{"color"},
+			Counters: []events.Counter{
+				{Count: 1, Values: []string{"blue"}},
+				{Count: 2, Values: []string{"red"}},
+			},
+		})
+		assert.NoError(t, err)
+	}
+	q := evdb.Query{
+		Event: "foo",
+		TimeRange: evdb.TimeRange{
+			Start: now.Add(-time.Hour),
+			End:   now,
+			Step:  time.Hour,
+		},
+	}
+	_, err = db.Scan(context.Background(), q, q)
+	assert.NoError(t, err)
+	stats := evdb.Stats(db)
+	assert.Equal(t, stats["writes"], map[string]evdb.WriteStats{
+		"foo": {Snapshots: 3, Counters: 6},
+	})
+	scans := stats["scans"].(evdb.ScanStats)
+	assert.Equal(t, scans.Scans, int64(1))
+	assert.Equal(t, scans.Queries, int64(2))
+}
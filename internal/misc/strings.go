@@ -1,8 +1,9 @@
 package misc
 
+// AppendDistinct appends values of src that are not in dst
 func AppendDistinct(dst []string, src ...string) []string {
-	for i, s := range src {
-		if IndexOf(dst, s[:i]) == -1 {
+	for _, s := range src {
+		if IndexOf(dst, s) == -1 {
 			dst = append(dst, s)
 		}
 	}
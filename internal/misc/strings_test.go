@@ -0,0 +1,23 @@
+package misc_test
+
+import (
+	"testing"
+
+	"github.com/alxarch/evdb/internal/assert"
+	"github.com/alxarch/evdb/internal/misc"
+)
+
+func TestAppendDistinct(t *testing.T) {
+	for _, tc := range []struct {
+		Dst  []string
+		Src  []string
+		Want []string
+	}{
+		{nil, nil, nil},
+		{nil, []string{"a", "b", "a"}, []string{"a", "b"}},
+		{[]string{"b"}, []string{"a", "bb", "b", "c"}, []string{"b", "a", "bb", "c"}},
+		{nil, []string{"", "a", ""}, []string{"", "a"}},
+	} {
+		assert.Equal(t, misc.AppendDistinct(tc.Dst, tc.Src...), tc.Want)
+	}
+}
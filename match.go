@@ -79,18 +79,71 @@ func (prefix MatchPrefix) MatchString(s string) bool {
 	return strings.HasPrefix(s, string(prefix))
 }
 
+// MatchNot negates a Matcher
+type MatchNot struct {
+	Matcher
+}
+
+// Match implements Matcher interface
+func (m MatchNot) Match(b []byte) bool {
+	return !m.Matcher.Match(b)
+}
+
+// MatchString implements Matcher interface
+func (m MatchNot) MatchString(s string) bool {
+	return !m.Matcher.MatchString(s)
+}
+
+func (m MatchNot) String() string {
+	return fmt.Sprintf("!not(%s)", m.Matcher)
+}
+
+// MatchPresent creates a Matcher for labels with a non empty value
+func MatchPresent() Matcher {
+	return MatchNot{MatchString("")}
+}
+
+// MatchAbsent creates a Matcher for labels that are missing or empty
+func MatchAbsent() Matcher {
+	return MatchString("")
+}
+
+// MatchValues matches any of the values
+type MatchValues []string
+
+var _ Matcher = MatchValues(nil)
+
+// Match implements Matcher interface
+func (values MatchValues) Match(b []byte) bool {
+	for _, v := range values {
+		if v == string(b) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchString implements Matcher interface
+func (values MatchValues) MatchString(s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 // MatchAny creates a Matcher matching any value
 func MatchAny(values ...string) Matcher {
 	distinct := make([]string, 0, len(values))
 	distinct = misc.AppendDistinct(distinct, values...)
-	for i, s := range distinct {
-		distinct[i] = regexp.QuoteMeta(s)
-	}
-	pattern := fmt.Sprintf(`^(%s)$`, strings.Join(distinct, "|"))
-	rx, _ := regexp.Compile(pattern)
-	return rx
+	return MatchValues(distinct)
 }
 
+// MatchFields matches field values by label.
+//
+// Labels missing from fields pass all matchers except negated ones,
+// MatchNot matchers match missing labels as empty values so that MatchPresent rejects them.
 type MatchFields map[string]Matcher
 
 func (mf MatchFields) MatchString(label string, s string) bool {
@@ -107,19 +160,42 @@ func (mf MatchFields) MatchBytes(label string, b []byte) bool {
 	return true
 }
 
+// Match checks if fields match all label matchers
 func (mf MatchFields) Match(fields Fields) bool {
-	if mf == nil {
-		return true
-	}
-	for i := range fields {
-		f := &fields[i]
-		if !mf.MatchString(f.Label, f.Value) {
+	for label, m := range mf {
+		if m == nil {
+			continue
+		}
+		v, ok := fields.Get(label)
+		if !ok {
+			if !matchMissing(m) {
+				return false
+			}
+			continue
+		}
+		if !m.MatchString(v) {
 			return false
 		}
 	}
 	return true
 }
 
+// matchMissing checks if a matcher matches a missing label
+func matchMissing(m Matcher) bool {
+	switch m := m.(type) {
+	case MatchNot:
+		return m.MatchString("")
+	case Matchers:
+		for _, m := range m {
+			if matchMissing(m) {
+				return true
+			}
+		}
+		return len(m) == 0
+	}
+	return true
+}
+
 func (mf MatchFields) Copy() MatchFields {
 	if mf == nil {
 		return nil
@@ -211,6 +287,10 @@ func (m *matchDB) Storer(event string) (Storer, error) {
 	return m.DB.Storer(event)
 }
 
+func (m *matchDB) Unwrap() DB {
+	return m.DB
+}
+
 func (m *matchDB) apply(db DB) (DB, error) {
 	return newMatchDB(db, m.match)
 }
@@ -1,6 +1,7 @@
 package evdb_test
 
 import (
+	"regexp"
 	"testing"
 
 	"github.com/alxarch/evdb"
@@ -65,6 +66,9 @@ func Test_MatchAny(t *testing.T) {
 	assert.OK(t, m.Match([]byte("bar")), "MatchAny matches")
 	assert.OK(t, !m.Match([]byte("barfoo")), "MatchAny matches")
 	assert.OK(t, !m.Match([]byte("fo")), "MatchAny matches")
+	// Values are kept so that matchers can be serialized and resolved by indexes
+	assert.Equal(t, evdb.MatchAny("foo", "bar", "foo", "a.c"), evdb.MatchValues{"foo", "bar", "a.c"})
+	assert.OK(t, !evdb.MatchAny("a.c").MatchString("abc"), "MatchAny matches literal values")
 }
 
 func Test_Matchers(t *testing.T) {
@@ -126,3 +130,56 @@ func Test_MatchFields(t *testing.T) {
 	assert.Equal(t, mmm[1], evdb.MatchString("baz"))
 	assert.Equal(t, mmm[2], evdb.MatchString("woo"))
 }
+
+func Test_MatchNot(t *testing.T) {
+	m := evdb.MatchNot{Matcher: evdb.MatchAny("foo", "bar")}
+	assert.OK(t, !m.MatchString("foo"), "MatchNot matches")
+	assert.OK(t, !m.MatchString("bar"), "MatchNot matches")
+	assert.OK(t, m.MatchString("baz"), "MatchNot matches")
+	assert.OK(t, m.MatchString(""), "MatchNot matches")
+	assert.OK(t, !m.Match([]byte("foo")), "MatchNot matches")
+	assert.OK(t, m.Match([]byte("baz")), "MatchNot matches")
+
+	fields := evdb.Fields{{Label: "foo", Value: "bar"}}
+	var mf evdb.MatchFields
+	mf = mf.Set("foo", evdb.MatchPresent())
+	assert.OK(t, mf.Match(fields), "MatchPresent matches")
+	mf = mf.Set("baz", evdb.MatchAbsent())
+	assert.OK(t, mf.Match(fields), "MatchAbsent matches missing label")
+	mf = mf.Set("baz", evdb.MatchPresent())
+	assert.OK(t, !mf.Match(fields), "MatchPresent does not match missing label")
+	mf = evdb.MatchFields{"foo": evdb.MatchNot{Matcher: evdb.MatchString("bar")}}
+	assert.OK(t, !mf.Match(fields), "MatchNot does not match")
+	mf = evdb.MatchFields{"baz": evdb.MatchNot{Matcher: evdb.MatchString("bar")}}
+	assert.OK(t, mf.Match(fields), "MatchNot matches missing label")
+}
+
+func Test_MatchFields_MissingLabels(t *testing.T) {
+	fields := evdb.Fields{{Label: "foo", Value: "bar"}}
+	for _, tc := range []struct {
+		Matcher evdb.Matcher
+		Match   bool
+	}{
+		{nil, true},
+		{evdb.MatchString("bar"), true},
+		{evdb.MatchString(""), true},
+		{evdb.MatchAny("bar", "baz"), true},
+		{evdb.MatchPrefix("b"), true},
+		{regexp.MustCompile("^b"), true},
+		{evdb.MatchNot{Matcher: evdb.MatchString("bar")}, true},
+		{evdb.MatchNot{Matcher: evdb.MatchString("")}, false},
+		{evdb.MatchNot{Matcher: regexp.MustCompile("^b?$")}, false},
+		{evdb.MatchPresent(), false},
+		{evdb.MatchAbsent(), true},
+		{evdb.Matchers{evdb.MatchPresent(), evdb.MatchPrefix("b")}, true},
+		{evdb.Matchers{evdb.MatchPresent()}, false},
+	} {
+		mf := evdb.MatchFields{"missing": tc.Matcher}
+		assert.OK(t, mf.Match(fields) == tc.Match, "Missing label match %v", tc.Matcher)
+	}
+	// Present labels are matched by value
+	mf := evdb.MatchFields{"foo": evdb.MatchString("baz")}
+	assert.OK(t, !mf.Match(fields), "Present label match")
+	mf = evdb.MatchFields{"foo": evdb.MatchAbsent()}
+	assert.OK(t, !mf.Match(fields), "Absent present label")
+}
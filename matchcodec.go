@@ -0,0 +1,224 @@
+package evdb
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"sort"
+	"sync"
+
+	errors "golang.org/x/xerrors"
+)
+
+// Matchers are serialized to JSON as single key objects mapping a registered
+// matcher name to the matcher's value, ie `{"prefix":"foo"}` or `{"not":{"any":["foo","bar"]}}`.
+
+var (
+	matchersMu   sync.RWMutex
+	matcherNames = map[reflect.Type]string{}
+	matcherTypes = map[string]reflect.Type{}
+)
+
+var regexpType = reflect.TypeOf((*regexp.Regexp)(nil))
+
+// RegisterMatcher registers a Matcher type for JSON serialization under a name.
+// Values of the matcher type are encoded using encoding/json.
+func RegisterMatcher(name string, m Matcher) error {
+	if m == nil {
+		return errors.Errorf("Nil matcher %q", name)
+	}
+	typ := reflect.TypeOf(m)
+	matchersMu.Lock()
+	defer matchersMu.Unlock()
+	if _, duplicate := matcherTypes[name]; duplicate {
+		return errors.Errorf("Matcher %q already registered", name)
+	}
+	if _, duplicate := matcherNames[typ]; duplicate {
+		return errors.Errorf("Matcher type %s already registered", typ)
+	}
+	matcherTypes[name] = typ
+	matcherNames[typ] = name
+	return nil
+}
+
+func init() {
+	for name, m := range map[string]Matcher{
+		"equals": MatchString(""),
+		"prefix": MatchPrefix(""),
+		"suffix": MatchSuffix(""),
+		"any":    MatchValues(nil),
+		"not":    MatchNot{},
+		"or":     Matchers(nil),
+		"regexp": (*regexp.Regexp)(nil),
+	} {
+		if err := RegisterMatcher(name, m); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// MatcherName returns the registered name of a Matcher's type
+func MatcherName(m Matcher) (string, bool) {
+	matchersMu.RLock()
+	name, ok := matcherNames[reflect.TypeOf(m)]
+	matchersMu.RUnlock()
+	return name, ok
+}
+
+// MarshalMatcher encodes a Matcher to JSON
+func MarshalMatcher(m Matcher) ([]byte, error) {
+	if m == nil {
+		return []byte(`null`), nil
+	}
+	name, ok := MatcherName(m)
+	if !ok {
+		return nil, errors.Errorf("Unregistered matcher type %s", reflect.TypeOf(m))
+	}
+	var value interface{} = m
+	if rx, ok := m.(*regexp.Regexp); ok {
+		value = rx.String()
+	}
+	return json.Marshal(map[string]interface{}{
+		name: value,
+	})
+}
+
+// UnmarshalMatcher decodes a Matcher from JSON
+func UnmarshalMatcher(data []byte) (Matcher, error) {
+	var tmp map[string]json.RawMessage
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return nil, err
+	}
+	if tmp == nil {
+		return nil, nil
+	}
+	if len(tmp) != 1 {
+		return nil, errors.Errorf("Invalid matcher JSON %s", data)
+	}
+	for name, raw := range tmp {
+		matchersMu.RLock()
+		typ := matcherTypes[name]
+		matchersMu.RUnlock()
+		if typ == nil {
+			return nil, errors.Errorf("Unregistered matcher %q", name)
+		}
+		if typ == regexpType {
+			var pattern string
+			if err := json.Unmarshal(raw, &pattern); err != nil {
+				return nil, err
+			}
+			return regexp.Compile(pattern)
+		}
+		v := reflect.New(typ)
+		if err := json.Unmarshal(raw, v.Interface()); err != nil {
+			return nil, errors.Errorf("Failed to decode %q matcher: %s", name, err)
+		}
+		return v.Elem().Interface().(Matcher), nil
+	}
+	return nil, nil
+}
+
+// MarshalJSON implements json.Marshaler interface
+func (m MatchNot) MarshalJSON() ([]byte, error) {
+	return MarshalMatcher(m.Matcher)
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface
+func (m *MatchNot) UnmarshalJSON(data []byte) error {
+	inner, err := UnmarshalMatcher(data)
+	if err != nil {
+		return err
+	}
+	if inner == nil {
+		return errors.New("Invalid nil matcher")
+	}
+	m.Matcher = inner
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler interface
+func (mm Matchers) MarshalJSON() ([]byte, error) {
+	if mm == nil {
+		return []byte(`null`), nil
+	}
+	tmp := make([]json.RawMessage, len(mm))
+	for i, m := range mm {
+		data, err := MarshalMatcher(m)
+		if err != nil {
+			return nil, err
+		}
+		tmp[i] = data
+	}
+	return json.Marshal(tmp)
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface
+func (mm *Matchers) UnmarshalJSON(data []byte) error {
+	var tmp []json.RawMessage
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return err
+	}
+	if tmp == nil {
+		*mm = nil
+		return nil
+	}
+	matchers := make([]Matcher, 0, len(tmp))
+	for _, raw := range tmp {
+		m, err := UnmarshalMatcher(raw)
+		if err != nil {
+			return err
+		}
+		if m != nil {
+			matchers = append(matchers, m)
+		}
+	}
+	*mm = matchers
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler interface
+func (mf MatchFields) MarshalJSON() ([]byte, error) {
+	if mf == nil {
+		return []byte(`null`), nil
+	}
+	labels := make([]string, 0, len(mf))
+	for label, m := range mf {
+		if m != nil {
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+	tmp := make(map[string]json.RawMessage, len(labels))
+	for _, label := range labels {
+		data, err := MarshalMatcher(mf[label])
+		if err != nil {
+			return nil, errors.Errorf("Failed to encode %q matcher: %s", label, err)
+		}
+		tmp[label] = data
+	}
+	return json.Marshal(tmp)
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface
+func (mf *MatchFields) UnmarshalJSON(data []byte) error {
+	var tmp map[string]json.RawMessage
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return err
+	}
+	if tmp == nil {
+		*mf = nil
+		return nil
+	}
+	m := make(map[string]Matcher, len(tmp))
+	for label, raw := range tmp {
+		matcher, err := UnmarshalMatcher(raw)
+		if err != nil {
+			return errors.Errorf("Failed to decode %q matcher: %s", label, err)
+		}
+		if matcher != nil {
+			m[label] = matcher
+		}
+	}
+	*mf = m
+	return nil
+}
@@ -0,0 +1,84 @@
+package evdb_test
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alxarch/evdb"
+	"github.com/alxarch/evdb/internal/assert"
+)
+
+type matchLen int
+
+type matchNone struct{}
+
+func (matchNone) Match([]byte) bool       { return false }
+func (matchNone) MatchString(string) bool { return false }
+
+func (n matchLen) Match(b []byte) bool {
+	return len(b) == int(n)
+}
+
+func (n matchLen) MatchString(s string) bool {
+	return len(s) == int(n)
+}
+
+func Test_MatchFieldsJSON(t *testing.T) {
+	assert.NoError(t, evdb.RegisterMatcher("len", matchLen(0)))
+	assert.OK(t, evdb.RegisterMatcher("len", matchLen(0)) != nil, "Duplicate registration")
+	m := evdb.MatchFields{
+		"a": evdb.MatchString("foo"),
+		"b": evdb.MatchPrefix("foo"),
+		"c": evdb.MatchSuffix("foo"),
+		"d": evdb.MatchAny("foo", "bar"),
+		"e": regexp.MustCompile("^foo"),
+		"f": evdb.MatchNot{Matcher: evdb.MatchPresent()},
+		"g": evdb.Matchers{evdb.MatchString("foo"), matchLen(2)},
+	}
+	data, err := json.Marshal(m)
+	assert.NoError(t, err)
+	assert.Equal(t, string(data), strings.Join([]string{
+		`{"a":{"equals":"foo"}`,
+		`"b":{"prefix":"foo"}`,
+		`"c":{"suffix":"foo"}`,
+		`"d":{"any":["foo","bar"]}`,
+		`"e":{"regexp":"^foo"}`,
+		`"f":{"not":{"not":{"equals":""}}}`,
+		`"g":{"or":[{"equals":"foo"},{"len":2}]}}`,
+	}, ","))
+	var mm evdb.MatchFields
+	assert.NoError(t, json.Unmarshal(data, &mm))
+	assert.Equal(t, mm, m)
+
+	_, err = evdb.MarshalMatcher(matchNone{})
+	assert.OK(t, err != nil, "Unregistered matcher")
+	_, err = evdb.UnmarshalMatcher([]byte(`{"foo":"bar"}`))
+	assert.OK(t, err != nil, "Unregistered matcher")
+	_, err = evdb.UnmarshalMatcher([]byte(`{"prefix":"bar","suffix":"foo"}`))
+	assert.OK(t, err != nil, "Invalid matcher")
+}
+
+func Test_QueryJSON(t *testing.T) {
+	q := evdb.Query{
+		Event: "foo",
+		TimeRange: evdb.TimeRange{
+			Start: time.Date(2019, 1, 2, 10, 0, 0, 0, time.UTC),
+			End:   time.Date(2019, 1, 2, 11, 0, 0, 0, time.UTC),
+			Step:  time.Hour,
+		},
+		Fields: evdb.MatchFields{"host": evdb.MatchString("a")},
+	}
+	data, err := json.Marshal(&q)
+	assert.NoError(t, err)
+	assert.Equal(t, string(data), `{"event":"foo","start":"2019-01-02T10:00:00Z","end":"2019-01-02T11:00:00Z","step":3600000000000,"fields":{"host":{"equals":"a"}}}`)
+	var qq evdb.Query
+	assert.NoError(t, json.Unmarshal(data, &qq))
+	assert.Equal(t, qq, q)
+	// Queries without matchers omit fields
+	data, err = json.Marshal(&evdb.Query{Event: "foo"})
+	assert.NoError(t, err)
+	assert.OK(t, !strings.Contains(string(data), "fields"), "Empty fields omitted %s", data)
+}
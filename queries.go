@@ -0,0 +1,27 @@
+package evdb
+
+import (
+	errors "golang.org/x/xerrors"
+)
+
+// ErrQueryNotFound is returned by a QueryStore when a named query does not exist
+var ErrQueryNotFound = errors.New("Query not found")
+
+// QueryStore is implemented by DBs that persist named queries as JSON documents
+type QueryStore interface {
+	PutQuery(name string, doc []byte) error
+	GetQuery(name string) ([]byte, error)
+	DeleteQuery(name string) error
+	// AllQueries returns the documents of all stored queries
+	AllQueries() ([][]byte, error)
+}
+
+// FindQueryStore returns the QueryStore of a DB or of the DBs it wraps
+func FindQueryStore(db DB) QueryStore {
+	for ; db != nil; db = Unwrap(db) {
+		if s, ok := db.(QueryStore); ok {
+			return s
+		}
+	}
+	return nil
+}
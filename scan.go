@@ -3,15 +3,21 @@ package evdb
 import (
 	"context"
 	"sync"
+
+	errors "golang.org/x/xerrors"
 )
 
-// Query is a query over a range of time
+// Query is a query over a range of time.
+// Queries encode to JSON with lower case keys and registered matcher names for fields.
 type Query struct {
-	Event string
+	Event string `json:"event"`
 	TimeRange
-	Fields MatchFields
+	Fields MatchFields `json:"fields,omitempty"`
 }
 
+// ErrScanLimit is returned by scanners that abort queries reading too many keys
+var ErrScanLimit = errors.New("Scan limit exceeded")
+
 type Scanner interface {
 	Scan(ctx context.Context, queries ...Query) (Results, error)
 }
@@ -20,6 +26,14 @@ type Querier interface {
 	Query(ctx context.Context, q *Query) (Results, error)
 }
 
+// QuerierFunc is a function implementing Querier
+type QuerierFunc func(ctx context.Context, q *Query) (Results, error)
+
+// Query implements Querier interface
+func (fn QuerierFunc) Query(ctx context.Context, q *Query) (Results, error) {
+	return fn(ctx, q)
+}
+
 // NewScanner convers a Querier to a Scanner
 func NewScanner(q Querier) Scanner {
 	if s, ok := q.(Scanner); ok {
@@ -104,3 +104,9 @@ func (tr TimeRange) Offset(d time.Duration) TimeRange {
 	tr.Start, tr.End = tr.Start.Add(d), tr.End.Add(d)
 	return tr
 }
+
+// Extend extends the end of a TimeRange by a duration
+func (tr TimeRange) Extend(d time.Duration) TimeRange {
+	tr.End = tr.End.Add(d)
+	return tr
+}
@@ -37,5 +37,9 @@ func Test_TimeRange(t *testing.T) {
 	assert.Equal(t, tr.Rel(&ot), db.TimeRelOverlapsAfter)
 	assert.Equal(t, ot.Rel(&tr), db.TimeRelOverlapsBefore)
 	assert.Equal(t, ot.Rel(&ot), db.TimeRelEqual)
+	et := tr.Extend(2 * time.Hour)
+	assert.Equal(t, et.NumSteps(), 12)
+	assert.Equal(t, et.Start, tr.Start)
+	assert.Equal(t, tr.Rel(&et), db.TimeRelAround)
 
 }